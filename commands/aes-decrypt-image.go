@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func AESDecryptImage() *cli.Command {
+	return &cli.Command{
+		Name:      "aes-decrypt-image",
+		ArgsUsage: "<image-path>",
+		Flags:     imageFlags(),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			imagePath := cmd.Args().Get(0)
+			if imagePath == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Image path is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			opts := enigma.ImageOptions{Progress: fileOptions(cmd).Progress}
+			enigmaContext.Result = imageResponse(enigma.AESDecryptImage(enigmaContext.Device, imagePath, opts))
+
+			return nil
+		},
+	}
+}
@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -17,6 +15,7 @@ func AESDecrypt() *cli.Command {
 	return &cli.Command{
 		Name:      "aes-decrypt",
 		ArgsUsage: "<base64-encoded-ciphertext>",
+		Flags:     aesFlags(),
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
 			if !ok {
@@ -24,6 +23,42 @@ func AESDecrypt() *cli.Command {
 				os.Exit(1)
 			}
 
+			format, err := parseAESFormat(cmd)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			if isStreaming(cmd) {
+				outPath := streamPath(cmd, "out")
+				n, err := streamAES(enigmaContext.Device, streamPath(cmd, "in"), outPath, false, format)
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: aesError(err),
+						Data:    nil,
+					}
+					return nil
+				}
+
+				// Keep stdout clean when it carries the stream
+				if outPath != "-" {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "success",
+						Message: enigma.GetCodeMessage(0),
+						Data: map[string]any{
+							"output":          outPath,
+							"plaintext_bytes": n,
+						},
+					}
+				}
+				return nil
+			}
+
 			base64Ciphertext := cmd.Args().Get(0)
 			if base64Ciphertext == "" {
 				enigmaContext.Result = &types.EnigmaResponse{
@@ -44,11 +79,16 @@ func AESDecrypt() *cli.Command {
 				return nil
 			}
 
-			plaintext, err := enigma.AESDecrypt(enigmaContext.DLL, string(ciphertext))
+			var plaintext []byte
+			if format.legacy {
+				plaintext, err = enigma.AESDecryptBytesWithPadding(enigmaContext.Device, ciphertext, format.padding)
+			} else {
+				plaintext, err = enigma.AESOpen(enigmaContext.Device, ciphertext)
+			}
 			if err != nil {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
-					Message: err.Error(),
+					Message: aesError(err),
 					Data:    nil,
 				}
 				return nil
@@ -57,7 +97,7 @@ func AESDecrypt() *cli.Command {
 			enigmaContext.Result = &types.EnigmaResponse{
 				Status:  "success",
 				Message: enigma.GetCodeMessage(0),
-				Data:    plaintext,
+				Data:    string(plaintext),
 			}
 
 			return nil
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func AESEncryptDir() *cli.Command {
+	return &cli.Command{
+		Name:      "aes-encrypt-dir",
+		ArgsUsage: "<source-folder-path> <target-folder-path>",
+		Flags:     dirFlags(),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			sourceFolderPath := cmd.Args().Get(0)
+			targetFolderPath := cmd.Args().Get(1)
+
+			if sourceFolderPath == "" || targetFolderPath == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Source and target folder paths are required arguments",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			result, err := enigma.AESSealDir(enigmaContext.Device, sourceFolderPath, targetFolderPath, dirOptions(cmd))
+			if result == nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = dirResponse(result, err)
+
+			return nil
+		},
+	}
+}
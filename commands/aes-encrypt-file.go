@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -15,7 +13,8 @@ import (
 func AESEncryptFile() *cli.Command {
 	return &cli.Command{
 		Name:      "aes-encrypt-file",
-		ArgsUsage: "<source-folder-path> <file-path> <target-folder-path>",
+		ArgsUsage: "<source-file> [target-container-or-folder]",
+		Flags:     fileFlags("encrypt"),
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
 			if !ok {
@@ -23,20 +22,58 @@ func AESEncryptFile() *cli.Command {
 				os.Exit(1)
 			}
 
-			sourceFolderPath := cmd.Args().Get(0)
-			filePath := cmd.Args().Get(1)
-			targetFolderPath := cmd.Args().Get(2)
+			if isLegacyFile(cmd) {
+				sourceFolderPath := cmd.Args().Get(0)
+				filePath := cmd.Args().Get(1)
+				targetFolderPath := cmd.Args().Get(2)
+
+				if sourceFolderPath == "" || filePath == "" || targetFolderPath == "" {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: "Source, file and target folder paths are required arguments",
+						Data:    nil,
+					}
+					return nil
+				}
+
+				err := enigma.AESEncryptFile(enigmaContext.Device, sourceFolderPath, filePath, targetFolderPath)
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "success",
+					Message: enigma.GetCodeMessage(0),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			if cmd.Args().Len() > 2 {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Too many arguments: pass a source and an optional target, or the three legacy arguments",
+					Data:    nil,
+				}
+				return nil
+			}
 
-			if sourceFolderPath == "" || filePath == "" || targetFolderPath == "" {
+			sourcePath := cmd.Args().Get(0)
+			if sourcePath == "" {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
-					Message: "Source, file and target folder paths are required arguments",
+					Message: "Source file path is required as an argument",
 					Data:    nil,
 				}
 				return nil
 			}
 
-			err := enigma.AESEncryptFile(enigmaContext.DLL, sourceFolderPath, filePath, targetFolderPath)
+			target, header, err := enigma.AESSealFile(enigmaContext.Device, sourcePath, cmd.Args().Get(1), fileOptions(cmd))
 			if err != nil {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
@@ -49,7 +86,7 @@ func AESEncryptFile() *cli.Command {
 			enigmaContext.Result = &types.EnigmaResponse{
 				Status:  "success",
 				Message: enigma.GetCodeMessage(0),
-				Data:    nil,
+				Data:    fileData(sourcePath, target, header),
 			}
 
 			return nil
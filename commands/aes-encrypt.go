@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -17,6 +15,7 @@ func AESEncrypt() *cli.Command {
 	return &cli.Command{
 		Name:      "aes-encrypt",
 		ArgsUsage: "<plaintext>",
+		Flags:     aesFlags(),
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
 			if !ok {
@@ -24,6 +23,42 @@ func AESEncrypt() *cli.Command {
 				os.Exit(1)
 			}
 
+			format, err := parseAESFormat(cmd)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			if isStreaming(cmd) {
+				outPath := streamPath(cmd, "out")
+				n, err := streamAES(enigmaContext.Device, streamPath(cmd, "in"), outPath, true, format)
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: aesError(err),
+						Data:    nil,
+					}
+					return nil
+				}
+
+				// Keep stdout clean when it carries the stream
+				if outPath != "-" {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "success",
+						Message: enigma.GetCodeMessage(0),
+						Data: map[string]any{
+							"output":          outPath,
+							"plaintext_bytes": n,
+						},
+					}
+				}
+				return nil
+			}
+
 			plaintext := cmd.Args().Get(0)
 			if plaintext == "" {
 				enigmaContext.Result = &types.EnigmaResponse{
@@ -34,7 +69,12 @@ func AESEncrypt() *cli.Command {
 				return nil
 			}
 
-			ciphertext, err := enigma.AESEncrypt(enigmaContext.DLL, plaintext)
+			var ciphertext []byte
+			if format.legacy {
+				ciphertext, err = enigma.AESEncryptBytesWithPadding(enigmaContext.Device, []byte(plaintext), format.padding)
+			} else {
+				ciphertext, err = enigma.AESSeal(enigmaContext.Device, []byte(plaintext))
+			}
 			if err != nil {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
@@ -44,7 +84,7 @@ func AESEncrypt() *cli.Command {
 				return nil
 			}
 
-			base64Encoded := base64.StdEncoding.EncodeToString([]byte(ciphertext))
+			base64Encoded := base64.StdEncoding.EncodeToString(ciphertext)
 
 			enigmaContext.Result = &types.EnigmaResponse{
 				Status:  "success",
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func AESUnwrapKey() *cli.Command {
+	return &cli.Command{
+		Name:      "aes-unwrap-key",
+		ArgsUsage: "<wrapped-key-hex>",
+		Flags:     keyWrapFlags(),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			wrappedHex := cmd.Args().Get(0)
+			if wrappedHex == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Hex encoded wrapped key is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			wrapped, err := hex.DecodeString(wrappedHex)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Invalid hex encoding: " + err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			var key []byte
+			if cmd.Bool("pad") {
+				key, err = enigma.UnwrapKeyWithPadding(enigmaContext.Device, wrapped)
+			} else {
+				key, err = enigma.UnwrapKey(enigmaContext.Device, wrapped)
+			}
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data: map[string]any{
+					"algorithm": keyWrapAlgorithm(cmd.Bool("pad")),
+					"key":       hex.EncodeToString(key),
+				},
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func AESWrapKey() *cli.Command {
+	return &cli.Command{
+		Name:      "aes-wrap-key",
+		ArgsUsage: "<key-hex>",
+		Flags:     keyWrapFlags(),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyHex := cmd.Args().Get(0)
+			if keyHex == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Hex encoded key is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			key, err := hex.DecodeString(keyHex)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Invalid hex encoding: " + err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			var wrapped []byte
+			if cmd.Bool("pad") {
+				wrapped, err = enigma.WrapKeyWithPadding(enigmaContext.Device, key)
+			} else {
+				wrapped, err = enigma.WrapKey(enigmaContext.Device, key)
+			}
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data: map[string]any{
+					"algorithm":   keyWrapAlgorithm(cmd.Bool("pad")),
+					"wrapped_key": hex.EncodeToString(wrapped),
+				},
+			}
+
+			return nil
+		},
+	}
+}
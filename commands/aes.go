@@ -0,0 +1,381 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+// streamFlags switch a command from base64 arguments to raw binary streams.
+func streamFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "in",
+			Usage: "stream input from `FILE` instead of the argument, - for stdin",
+		},
+		&cli.StringFlag{
+			Name:  "out",
+			Usage: "stream raw output to `FILE` instead of JSON, - for stdout",
+		},
+	}
+}
+
+// aesFlags are shared by aes-encrypt and aes-decrypt.
+func aesFlags() []cli.Flag {
+	return append(streamFlags(),
+		&cli.BoolFlag{
+			Name:  "legacy",
+			Usage: "use the raw, unauthenticated ciphertext format of older versions instead of an envelope",
+		},
+		&cli.StringFlag{
+			Name:  "padding",
+			Usage: "padding of --legacy ciphertext: iso9797-m2, pkcs7, zero or none",
+			Value: enigma.PaddingISO9797M2.String(),
+		},
+	)
+}
+
+// aesFormat is the ciphertext format selected by --legacy and --padding.
+type aesFormat struct {
+	legacy  bool
+	padding enigma.Padding
+}
+
+func parseAESFormat(cmd *cli.Command) (aesFormat, error) {
+	format := aesFormat{legacy: cmd.Bool("legacy")}
+
+	if cmd.IsSet("padding") && !format.legacy {
+		return format, errors.New("--padding only applies to --legacy ciphertext, envelopes are not padded")
+	}
+
+	padding, err := enigma.ParsePadding(cmd.String("padding"))
+	if err != nil {
+		return format, err
+	}
+	format.padding = padding
+
+	return format, nil
+}
+
+// aesError describes err, pointing at --legacy when the input is not an
+// envelope.
+func aesError(err error) string {
+	if errors.Is(err, enigma.ErrEnvelopeFormat) {
+		return err.Error() + "; use --legacy for ciphertext from older versions"
+	}
+	return err.Error()
+}
+
+func isStreaming(cmd *cli.Command) bool {
+	return cmd.IsSet("in") || cmd.IsSet("out")
+}
+
+// streamPath returns the value of the named flag, defaulting to "-".
+func streamPath(cmd *cli.Command, name string) string {
+	if path := cmd.String(name); path != "" {
+		return path
+	}
+	return "-"
+}
+
+// streamAES copies inPath to outPath through the device AES key in the given
+// format and returns the number of plaintext bytes processed.
+func streamAES(dev enigma.Device, inPath, outPath string, encrypt bool, format aesFormat) (int64, error) {
+	return streamFiles(inPath, outPath, func(dst io.Writer, src io.Reader) (int64, error) {
+		return copyAES(dev, dst, src, encrypt, format)
+	})
+}
+
+// streamFiles opens inPath and outPath, "-" meaning stdin and stdout, and
+// runs copy between them. A partially written output file is removed on
+// failure.
+func streamFiles(inPath, outPath string, copy func(dst io.Writer, src io.Reader) (int64, error)) (int64, error) {
+	in := io.ReadCloser(os.Stdin)
+	if inPath != "-" {
+		f, err := os.Open(inPath)
+		if err != nil {
+			return 0, err
+		}
+		in = f
+	}
+	defer in.Close()
+
+	out := io.WriteCloser(os.Stdout)
+	if outPath != "-" {
+		f, err := os.Create(outPath)
+		if err != nil {
+			return 0, err
+		}
+		out = f
+	}
+
+	n, err := copy(out, in)
+
+	if outPath == "-" {
+		return n, err
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(outPath)
+	}
+
+	return n, err
+}
+
+func copyAES(dev enigma.Device, dst io.Writer, src io.Reader, encrypt bool, format aesFormat) (int64, error) {
+	switch {
+	case encrypt:
+		var w io.WriteCloser
+		if format.legacy {
+			w = enigma.NewAESEncryptWriterWithPadding(dev, dst, format.padding)
+		} else {
+			var err error
+			if w, err = enigma.NewAESSealWriter(dev, dst); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := io.Copy(w, src)
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		return n, err
+	case format.legacy:
+		return io.Copy(dst, enigma.NewAESDecryptReaderWithPadding(dev, src, format.padding))
+	default:
+		r, err := enigma.NewAESOpenReader(dev, src)
+		if err != nil {
+			return 0, err
+		}
+		return io.Copy(dst, r)
+	}
+}
+
+// fileFlags are shared by aes-encrypt-file and aes-decrypt-file.
+func fileFlags(mode string) []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "overwrite",
+			Usage: "replace the target if it already exists",
+		},
+		&cli.BoolFlag{
+			Name:  "progress",
+			Usage: "report progress on stderr",
+		},
+		&cli.BoolFlag{
+			Name:  "legacy",
+			Usage: mode + " with the device FileAES export, taking <source-folder-path> <file-path> <target-folder-path>; implied by three arguments",
+		},
+	}
+}
+
+// isLegacyFile reports whether aes-encrypt-file or aes-decrypt-file uses
+// the device FileAES export: with --legacy, or with the three arguments
+// that form took before containers, so existing scripts keep working.
+func isLegacyFile(cmd *cli.Command) bool {
+	return cmd.Bool("legacy") || cmd.Args().Len() == 3
+}
+
+func fileOptions(cmd *cli.Command) enigma.FileOptions {
+	opts := enigma.FileOptions{Overwrite: cmd.Bool("overwrite")}
+
+	if cmd.Bool("progress") {
+		last := int64(-1)
+		opts.Progress = func(done, total int64) {
+			percent := int64(100)
+			if total > 0 {
+				percent = done * 100 / total
+			}
+			if percent != last {
+				last = percent
+				fmt.Fprintf(os.Stderr, "%d%%\n", percent)
+			}
+		}
+	}
+
+	return opts
+}
+
+func fileData(source, target string, header *enigma.FileHeader) map[string]any {
+	return map[string]any{
+		"source":     source,
+		"target":     target,
+		"name":       header.Name,
+		"size":       header.Size,
+		"mtime":      header.ModTime,
+		"device_uid": header.DeviceUID,
+		"sha256":     header.SHA256,
+	}
+}
+
+// dirFlags are shared by aes-encrypt-dir and aes-decrypt-dir.
+func dirFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "include",
+			Usage: "only process files matching `GLOB`, matched against the relative path, or the name if it has no slash",
+		},
+		&cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: "skip files and folders matching `GLOB`",
+		},
+		&cli.BoolFlag{
+			Name:  "overwrite",
+			Usage: "replace targets that already exist",
+		},
+		&cli.StringFlag{
+			Name:  "manifest",
+			Usage: "write the per-file results to `FILE` instead of " + enigma.ManifestName + " in the target folder",
+		},
+		&cli.BoolFlag{
+			Name:  "progress",
+			Usage: "report each file on stderr",
+		},
+	}
+}
+
+func dirOptions(cmd *cli.Command) enigma.DirOptions {
+	opts := enigma.DirOptions{
+		Include:   cmd.StringSlice("include"),
+		Exclude:   cmd.StringSlice("exclude"),
+		Overwrite: cmd.Bool("overwrite"),
+		Manifest:  cmd.String("manifest"),
+	}
+
+	if cmd.Bool("progress") {
+		opts.Progress = func(path string) {
+			fmt.Fprintln(os.Stderr, path)
+		}
+	}
+
+	return opts
+}
+
+// dirResponse summarizes a directory operation. It is an error response if
+// any file failed or the manifest could not be written, but still carries
+// the summary.
+func dirResponse(result *enigma.DirResult, err error) *types.EnigmaResponse {
+	failures := []map[string]string{}
+	for _, entry := range result.Failures() {
+		failures = append(failures, map[string]string{
+			"path":  entry.Path,
+			"error": entry.Error,
+		})
+	}
+
+	response := &types.EnigmaResponse{
+		Status:  "success",
+		Message: enigma.GetCodeMessage(0),
+		Data: map[string]any{
+			"source":    result.Source,
+			"target":    result.Target,
+			"manifest":  result.Manifest,
+			"total":     len(result.Files),
+			"succeeded": result.Succeeded,
+			"failed":    result.Failed,
+			"failures":  failures,
+		},
+	}
+
+	switch {
+	case err != nil:
+		response.Status = "error"
+		response.Message = err.Error()
+	case result.Failed > 0:
+		response.Status = "error"
+		response.Message = fmt.Sprintf("%d of %d files failed", result.Failed, len(result.Files))
+	}
+
+	return response
+}
+
+// keyWrapFlags are shared by aes-wrap-key and aes-unwrap-key.
+func keyWrapFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "pad",
+			Usage: "use the RFC 5649 key wrap with padding, for keys of any length",
+		},
+	}
+}
+
+func keyWrapAlgorithm(pad bool) string {
+	if pad {
+		return "rfc5649"
+	}
+	return "rfc3394"
+}
+
+// macFlags are shared by mac and mac-verify.
+func macFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "in",
+			Usage: "read the message from `FILE` instead of the argument, - for stdin",
+		},
+	}
+}
+
+// macMessage computes the CMAC of the --in file, or of message if --in is
+// not set.
+func macMessage(dev enigma.Device, cmd *cli.Command, message string) (*enigma.CMAC, error) {
+	c, err := enigma.NewCMAC(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cmd.IsSet("in") {
+		_, err := c.Write([]byte(message))
+		return c, err
+	}
+
+	in := io.ReadCloser(os.Stdin)
+	if path := streamPath(cmd, "in"); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		in = f
+	}
+	defer in.Close()
+
+	if _, err := io.Copy(c, in); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// imageFlags are shared by aes-encrypt-image and aes-decrypt-image.
+func imageFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "progress",
+			Usage: "report progress on stderr",
+		},
+	}
+}
+
+func imageResponse(result *enigma.ImageResult, err error) *types.EnigmaResponse {
+	if err != nil {
+		return &types.EnigmaResponse{
+			Status:  "error",
+			Message: err.Error(),
+			Data:    nil,
+		}
+	}
+
+	return &types.EnigmaResponse{
+		Status:  "success",
+		Message: enigma.GetCodeMessage(0),
+		Data:    result,
+	}
+}
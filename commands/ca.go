@@ -0,0 +1,556 @@
+package commands
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func CA() *cli.Command {
+	return &cli.Command{
+		Name: "ca",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "db",
+				Usage:   "CA database `FILE` recording the CA certificate and everything it issues",
+				Value:   defaultCADatabase(),
+				Sources: cli.EnvVars("ENIGMA_CA"),
+			},
+		},
+		Commands: []*cli.Command{
+			caInit(),
+			caSign(),
+			caRevoke(),
+			caCRL(),
+			caList(),
+		},
+	}
+}
+
+func defaultCADatabase() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "ca.json"
+	}
+	return filepath.Join(dir, "enigma", "ca.json")
+}
+
+func caInit() *cli.Command {
+	return &cli.Command{
+		Name:      "init",
+		ArgsUsage: "<key-id>",
+		Flags: slices.Concat([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "subject",
+				Usage: "subject `DN` of the root certificate, such as \"CN=Test Root,O=Example\"",
+			},
+			&cli.IntFlag{
+				Name:  "days",
+				Usage: "validity of the root certificate in `DAYS`",
+				Value: 3650,
+			},
+			&cli.IntFlag{
+				Name:  "path-len",
+				Usage: "levels of intermediate CAs allowed below the root, -1 for no limit",
+				Value: -1,
+			},
+			&cli.StringFlag{
+				Name:  "cert",
+				Usage: "use the CA certificate in `FILE`, such as an intermediate from another CA, instead of creating a root",
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "write the PEM certificate to `FILE` instead of JSON",
+			},
+		}, signerFlags()),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyID := cmd.Args().Get(0)
+			if keyID == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Key ID is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			signer, err := deviceSigner(enigmaContext, cmd, keyID)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			ca := enigma.NewCA(cmd.String("db"))
+
+			cert, err := initCA(cmd, ca, signer)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			data, err := certificateData(cmd, cert)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+			data["key_id"] = keyID
+			data["db"] = cmd.String("db")
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    data,
+			}
+
+			return nil
+		},
+	}
+}
+
+func caSign() *cli.Command {
+	return &cli.Command{
+		Name:      "sign",
+		ArgsUsage: "<csr-file>",
+		Flags: slices.Concat([]cli.Flag{
+			&cli.IntFlag{
+				Name:  "days",
+				Usage: "validity in `DAYS`, ending no later than the CA certificate",
+				Value: 365,
+			},
+			&cli.BoolFlag{
+				Name:  "is-ca",
+				Usage: "issue an intermediate CA certificate",
+			},
+			&cli.IntFlag{
+				Name:  "path-len",
+				Usage: "levels of CAs the intermediate may issue below it, -1 for one less than the CA allows",
+				Value: -1,
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "write the PEM certificate to `FILE` instead of JSON",
+			},
+		}, sanFlags(), usageFlags()),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			csrPath := cmd.Args().Get(0)
+			if csrPath == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "CSR file is required as an argument, - for stdin",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			csr, err := readCertificateRequest(csrPath)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			opts, err := issueOptions(cmd)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			cert, err := enigma.NewCA(cmd.String("db")).Sign(enigmaContext.Device, csr, opts)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			data, err := certificateData(cmd, cert)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    data,
+			}
+
+			return nil
+		},
+	}
+}
+
+func caRevoke() *cli.Command {
+	return &cli.Command{
+		Name:      "revoke",
+		ArgsUsage: "<serial>",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "reason",
+				Usage: "RFC 5280 revocation reason, such as keyCompromise or superseded",
+				Value: "unspecified",
+			},
+		}, crlFlags()...),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			serial, ok := parseSerial(cmd.Args().Get(0))
+			if !ok {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Serial number in hex is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			reason, err := enigma.ParseRevocationReason(cmd.String("reason"))
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			ca := enigma.NewCA(cmd.String("db"))
+
+			revoked, err := ca.Revoke(serial, reason)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			data, err := crlData(enigmaContext, cmd, ca)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: fmt.Sprintf("%s revoked, but the CRL was not created: %v", revoked.Serial, err),
+					Data:    nil,
+				}
+				return nil
+			}
+			data["serial"] = revoked.Serial
+			data["subject"] = revoked.Subject
+			data["revoked_at"] = revoked.RevokedAt
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    data,
+			}
+
+			return nil
+		},
+	}
+}
+
+func caCRL() *cli.Command {
+	return &cli.Command{
+		Name:  "crl",
+		Flags: crlFlags(),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			data, err := crlData(enigmaContext, cmd, enigma.NewCA(cmd.String("db")))
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    data,
+			}
+
+			return nil
+		},
+	}
+}
+
+func caList() *cli.Command {
+	return &cli.Command{
+		Name: "list",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			issued, err := enigma.NewCA(cmd.String("db")).Issued()
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			certificates := make([]map[string]any, len(issued))
+			for i, cert := range issued {
+				certificates[i] = map[string]any{
+					"serial":     cert.Serial,
+					"subject":    cert.Subject,
+					"not_before": cert.NotBefore,
+					"not_after":  cert.NotAfter,
+					"is_ca":      cert.IsCA,
+				}
+				if cert.RevokedAt != nil {
+					certificates[i]["revoked_at"] = cert.RevokedAt
+					certificates[i]["reason"] = cert.Reason
+				}
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data: map[string]any{
+					"certificates": certificates,
+				},
+			}
+
+			return nil
+		},
+	}
+}
+
+// initCA creates a root for ca init, or adopts the --cert certificate.
+func initCA(cmd *cli.Command, ca *enigma.CA, signer *enigma.RSASigner) (*x509.Certificate, error) {
+	if cmd.IsSet("cert") {
+		cert, err := readCertificate(cmd.String("cert"))
+		if err != nil {
+			return nil, err
+		}
+		return ca.InitWithCertificate(signer, cert)
+	}
+
+	dn := cmd.String("subject")
+	if dn == "" {
+		return nil, fmt.Errorf("--subject or --cert is required")
+	}
+	subject, err := enigma.ParseName(dn)
+	if err != nil {
+		return nil, err
+	}
+
+	return ca.Init(signer, subject, days(cmd, "days"), int(cmd.Int("path-len")))
+}
+
+// crlFlags are shared by ca revoke and ca crl.
+func crlFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "crl-days",
+			Usage: "days until the next CRL update",
+			Value: 7,
+		},
+		&cli.StringFlag{
+			Name:  "out",
+			Usage: "write the PEM CRL to `FILE` instead of JSON",
+		},
+	}
+}
+
+// issueOptions reads the ca sign flags.
+func issueOptions(cmd *cli.Command) (enigma.IssueOptions, error) {
+	opts := enigma.IssueOptions{
+		Validity:   days(cmd, "days"),
+		IsCA:       cmd.Bool("is-ca"),
+		MaxPathLen: int(cmd.Int("path-len")),
+	}
+
+	sans, err := readSANs(cmd)
+	if err != nil {
+		return opts, err
+	}
+	if !sans.empty() {
+		opts.DNSNames = sans.dnsNames
+		opts.IPAddresses = sans.ipAddresses
+		opts.EmailAddresses = sans.emailAddresses
+		opts.URIs = sans.uris
+	}
+
+	opts.KeyUsage, opts.ExtKeyUsage, err = readUsages(cmd)
+	return opts, err
+}
+
+func days(cmd *cli.Command, name string) time.Duration {
+	return time.Duration(cmd.Int(name)) * 24 * time.Hour
+}
+
+// crlData creates a CRL and returns it for output, writing it to --out if
+// set.
+func crlData(enigmaContext *types.EnigmaContext, cmd *cli.Command, ca *enigma.CA) (map[string]any, error) {
+	der, err := ca.CRL(enigmaContext.Device, days(cmd, "crl-days"))
+	if err != nil {
+		return nil, err
+	}
+
+	crl, err := x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]any{
+		"crl_number":  crl.Number.String(),
+		"revoked":     len(crl.RevokedCertificateEntries),
+		"next_update": crl.NextUpdate,
+	}
+
+	if err := pemOutput(cmd, data, "crl", "X509 CRL", der); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// certificateData returns a certificate for output, writing it to --out if
+// set.
+func certificateData(cmd *cli.Command, cert *x509.Certificate) (map[string]any, error) {
+	data := map[string]any{
+		"serial":    cert.SerialNumber.Text(16),
+		"subject":   cert.Subject.String(),
+		"issuer":    cert.Issuer.String(),
+		"not_after": cert.NotAfter,
+		"is_ca":     cert.IsCA,
+	}
+
+	if err := pemOutput(cmd, data, "certificate", "CERTIFICATE", cert.Raw); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// pemOutput writes der as PEM to the --out file and records its path in
+// data, or puts the PEM in data under key.
+func pemOutput(cmd *cli.Command, data map[string]any, key, blockType string, der []byte) error {
+	encoded := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+
+	if outPath := cmd.String("out"); outPath != "" {
+		if err := os.WriteFile(outPath, encoded, 0644); err != nil {
+			return err
+		}
+		data["output"] = outPath
+		return nil
+	}
+
+	data[key] = string(encoded)
+	return nil
+}
+
+// readDER reads a PEM block of blockType, or DER, from path, "-" meaning
+// stdin.
+func readDER(path, blockType string) ([]byte, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != blockType {
+			return nil, fmt.Errorf("PEM block %q is not a %s", block.Type, strings.ToLower(blockType))
+		}
+		return block.Bytes, nil
+	}
+	return data, nil
+}
+
+func readCertificateRequest(path string) (*x509.CertificateRequest, error) {
+	der, err := readDER(path, "CERTIFICATE REQUEST")
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificateRequest(der)
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	der, err := readDER(path, "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// parseSerial parses a serial number in hex, with optional colons as
+// OpenSSL prints them.
+func parseSerial(s string) (*big.Int, bool) {
+	s = strings.ReplaceAll(strings.TrimPrefix(strings.ToLower(s), "0x"), ":", "")
+	if s == "" {
+		return nil, false
+	}
+	return new(big.Int).SetString(s, 16)
+}
@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -35,7 +33,7 @@ func ChangePin() *cli.Command {
 				return nil
 			}
 
-			res, err := enigma.ChangePin(enigmaContext.DLL, oldPin, newPin)
+			res, err := enigma.ChangePin(enigmaContext.Device, oldPin, newPin)
 
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
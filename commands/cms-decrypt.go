@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func CMSDecrypt() *cli.Command {
+	return &cli.Command{
+		Name:      "cms-decrypt",
+		ArgsUsage: "<key-id> <file>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "cert",
+				Usage: "only try the recipient named by the certificate of the key in `FILE`",
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "write the plaintext to `FILE` instead of JSON",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyID := cmd.Args().Get(0)
+			inPath := cmd.Args().Get(1)
+			if keyID == "" || inPath == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Key ID and file are required as arguments",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			recipient := enigma.CMSRecipient{KeyID: keyID}
+			if certPath := cmd.String("cert"); certPath != "" {
+				cert, err := readCertificate(certPath)
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+				recipient.Certificate = cert
+			}
+
+			der, err := readDER(inPath, "CMS")
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			plaintext, err := enigma.DecryptCMS(enigmaContext.Device, recipient, der)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			outPath := cmd.String("out")
+			if outPath == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "success",
+					Message: enigma.GetCodeMessage(0),
+					Data:    string(plaintext),
+				}
+				return nil
+			}
+
+			if err := os.WriteFile(outPath, plaintext, 0600); err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data: map[string]any{
+					"output":          outPath,
+					"plaintext_bytes": len(plaintext),
+				},
+			}
+
+			return nil
+		},
+	}
+}
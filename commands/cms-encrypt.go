@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func CMSEncrypt() *cli.Command {
+	return &cli.Command{
+		Name:      "cms-encrypt",
+		ArgsUsage: "<key-id> <file>",
+		Flags: slices.Concat([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "cert",
+				Usage: "name the recipient by the certificate of the key in `FILE` instead of by subject key ID",
+			},
+		}, cmsOutputFlags(), signerFlags()),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyID := cmd.Args().Get(0)
+			inPath := cmd.Args().Get(1)
+			if keyID == "" || inPath == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Key ID and file are required as arguments",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			recipient := enigma.CMSRecipient{KeyID: keyID}
+			var err error
+			if certPath := cmd.String("cert"); certPath != "" {
+				recipient.Certificate, err = readCertificate(certPath)
+			} else {
+				recipient.PublicKey, err = devicePublicKey(enigmaContext, cmd, keyID)
+			}
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			content, err := readInput(inPath)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			der, err := enigma.EncryptCMS(enigmaContext.Device, content, recipient)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			data := map[string]any{
+				"key_id":          keyID,
+				"plaintext_bytes": len(content),
+			}
+			if recipient.Certificate != nil {
+				data["recipient"] = recipient.Certificate.Subject.String()
+			}
+			if err := cmsOutput(cmd, data, der); err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    data,
+			}
+
+			return nil
+		},
+	}
+}
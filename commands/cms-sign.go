@@ -0,0 +1,209 @@
+package commands
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func CMSSign() *cli.Command {
+	return &cli.Command{
+		Name:      "cms-sign",
+		ArgsUsage: "<key-id> <file>",
+		Flags: slices.Concat([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "cert",
+				Usage: "certificate of the key in `FILE`, PEM or DER",
+			},
+			&cli.StringFlag{
+				Name:  "chain",
+				Usage: "also include the PEM certificates in `FILE`, such as intermediates",
+			},
+			&cli.BoolFlag{
+				Name:  "detached",
+				Usage: "leave the content out of the signature",
+			},
+		}, cmsOutputFlags(), signerFlags()),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyID := cmd.Args().Get(0)
+			inPath := cmd.Args().Get(1)
+			if keyID == "" || inPath == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Key ID and file are required as arguments",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			if cmd.String("cert") == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "--cert is required",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			cert, err := readCertificate(cmd.String("cert"))
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			opts := enigma.CMSSignOptions{
+				Detached:    cmd.Bool("detached"),
+				SigningTime: time.Now().UTC().Truncate(time.Second),
+			}
+			if chainPath := cmd.String("chain"); chainPath != "" {
+				opts.Certificates, err = readCertificateChain(chainPath)
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+			}
+
+			content, err := readInput(inPath)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			signer, err := deviceSigner(enigmaContext, cmd, keyID)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			der, err := enigma.SignCMS(signer, cert, content, opts)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			data := map[string]any{
+				"key_id":       keyID,
+				"signer":       cert.Subject.String(),
+				"detached":     opts.Detached,
+				"signing_time": opts.SigningTime,
+				"size":         len(content),
+			}
+			if err := cmsOutput(cmd, data, der); err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    data,
+			}
+
+			return nil
+		},
+	}
+}
+
+// cmsOutputFlags select where cms-sign and cms-encrypt write the
+// ContentInfo.
+func cmsOutputFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "out",
+			Usage: "write the CMS structure to `FILE` instead of JSON",
+		},
+		&cli.BoolFlag{
+			Name:  "der",
+			Usage: "write DER instead of PEM to --out",
+		},
+	}
+}
+
+// cmsOutput stores der in data as PEM, or writes it to --out as PEM or DER.
+func cmsOutput(cmd *cli.Command, data map[string]any, der []byte) error {
+	if !cmd.Bool("der") {
+		return pemOutput(cmd, data, "cms", "CMS", der)
+	}
+
+	outPath := cmd.String("out")
+	if outPath == "" {
+		return fmt.Errorf("--der requires --out")
+	}
+	if err := os.WriteFile(outPath, der, 0644); err != nil {
+		return err
+	}
+	data["output"] = outPath
+	return nil
+}
+
+// readInput reads all of path, "-" meaning stdin.
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// readCertificateChain reads every PEM certificate in path.
+func readCertificateChain(path string) ([]*x509.Certificate, error) {
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+
+	return certs, nil
+}
@@ -0,0 +1,230 @@
+package commands
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func CSR() *cli.Command {
+	return &cli.Command{
+		Name:      "csr",
+		ArgsUsage: "<key-id>",
+		Flags: slices.Concat([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "subject",
+				Usage: "subject `DN`, such as \"CN=build server,O=Example,C=TW\"",
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "write the PEM request to `FILE` instead of JSON",
+			},
+		}, sanFlags(), usageFlags(), signerFlags()),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyID := cmd.Args().Get(0)
+			if keyID == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Key ID is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			template, err := requestTemplate(cmd)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			signer, err := deviceSigner(enigmaContext, cmd, keyID)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			der, err := enigma.CreateCertificateRequest(signer, template)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			request := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+
+			data := map[string]any{
+				"key_id":  keyID,
+				"subject": template.Subject.String(),
+			}
+
+			if outPath := cmd.String("out"); outPath != "" {
+				if err := os.WriteFile(outPath, request, 0644); err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+				data["output"] = outPath
+			} else {
+				data["csr"] = string(request)
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    data,
+			}
+
+			return nil
+		},
+	}
+}
+
+// sanFlags add subject alternative names to a request or certificate.
+func sanFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "dns",
+			Usage: "DNS name to include as a SAN",
+		},
+		&cli.StringSliceFlag{
+			Name:  "ip",
+			Usage: "IP address to include as a SAN",
+		},
+		&cli.StringSliceFlag{
+			Name:  "email",
+			Usage: "email address to include as a SAN",
+		},
+		&cli.StringSliceFlag{
+			Name:  "uri",
+			Usage: "URI to include as a SAN",
+		},
+	}
+}
+
+// usageFlags set the key usages of a request or certificate.
+func usageFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "key-usage",
+			Usage: "key usage, such as digitalSignature or keyEncipherment",
+		},
+		&cli.StringSliceFlag{
+			Name:  "ext-key-usage",
+			Usage: "extended key usage, such as serverAuth or clientAuth",
+		},
+	}
+}
+
+// subjectAltNames are the SANs given with sanFlags.
+type subjectAltNames struct {
+	dnsNames       []string
+	ipAddresses    []net.IP
+	emailAddresses []string
+	uris           []*url.URL
+}
+
+func (s subjectAltNames) empty() bool {
+	return len(s.dnsNames) == 0 && len(s.ipAddresses) == 0 && len(s.emailAddresses) == 0 && len(s.uris) == 0
+}
+
+func readSANs(cmd *cli.Command) (subjectAltNames, error) {
+	sans := subjectAltNames{
+		dnsNames:       cmd.StringSlice("dns"),
+		emailAddresses: cmd.StringSlice("email"),
+	}
+
+	for _, s := range cmd.StringSlice("ip") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return sans, fmt.Errorf("invalid IP address %q", s)
+		}
+		sans.ipAddresses = append(sans.ipAddresses, ip)
+	}
+
+	for _, s := range cmd.StringSlice("uri") {
+		uri, err := url.Parse(s)
+		if err != nil || uri.Scheme == "" {
+			return sans, fmt.Errorf("invalid URI %q", s)
+		}
+		sans.uris = append(sans.uris, uri)
+	}
+
+	return sans, nil
+}
+
+func readUsages(cmd *cli.Command) (x509.KeyUsage, []x509.ExtKeyUsage, error) {
+	usage, err := enigma.ParseKeyUsage(cmd.StringSlice("key-usage"))
+	if err != nil {
+		return 0, nil, err
+	}
+	extUsages, err := enigma.ParseExtKeyUsage(cmd.StringSlice("ext-key-usage"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return usage, extUsages, nil
+}
+
+// requestTemplate builds the certificate request the csr flags describe.
+func requestTemplate(cmd *cli.Command) (*x509.CertificateRequest, error) {
+	sans, err := readSANs(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.CertificateRequest{
+		DNSNames:       sans.dnsNames,
+		IPAddresses:    sans.ipAddresses,
+		EmailAddresses: sans.emailAddresses,
+		URIs:           sans.uris,
+	}
+
+	if dn := cmd.String("subject"); dn != "" {
+		subject, err := enigma.ParseName(dn)
+		if err != nil {
+			return nil, err
+		}
+		template.Subject = subject
+	} else if sans.empty() {
+		return nil, fmt.Errorf("--subject or at least one SAN is required")
+	}
+
+	usage, extUsages, err := readUsages(cmd)
+	if err != nil {
+		return nil, err
+	}
+	template.ExtraExtensions, err = enigma.KeyUsageExtensions(usage, extUsages)
+	if err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -33,7 +31,7 @@ func DeleteKey() *cli.Command {
 				return nil
 			}
 
-			res, err := enigma.DeleteKey(enigmaContext.DLL, keyID)
+			res, err := enigma.DeleteKey(enigmaContext.Device, keyID)
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
@@ -43,6 +41,15 @@ func DeleteKey() *cli.Command {
 				return nil
 			}
 
+			if err := enigmaContext.KeyRing.Forget(enigmaContext.Device, keyID); err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "key deleted, but not removed from the key ring: " + err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
 			enigmaContext.Result = &types.EnigmaResponse{
 				Status:  "success",
 				Message: enigma.GetCodeMessage(0),
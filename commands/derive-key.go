@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func DeriveKey() *cli.Command {
+	return &cli.Command{
+		Name:      "derive-key",
+		ArgsUsage: "<label> [context]",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "length",
+				Usage: "derived key length in `BYTES`",
+				Value: 32,
+			},
+			&cli.StringFlag{
+				Name:  "encoding",
+				Usage: "output encoding: hex or base64",
+				Value: "hex",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			label := cmd.Args().Get(0)
+			keyContext := cmd.Args().Get(1)
+
+			if label == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Label is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			var encode func([]byte) string
+			switch encoding := cmd.String("encoding"); encoding {
+			case "hex":
+				encode = hex.EncodeToString
+			case "base64":
+				encode = base64.StdEncoding.EncodeToString
+			default:
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: fmt.Sprintf("unknown encoding %q, expected hex or base64", encoding),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			length := int(cmd.Int("length"))
+			key, err := enigma.DeriveKey(enigmaContext.Device, []byte(label), []byte(keyContext), length)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data: map[string]any{
+					"label":   label,
+					"context": keyContext,
+					"length":  length,
+					"key":     encode(key),
+				},
+			}
+
+			return nil
+		},
+	}
+}
@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -22,7 +20,7 @@ func DetectDevice() *cli.Command {
 				os.Exit(1)
 			}
 
-			res, err := enigma.Detect(enigmaContext.DLL)
+			res, err := enigma.Detect(enigmaContext.Device)
 
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func ExportPublicKey() *cli.Command {
+	return &cli.Command{
+		Name:      "export-public-key",
+		ArgsUsage: "<key-id>",
+		Flags:     publicKeyFlags(),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyID := cmd.Args().Get(0)
+			if keyID == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Key ID is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			format := cmd.String("format")
+			if cmd.IsSet("out") && format == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "--out needs --format",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			pub, err := devicePublicKey(enigmaContext, cmd, keyID)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			export, err := enigma.ExportPublicKey(keyID, pub)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			if format == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "success",
+					Message: enigma.GetCodeMessage(0),
+					Data:    export,
+				}
+				return nil
+			}
+
+			data := map[string]any{
+				"key_id":       keyID,
+				"format":       format,
+				"fingerprints": export.Fingerprints,
+			}
+
+			if outPath := cmd.String("out"); outPath != "" {
+				encoded, err := encodePublicKey(export, format)
+				if err == nil {
+					err = os.WriteFile(outPath, encoded, 0644)
+				}
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+				data["output"] = outPath
+			} else {
+				text, err := publicKeyText(export, format)
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+				data["public_key"] = text
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    data,
+			}
+
+			return nil
+		},
+	}
+}
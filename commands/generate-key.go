@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -33,7 +31,7 @@ func GenerateKey() *cli.Command {
 				return nil
 			}
 
-			res, keyID, pubKeyN, pubKeyE, err := enigma.GenerateKey(enigmaContext.DLL, customID)
+			res, keyID, pubKeyN, pubKeyE, err := enigma.GenerateKey(enigmaContext.Device, customID)
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
@@ -53,6 +51,16 @@ func GenerateKey() *cli.Command {
 				},
 			}
 
+			// The device cannot return the public key again later
+			pub, err := enigma.PublicKeyFromBase64(pubKeyN, pubKeyE)
+			if err == nil {
+				err = rememberPublicKey(enigmaContext, keyID, pub)
+			}
+			if err != nil {
+				enigmaContext.Result.Status = "error"
+				enigmaContext.Result.Message = err.Error()
+			}
+
 			return nil
 		},
 	}
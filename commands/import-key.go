@@ -1,9 +1,8 @@
-//go:build windows
-
 package commands
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
 	"os"
 
@@ -16,6 +15,7 @@ func ImportKey() *cli.Command {
 	return &cli.Command{
 		Name:      "import-key",
 		ArgsUsage: "<custom-id> <public-key-n> <public-key-e>",
+		Flags:     keyFileFlags(),
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
 			if !ok {
@@ -27,17 +27,33 @@ func ImportKey() *cli.Command {
 			pubKeyN := cmd.Args().Get(1)
 			pubKeyE := cmd.Args().Get(2)
 
-			if customID == "" || pubKeyN == "" || pubKeyE == "" {
+			if customID == "" || !cmd.IsSet("key") && (pubKeyN == "" || pubKeyE == "") {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Custom ID, public key N and public key E are required as arguments, or custom ID and --key",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			var pub *rsa.PublicKey
+			var err error
+			if cmd.IsSet("key") {
+				pub, err = readPublicKey(cmd)
+			} else {
+				pub, err = enigma.PublicKeyFromBase64(pubKeyN, pubKeyE)
+			}
+			if err != nil {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
-					Message: "Custom ID, public key N and public key E are required as arguments",
+					Message: err.Error(),
 					Data:    nil,
 				}
 				return nil
 			}
 
-			res, keyID, err := enigma.ImportKey(enigmaContext.DLL, customID, pubKeyN, pubKeyE)
-			if !res {
+			keyID, err := enigma.ImportRSAPublicKey(enigmaContext.Device, customID, pub)
+			if err != nil {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
 					Message: err.Error(),
@@ -54,6 +70,11 @@ func ImportKey() *cli.Command {
 				},
 			}
 
+			if err := rememberPublicKey(enigmaContext, keyID, pub); err != nil {
+				enigmaContext.Result.Status = "error"
+				enigmaContext.Result.Message = err.Error()
+			}
+
 			return nil
 		},
 	}
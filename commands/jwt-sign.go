@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func JWTSign() *cli.Command {
+	return &cli.Command{
+		Name:      "jwt-sign",
+		ArgsUsage: "<key-id>",
+		Flags: slices.Concat([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "claims",
+				Usage: "read the claims JSON object from `FILE`, - for stdin",
+			},
+			&cli.StringFlag{
+				Name:  "iss",
+				Usage: "issuer claim",
+			},
+			&cli.StringFlag{
+				Name:  "sub",
+				Usage: "subject claim",
+			},
+			&cli.StringSliceFlag{
+				Name:  "aud",
+				Usage: "audience claim, repeated for several audiences",
+			},
+			&cli.DurationFlag{
+				Name:  "exp",
+				Usage: "expire the token after `DURATION`, such as 15m",
+			},
+			&cli.DurationFlag{
+				Name:  "nbf",
+				Usage: "make the token valid only after `DURATION` from now, 0s for now",
+			},
+			&cli.StringFlag{
+				Name:  "alg",
+				Usage: "signature algorithm, only RS256 since the device signs with SHA-256",
+				Value: enigma.JWTAlgRS256,
+			},
+		}, signerFlags()),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyID := cmd.Args().Get(0)
+			if keyID == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Key ID is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			if alg := cmd.String("alg"); alg != enigma.JWTAlgRS256 {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: fmt.Sprintf("%v: the device signs with SHA-256, so only RS256 is available, not %q", enigma.ErrJWTAlgorithm, alg),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			claims, err := jwtClaims(cmd, time.Now())
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			signer, err := deviceSigner(enigmaContext, cmd, keyID)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			token, err := enigma.SignJWT(signer, claims)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data: map[string]any{
+					"token": token,
+					"alg":   enigma.JWTAlgRS256,
+					"kid":   keyID,
+				},
+			}
+
+			return nil
+		},
+	}
+}
+
+// jwtClaims reads the --claims object, if any, and sets the claims given
+// with flags, with iat set to now unless present.
+func jwtClaims(cmd *cli.Command, now time.Time) ([]byte, error) {
+	claims := map[string]any{}
+
+	if path := cmd.String("claims"); path != "" {
+		var data []byte
+		var err error
+		if path == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&claims); err != nil || claims == nil {
+			return nil, fmt.Errorf("%s: claims must be a JSON object", path)
+		}
+	}
+
+	if _, ok := claims["iat"]; !ok {
+		claims["iat"] = now.Unix()
+	}
+	if cmd.IsSet("iss") {
+		claims["iss"] = cmd.String("iss")
+	}
+	if cmd.IsSet("sub") {
+		claims["sub"] = cmd.String("sub")
+	}
+	if aud := cmd.StringSlice("aud"); len(aud) == 1 {
+		claims["aud"] = aud[0]
+	} else if len(aud) > 1 {
+		claims["aud"] = aud
+	}
+	if cmd.IsSet("exp") {
+		claims["exp"] = now.Add(cmd.Duration("exp")).Unix()
+	}
+	if cmd.IsSet("nbf") {
+		claims["nbf"] = now.Add(cmd.Duration("nbf")).Unix()
+	}
+
+	return json.Marshal(claims)
+}
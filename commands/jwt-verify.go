@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func JWTVerify() *cli.Command {
+	return &cli.Command{
+		Name:      "jwt-verify",
+		ArgsUsage: "<token>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "pubkey",
+				Usage: "verify in software with the public key in `FILE` instead of on the device, which also accepts RS384 and RS512",
+			},
+			&cli.StringFlag{
+				Name:  "key-id",
+				Usage: "verify on the device with this key instead of the kid header",
+			},
+			&cli.StringFlag{
+				Name:  "iss",
+				Usage: "require this issuer claim",
+			},
+			&cli.StringFlag{
+				Name:  "aud",
+				Usage: "require this audience in the audience claim",
+			},
+			&cli.DurationFlag{
+				Name:  "leeway",
+				Usage: "allow `DURATION` of clock skew for exp and nbf",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			token := cmd.Args().Get(0)
+			if token == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Token is required as an argument, - for stdin",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			if token == "-" {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+				token = string(data)
+			}
+
+			jwt, err := enigma.ParseJWT(token)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			mode, isValid, err := verifyJWT(enigmaContext, cmd, jwt)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			data := map[string]any{
+				"valid":       isValid,
+				"verified_by": mode,
+				"alg":         jwt.Header.Algorithm,
+				"kid":         jwt.Header.KeyID,
+			}
+
+			if isValid {
+				err := jwt.ValidateClaims(time.Now(), cmd.Duration("leeway"), cmd.String("iss"), cmd.String("aud"))
+				if errors.Is(err, enigma.ErrJWTClaims) {
+					data["valid"] = false
+					data["reason"] = err.Error()
+				} else if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+				data["claims"] = jwt.Claims
+			} else {
+				data["reason"] = "signature does not verify"
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    data,
+			}
+
+			return nil
+		},
+	}
+}
+
+// verifyJWT checks the signature of jwt in software with --pubkey or else
+// on the device, and reports which.
+func verifyJWT(enigmaContext *types.EnigmaContext, cmd *cli.Command, jwt *enigma.JWT) (string, bool, error) {
+	if cmd.IsSet("pubkey") {
+		data, err := os.ReadFile(cmd.String("pubkey"))
+		if err != nil {
+			return "", false, err
+		}
+		pub, err := enigma.ParsePublicKey(data)
+		if err != nil {
+			return "", false, err
+		}
+
+		isValid, err := jwt.Verify(pub)
+		return "software", isValid, err
+	}
+
+	keyID := jwt.Header.KeyID
+	if cmd.IsSet("key-id") {
+		keyID = cmd.String("key-id")
+	}
+	if keyID == "" {
+		return "", false, fmt.Errorf("the token has no kid header, use --key-id or --pubkey")
+	}
+
+	isValid, err := jwt.VerifyOnDevice(enigmaContext.Device, keyID)
+	return "device", isValid, err
+}
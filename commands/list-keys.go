@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -22,7 +20,7 @@ func ListKeys() *cli.Command {
 				os.Exit(1)
 			}
 
-			res, keyCount, keyIDList, customIDList, err := enigma.ListKeys(enigmaContext.DLL)
+			res, keyCount, keyIDList, customIDList, err := enigma.ListKeys(enigmaContext.Device)
 
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -22,7 +20,7 @@ func LoginStatus() *cli.Command {
 				os.Exit(1)
 			}
 
-			res, retryCount, isValid, err := enigma.LoginStatus(enigmaContext.DLL)
+			res, retryCount, isValid, err := enigma.LoginStatus(enigmaContext.Device)
 
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
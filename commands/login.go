@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -33,7 +31,7 @@ func Login() *cli.Command {
 				return nil
 			}
 
-			res, err := enigma.Login(enigmaContext.DLL, pin)
+			res, err := enigma.Login(enigmaContext.Device, pin)
 
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
@@ -0,0 +1,82 @@
+package commands
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func MACVerify() *cli.Command {
+	return &cli.Command{
+		Name:      "mac-verify",
+		ArgsUsage: "<message> <mac-hex>, or --in <file> <mac-hex>",
+		Flags:     macFlags(),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			var message, macHex string
+			if cmd.IsSet("in") {
+				macHex = cmd.Args().Get(0)
+			} else {
+				message = cmd.Args().Get(0)
+				macHex = cmd.Args().Get(1)
+			}
+
+			if macHex == "" || (message == "" && !cmd.IsSet("in")) {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Message and MAC are required as arguments",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			mac, err := hex.DecodeString(macHex)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Invalid hex encoding: " + err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			c, err := macMessage(enigmaContext.Device, cmd, message)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			isValid, err := c.Verify(mac)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    isValid,
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func MAC() *cli.Command {
+	return &cli.Command{
+		Name:      "mac",
+		ArgsUsage: "<message>",
+		Flags:     macFlags(),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			message := cmd.Args().Get(0)
+			if message == "" && !cmd.IsSet("in") {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Message is required as an argument or with --in",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			c, err := macMessage(enigmaContext.Device, cmd, message)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			mac, err := c.MAC()
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    hex.EncodeToString(mac),
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func Open() *cli.Command {
+	return &cli.Command{
+		Name:      "open",
+		ArgsUsage: "<key-id> <base64-envelope>",
+		Flags:     streamFlags(),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyID := cmd.Args().Get(0)
+			if keyID == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Key ID is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			if isStreaming(cmd) {
+				outPath := streamPath(cmd, "out")
+				n, err := streamFiles(streamPath(cmd, "in"), outPath, func(dst io.Writer, src io.Reader) (int64, error) {
+					r, err := enigma.NewRSAOpenReader(enigmaContext.Device, keyID, src)
+					if err != nil {
+						return 0, err
+					}
+					return io.Copy(dst, r)
+				})
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+
+				// Keep stdout clean when it carries the stream
+				if outPath != "-" {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "success",
+						Message: enigma.GetCodeMessage(0),
+						Data: map[string]any{
+							"output":          outPath,
+							"plaintext_bytes": n,
+						},
+					}
+				}
+				return nil
+			}
+
+			base64Envelope := cmd.Args().Get(1)
+			if base64Envelope == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Base64 encoded envelope is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			envelope, err := base64.StdEncoding.DecodeString(base64Envelope)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			plaintext, err := enigma.RSAOpen(enigmaContext.Device, keyID, envelope)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    string(plaintext),
+			}
+
+			return nil
+		},
+	}
+}
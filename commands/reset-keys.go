@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -22,7 +20,7 @@ func ResetKeys() *cli.Command {
 				os.Exit(1)
 			}
 
-			res, err := enigma.ResetKeys(enigmaContext.DLL)
+			res, err := enigma.ResetKeys(enigmaContext.Device)
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
@@ -32,6 +30,15 @@ func ResetKeys() *cli.Command {
 				return nil
 			}
 
+			if err := enigmaContext.KeyRing.ForgetAll(enigmaContext.Device); err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "keys reset, but not removed from the key ring: " + err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
 			enigmaContext.Result = &types.EnigmaResponse{
 				Status:  "success",
 				Message: enigma.GetCodeMessage(0),
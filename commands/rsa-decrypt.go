@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -35,7 +33,7 @@ func RSADecrypt() *cli.Command {
 				return nil
 			}
 
-			res, decryptedMessage, err := enigma.RSADecrypt(enigmaContext.DLL, keyID, cipher)
+			res, decryptedMessage, err := enigma.RSADecrypt(enigmaContext.Device, keyID, cipher)
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
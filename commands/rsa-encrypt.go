@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -35,7 +33,7 @@ func RSAEncrypt() *cli.Command {
 				return nil
 			}
 
-			res, encryptedMessage, err := enigma.RSAEncrypt(enigmaContext.DLL, keyID, message)
+			res, encryptedMessage, err := enigma.RSAEncrypt(enigmaContext.Device, keyID, message)
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
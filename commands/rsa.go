@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+// rememberPublicKey keeps the public key of a generated or imported key in
+// the key ring, so export-public-key can find it later.
+func rememberPublicKey(enigmaContext *types.EnigmaContext, keyID string, pub *rsa.PublicKey) error {
+	if err := enigmaContext.KeyRing.Remember(enigmaContext.Device, keyID, pub); err != nil {
+		return fmt.Errorf("key %s stored, but its public key was not remembered: %w", keyID, err)
+	}
+	return nil
+}
+
+// keyFileFlags let import-key and set-trans-key read a key file.
+func keyFileFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "key",
+			Usage: "read the public key from `FILE` instead of the arguments, - for stdin: PEM or DER public key, PKCS#1 or certificate, JWK or OpenSSH",
+		},
+	}
+}
+
+// readPublicKey parses the public key in the --key file.
+func readPublicKey(cmd *cli.Command) (*rsa.PublicKey, error) {
+	var data []byte
+	var err error
+	if path := streamPath(cmd, "key"); path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return enigma.ParsePublicKey(data)
+}
+
+// publicKeyFlags select the key export-public-key converts.
+func publicKeyFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output only one format: pem, der, pkcs1, jwk or openssh",
+		},
+		&cli.StringFlag{
+			Name:  "out",
+			Usage: "write the --format output to `FILE` instead of JSON",
+		},
+		&cli.StringFlag{
+			Name:  "n",
+			Usage: "base64 modulus from generate-key, for keys not in the key ring",
+		},
+		&cli.StringFlag{
+			Name:  "e",
+			Usage: "base64 exponent from generate-key, for keys not in the key ring",
+		},
+	}
+}
+
+// encodePublicKey returns one format of an export, DER as raw bytes.
+func encodePublicKey(export *enigma.PublicKeyExport, format string) ([]byte, error) {
+	switch format {
+	case "pem":
+		return []byte(export.PEM), nil
+	case "der":
+		return export.DER, nil
+	case "pkcs1":
+		return []byte(export.PKCS1), nil
+	case "jwk":
+		return export.JWK, nil
+	case "openssh":
+		return []byte(export.OpenSSH), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected pem, der, pkcs1, jwk or openssh", format)
+	}
+}
+
+// publicKeyText is encodePublicKey for JSON output, with DER in base64.
+func publicKeyText(export *enigma.PublicKeyExport, format string) (string, error) {
+	encoded, err := encodePublicKey(export, format)
+	if err != nil {
+		return "", err
+	}
+	if format == "der" {
+		return base64.StdEncoding.EncodeToString(encoded), nil
+	}
+	return string(encoded), nil
+}
+
+// signerFlags give the public key of a device key not in the key ring.
+func signerFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "n",
+			Usage: "base64 modulus from generate-key, for keys not in the key ring",
+		},
+		&cli.StringFlag{
+			Name:  "e",
+			Usage: "base64 exponent from generate-key, for keys not in the key ring",
+		},
+	}
+}
+
+// devicePublicKey returns the public key of keyID from --n and --e or the
+// key ring.
+func devicePublicKey(enigmaContext *types.EnigmaContext, cmd *cli.Command, keyID string) (*rsa.PublicKey, error) {
+	switch {
+	case cmd.IsSet("n") != cmd.IsSet("e"):
+		return nil, fmt.Errorf("--n and --e must be given together")
+	case cmd.IsSet("n"):
+		return enigma.PublicKeyFromBase64(cmd.String("n"), cmd.String("e"))
+	default:
+		return enigmaContext.KeyRing.PublicKey(enigmaContext.Device, keyID)
+	}
+}
+
+// deviceSigner returns a signer for keyID, with its public key from --n and
+// --e or the key ring.
+func deviceSigner(enigmaContext *types.EnigmaContext, cmd *cli.Command, keyID string) (*enigma.RSASigner, error) {
+	pub, err := devicePublicKey(enigmaContext, cmd, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return enigma.NewRSASigner(enigmaContext.Device, keyID, pub), nil
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func Seal() *cli.Command {
+	return &cli.Command{
+		Name:      "seal",
+		ArgsUsage: "<key-id> <plaintext>",
+		Flags:     streamFlags(),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyID := cmd.Args().Get(0)
+			if keyID == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Key ID is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			if isStreaming(cmd) {
+				outPath := streamPath(cmd, "out")
+				n, err := streamFiles(streamPath(cmd, "in"), outPath, func(dst io.Writer, src io.Reader) (int64, error) {
+					w, err := enigma.NewRSASealWriter(enigmaContext.Device, keyID, dst)
+					if err != nil {
+						return 0, err
+					}
+
+					n, err := io.Copy(w, src)
+					if closeErr := w.Close(); err == nil {
+						err = closeErr
+					}
+					return n, err
+				})
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+
+				// Keep stdout clean when it carries the stream
+				if outPath != "-" {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "success",
+						Message: enigma.GetCodeMessage(0),
+						Data: map[string]any{
+							"output":          outPath,
+							"plaintext_bytes": n,
+						},
+					}
+				}
+				return nil
+			}
+
+			plaintext := cmd.Args().Get(1)
+			if plaintext == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Plaintext is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			envelope, err := enigma.RSASeal(enigmaContext.Device, keyID, []byte(plaintext))
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data:    base64.StdEncoding.EncodeToString(envelope),
+			}
+
+			return nil
+		},
+	}
+}
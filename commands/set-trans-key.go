@@ -1,9 +1,8 @@
-//go:build windows
-
 package commands
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
 	"os"
 
@@ -16,6 +15,7 @@ func SetTransKey() *cli.Command {
 	return &cli.Command{
 		Name:      "set-trans-key",
 		ArgsUsage: "<public-key-n> <public-key-e>",
+		Flags:     keyFileFlags(),
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
 			if !ok {
@@ -26,17 +26,26 @@ func SetTransKey() *cli.Command {
 			pubKeyN := cmd.Args().Get(0)
 			pubKeyE := cmd.Args().Get(1)
 
-			if pubKeyN == "" || pubKeyE == "" {
+			if !cmd.IsSet("key") && (pubKeyN == "" || pubKeyE == "") {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
-					Message: "Public key N and public key E are required as arguments",
+					Message: "Public key N and public key E are required as arguments, or --key",
 					Data:    nil,
 				}
 				return nil
 			}
 
-			res, keyID, err := enigma.SetTransKey(enigmaContext.DLL, pubKeyN, pubKeyE)
-			if !res {
+			var pub *rsa.PublicKey
+			var err error
+			if cmd.IsSet("key") {
+				pub, err = readPublicKey(cmd)
+			} else {
+				pub, err = enigma.PublicKeyFromBase64(pubKeyN, pubKeyE)
+			}
+			if err == nil {
+				err = enigma.SetTransRSAPublicKey(enigmaContext.Device, pub)
+			}
+			if err != nil {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
 					Message: err.Error(),
@@ -49,7 +58,7 @@ func SetTransKey() *cli.Command {
 				Status:  "success",
 				Message: enigma.GetCodeMessage(0),
 				Data: map[string]string{
-					"key_id": keyID,
+					"key_id": "TRANSKEY",
 				},
 			}
 
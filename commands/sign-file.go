@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func SignFile() *cli.Command {
+	return &cli.Command{
+		Name:      "sign-file",
+		ArgsUsage: "<key-id> <file>",
+		Flags: slices.Concat([]cli.Flag{
+			&cli.StringFlag{
+				Name:  "hash",
+				Usage: "hash of the file: sha256, sha384 or sha512",
+				Value: "sha256",
+			},
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "write the signature to `FILE` instead of the file name with " + enigma.FileSignatureExt + " appended",
+			},
+		}, signerFlags()),
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			keyID := cmd.Args().Get(0)
+			inPath := cmd.Args().Get(1)
+			if keyID == "" || inPath == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "Key ID and file are required as arguments",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			outPath := cmd.String("out")
+			if outPath == "" {
+				if inPath == "-" {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: "--out is required when signing stdin",
+						Data:    nil,
+					}
+					return nil
+				}
+				outPath = inPath + enigma.FileSignatureExt
+			}
+
+			h, err := enigma.ParseFileHash(cmd.String("hash"))
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			signer, err := deviceSigner(enigmaContext, cmd, keyID)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			sig, err := signFile(signer, inPath, outPath, h)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data: map[string]any{
+					"key_id":      sig.KeyID,
+					"hash":        sig.Hash,
+					"digest":      sig.Digest,
+					"size":        sig.Size,
+					"fingerprint": sig.Fingerprint,
+					"timestamp":   sig.Timestamp,
+					"output":      outPath,
+				},
+			}
+
+			return nil
+		},
+	}
+}
+
+// signFile signs inPath, "-" meaning stdin, and writes the signature file.
+func signFile(signer *enigma.RSASigner, inPath, outPath string, h crypto.Hash) (*enigma.FileSignature, error) {
+	var in io.Reader = os.Stdin
+	if inPath != "-" {
+		f, err := os.Open(inPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	sig, err := enigma.SignFile(signer, in, h)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := sig.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return sig, os.WriteFile(outPath, data, 0644)
+}
@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -35,7 +33,7 @@ func Sign() *cli.Command {
 				return nil
 			}
 
-			res, signature, err := enigma.Sign(enigmaContext.DLL, keyID, message)
+			res, signature, err := enigma.Sign(enigmaContext.Device, keyID, message)
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -22,7 +20,7 @@ func UID() *cli.Command {
 				os.Exit(1)
 			}
 
-			res, uid, err := enigma.UID(enigmaContext.DLL)
+			res, uid, err := enigma.UID(enigmaContext.Device)
 
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
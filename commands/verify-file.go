@@ -0,0 +1,144 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/joshimello/enigma-go/enigma"
+	"github.com/joshimello/enigma-go/types"
+	"github.com/urfave/cli/v3"
+)
+
+func VerifyFile() *cli.Command {
+	return &cli.Command{
+		Name:      "verify-file",
+		ArgsUsage: "<file>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "sig",
+				Usage: "read the signature from `FILE` instead of the file name with " + enigma.FileSignatureExt + " appended",
+			},
+			&cli.StringFlag{
+				Name:  "pubkey",
+				Usage: "verify in software with the public key in `FILE` instead of on the device: PEM or DER public key, PKCS#1 or certificate, JWK or OpenSSH",
+			},
+			&cli.StringFlag{
+				Name:  "key-id",
+				Usage: "verify on the device with this key instead of the key ID in the signature",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
+			if !ok {
+				fmt.Println("Context error")
+				os.Exit(1)
+			}
+
+			inPath := cmd.Args().Get(0)
+			if inPath == "" {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: "File is required as an argument",
+					Data:    nil,
+				}
+				return nil
+			}
+
+			sigPath := cmd.String("sig")
+			if sigPath == "" {
+				if inPath == "-" {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: "--sig is required when verifying stdin",
+						Data:    nil,
+					}
+					return nil
+				}
+				sigPath = inPath + enigma.FileSignatureExt
+			}
+
+			sigData, err := os.ReadFile(sigPath)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			sig, err := enigma.ParseFileSignature(sigData)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			mode, isValid, err := verifyFile(enigmaContext, cmd, sig, inPath)
+			if err != nil {
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "error",
+					Message: err.Error(),
+					Data:    nil,
+				}
+				return nil
+			}
+
+			enigmaContext.Result = &types.EnigmaResponse{
+				Status:  "success",
+				Message: enigma.GetCodeMessage(0),
+				Data: map[string]any{
+					"valid":       isValid,
+					"verified_by": mode,
+					"key_id":      sig.KeyID,
+					"hash":        sig.Hash,
+					"fingerprint": sig.Fingerprint,
+					"timestamp":   sig.Timestamp,
+				},
+			}
+
+			return nil
+		},
+	}
+}
+
+// verifyFile checks sig against inPath, "-" meaning stdin, in software with
+// --pubkey or else on the device, and reports which.
+func verifyFile(enigmaContext *types.EnigmaContext, cmd *cli.Command, sig *enigma.FileSignature, inPath string) (string, bool, error) {
+	var in io.Reader = os.Stdin
+	if inPath != "-" {
+		f, err := os.Open(inPath)
+		if err != nil {
+			return "", false, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	if cmd.IsSet("pubkey") {
+		data, err := os.ReadFile(cmd.String("pubkey"))
+		if err != nil {
+			return "", false, err
+		}
+		pub, err := enigma.ParsePublicKey(data)
+		if err != nil {
+			return "", false, err
+		}
+
+		isValid, err := sig.Verify(in, pub)
+		return "software", isValid, err
+	}
+
+	keyID := sig.KeyID
+	if cmd.IsSet("key-id") {
+		keyID = cmd.String("key-id")
+	}
+
+	isValid, err := sig.VerifyOnDevice(enigmaContext.Device, keyID, in)
+	return "device", isValid, err
+}
@@ -1,9 +1,8 @@
-//go:build windows
-
 package commands
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
 	"os"
 
@@ -16,6 +15,16 @@ func Verify() *cli.Command {
 	return &cli.Command{
 		Name:      "verify",
 		ArgsUsage: "<key-id> <message> <signature>",
+		Flags: append([]cli.Flag{
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "verify in software with --pubkey or --n and --e, without the device; the key ID argument is left out",
+			},
+			&cli.StringFlag{
+				Name:  "pubkey",
+				Usage: "public key `FILE` for --offline: PEM or DER public key, PKCS#1 or certificate, JWK or OpenSSH",
+			},
+		}, signerFlags()...),
 		Action: func(ctx context.Context, cmd *cli.Command) error {
 			enigmaContext, ok := ctx.Value("enigma-context").(*types.EnigmaContext)
 			if !ok {
@@ -23,6 +32,47 @@ func Verify() *cli.Command {
 				os.Exit(1)
 			}
 
+			if cmd.Bool("offline") {
+				message := cmd.Args().Get(0)
+				signature := cmd.Args().Get(1)
+
+				if message == "" || signature == "" {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: "Message and signature are required as arguments",
+						Data:    nil,
+					}
+					return nil
+				}
+
+				pub, err := offlinePublicKey(cmd)
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+
+				isValid, err := enigma.VerifyOffline(pub, message, signature)
+				if err != nil {
+					enigmaContext.Result = &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+						Data:    nil,
+					}
+					return nil
+				}
+
+				enigmaContext.Result = &types.EnigmaResponse{
+					Status:  "success",
+					Message: enigma.GetCodeMessage(0),
+					Data:    isValid,
+				}
+				return nil
+			}
+
 			keyID := cmd.Args().Get(0)
 			message := cmd.Args().Get(1)
 			signature := cmd.Args().Get(2)
@@ -36,7 +86,7 @@ func Verify() *cli.Command {
 				return nil
 			}
 
-			res, isValid, err := enigma.Verify(enigmaContext.DLL, keyID, message, signature)
+			res, isValid, err := enigma.Verify(enigmaContext.Device, keyID, message, signature)
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
@@ -56,3 +106,21 @@ func Verify() *cli.Command {
 		},
 	}
 }
+
+// offlinePublicKey reads the public key of verify --offline.
+func offlinePublicKey(cmd *cli.Command) (*rsa.PublicKey, error) {
+	switch {
+	case cmd.IsSet("pubkey") == (cmd.IsSet("n") || cmd.IsSet("e")):
+		return nil, fmt.Errorf("--offline needs --pubkey, or --n and --e")
+	case cmd.IsSet("n") != cmd.IsSet("e"):
+		return nil, fmt.Errorf("--n and --e must be given together")
+	case cmd.IsSet("n"):
+		return enigma.PublicKeyFromBase64(cmd.String("n"), cmd.String("e"))
+	}
+
+	data, err := os.ReadFile(cmd.String("pubkey"))
+	if err != nil {
+		return nil, err
+	}
+	return enigma.ParsePublicKey(data)
+}
@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -22,7 +20,7 @@ func Version() *cli.Command {
 				os.Exit(1)
 			}
 
-			res, version, err := enigma.Version(enigmaContext.DLL)
+			res, version, err := enigma.Version(enigmaContext.Device)
 
 			if !res {
 				enigmaContext.Result = &types.EnigmaResponse{
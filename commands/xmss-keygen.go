@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -42,7 +40,7 @@ func XMSSKeyGen() *cli.Command {
 			skeyFile := args[2]
 			pkeyFile := args[3]
 
-			err := enigma.XMSSKeyGen(enigmaContext.DLL, isXMSSMT, method, skeyFile, pkeyFile)
+			err := enigma.XMSSKeyGen(enigmaContext.Device, isXMSSMT, method, skeyFile, pkeyFile)
 			if err != nil {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
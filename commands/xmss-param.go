@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -25,7 +23,7 @@ func XMSSParam() *cli.Command {
 			}
 
 			// Get XMSS parameters
-			params, err := enigma.XMSSGetParam(enigmaContext.DLL)
+			params, err := enigma.XMSSGetParam(enigmaContext.Device)
 			if err != nil {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
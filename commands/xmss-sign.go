@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -37,7 +35,7 @@ func XMSSSign() *cli.Command {
 				return nil
 			}
 
-			err := enigma.XMSSSign(enigmaContext.DLL, skeyFile, msgFile, sigFile)
+			err := enigma.XMSSSign(enigmaContext.Device, skeyFile, msgFile, sigFile)
 			if err != nil {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
@@ -1,5 +1,3 @@
-//go:build windows
-
 package commands
 
 import (
@@ -37,7 +35,7 @@ func XMSSVerify() *cli.Command {
 				return nil
 			}
 
-			err := enigma.XMSSVerify(enigmaContext.DLL, pkeyFile, sigFile, msgFile)
+			err := enigma.XMSSVerify(enigmaContext.Device, pkeyFile, sigFile, msgFile)
 			if err != nil {
 				enigmaContext.Result = &types.EnigmaResponse{
 					Status:  "error",
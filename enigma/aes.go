@@ -1,13 +1,5 @@
-//go:build windows
-
 package enigma
 
-import (
-	"fmt"
-	"syscall"
-	"unsafe"
-)
-
 const sectorSize = 512
 
 func ISO9797_1_Method2Padding(data []byte, blockSize int) []byte {
@@ -17,6 +9,10 @@ func ISO9797_1_Method2Padding(data []byte, blockSize int) []byte {
 	return append(data, paddingBytes...)
 }
 
+// ISO9797_1_Method2Unpadding returns data unchanged when the padding is
+// malformed.
+//
+// Deprecated: use PaddingISO9797M2.Unpad, which reports invalid padding.
 func ISO9797_1_Method2Unpadding(data []byte) []byte {
 	index := len(data) - 1
 	for index >= 0 && data[index] == 0 {
@@ -30,50 +26,56 @@ func ISO9797_1_Method2Unpadding(data []byte) []byte {
 	return data[:index]
 }
 
-func AESEncrypt(dll *syscall.DLL, inputStr string) (string, error) {
-	paddedData := ISO9797_1_Method2Padding([]byte(inputStr), 16)
-	encryptedBytes, err := AESEncryptBytes(dll, paddedData)
+func AESEncrypt(dev Device, inputStr string) (string, error) {
+	encryptedBytes, err := AESEncryptBytes(dev, []byte(inputStr))
 	if err != nil {
 		return "", err
 	}
 
-	// return hex.EncodeToString(encryptedBytes[:len(paddedData)]), nil
-	return string(encryptedBytes[:len(paddedData)]), nil
+	return string(encryptedBytes), nil
+}
+
+func AESEncryptBytes(dev Device, inputData []byte) ([]byte, error) {
+	return AESEncryptBytesWithPadding(dev, inputData, PaddingISO9797M2)
 }
 
-func AESEncryptBytes(dll *syscall.DLL, inputData []byte) ([]byte, error) {
-	encryptProc, err := dll.FindProc("AESStreamEncDec")
+// AESEncryptBytesWithPadding is AESEncryptBytes with a choice of padding.
+func AESEncryptBytesWithPadding(dev Device, inputData []byte, padding Padding) ([]byte, error) {
+	paddedData, err := padding.Pad(inputData, 16)
 	if err != nil {
 		return nil, err
 	}
+	if len(paddedData) == 0 {
+		return paddedData, nil
+	}
 
-	paddedData := ISO9797_1_Method2Padding(inputData, 16)
-
-	requiredSectors := (len(inputData) + sectorSize - 1) / sectorSize
+	requiredSectors := (len(paddedData) + sectorSize - 1) / sectorSize
 	bufferSize := requiredSectors * sectorSize
 
 	inputBuffer := make([]byte, bufferSize)
 	copy(inputBuffer, paddedData)
 	outputBuffer := make([]byte, bufferSize)
 
-	r1, _, _ := encryptProc.Call(
-		uintptr(unsafe.Pointer(&inputBuffer[0])),
-		uintptr(unsafe.Pointer(&outputBuffer[0])),
-		uintptr(requiredSectors),
-		uintptr(1),
-	)
-
-	if r1 != 0 {
-		return nil, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
+	err = dev.AESStreamEncDec(inputBuffer, outputBuffer, requiredSectors, true)
+	if err != nil {
+		return nil, err
 	}
 
 	return outputBuffer[:len(paddedData)], nil
 }
 
-func AESDecryptBytes(dll *syscall.DLL, inputData []byte) ([]byte, error) {
-	decryptProc, err := dll.FindProc("AESStreamEncDec")
-	if err != nil {
-		return nil, err
+func AESDecryptBytes(dev Device, inputData []byte) ([]byte, error) {
+	return AESDecryptBytesWithPadding(dev, inputData, PaddingISO9797M2)
+}
+
+// AESDecryptBytesWithPadding is AESDecryptBytes with a choice of padding. It
+// returns a *PaddingError if the decrypted data is not padded as expected.
+func AESDecryptBytesWithPadding(dev Device, inputData []byte, padding Padding) ([]byte, error) {
+	if len(inputData)%16 != 0 {
+		return nil, ErrCiphertextLength
+	}
+	if len(inputData) == 0 {
+		return padding.Unpad(inputData, 16)
 	}
 
 	requiredSectors := (len(inputData) + sectorSize - 1) / sectorSize
@@ -83,24 +85,16 @@ func AESDecryptBytes(dll *syscall.DLL, inputData []byte) ([]byte, error) {
 	copy(inputBuffer, inputData)
 	outputBuffer := make([]byte, bufferSize)
 
-	r1, _, _ := decryptProc.Call(
-		uintptr(unsafe.Pointer(&inputBuffer[0])),
-		uintptr(unsafe.Pointer(&outputBuffer[0])),
-		uintptr(requiredSectors),
-		uintptr(0),
-	)
-
-	if r1 != 0 {
-		return nil, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
+	err := dev.AESStreamEncDec(inputBuffer, outputBuffer, requiredSectors, false)
+	if err != nil {
+		return nil, err
 	}
 
-	unpaddedData := ISO9797_1_Method2Unpadding(outputBuffer[:len(inputData)])
-
-	return unpaddedData, nil
+	return padding.Unpad(outputBuffer[:len(inputData)], 16)
 }
 
-func AESDecrypt(dll *syscall.DLL, inputStr string) (string, error) {
-	decryptedBytes, err := AESDecryptBytes(dll, []byte(inputStr))
+func AESDecrypt(dev Device, inputStr string) (string, error) {
+	decryptedBytes, err := AESDecryptBytes(dev, []byte(inputStr))
 	if err != nil {
 		return "", err
 	}
@@ -108,36 +102,11 @@ func AESDecrypt(dll *syscall.DLL, inputStr string) (string, error) {
 	return string(decryptedBytes), nil
 }
 
-func AESEncryptFile(dll *syscall.DLL, sourceFilePath, sourceFileName, targetPath string) error {
-	fileAESProc, err := dll.FindProc("FileAES")
-	if err != nil {
-		return err
-	}
-
-	sourceFilePathBytes := append([]byte(sourceFilePath), 0)
-	sourceFileNameBytes := append([]byte(sourceFileName), 0)
-	targetPathBytes := append([]byte(targetPath), 0)
-
-	r1, _, _ := fileAESProc.Call(
-		uintptr(unsafe.Pointer(&sourceFilePathBytes[0])),
-		uintptr(unsafe.Pointer(&sourceFileNameBytes[0])),
-		uintptr(unsafe.Pointer(&targetPathBytes[0])),
-		uintptr(1),
-	)
-
-	if r1 != 0 {
-		return fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
-	return nil
+func AESEncryptFile(dev Device, sourceFilePath, sourceFileName, targetPath string) error {
+	return dev.FileAES(sourceFilePath, sourceFileName, targetPath, true)
 }
 
-func AESEncryptBlock(dll *syscall.DLL, plaintext [16]byte) ([16]byte, error) {
-	encryptProc, err := dll.FindProc("AESStreamEncDec")
-	if err != nil {
-		return [16]byte{}, err
-	}
-
+func AESEncryptBlock(dev Device, plaintext [16]byte) ([16]byte, error) {
 	// Create 512-byte buffers (one sector)
 	inputBuffer := make([]byte, sectorSize)
 	outputBuffer := make([]byte, sectorSize)
@@ -146,15 +115,9 @@ func AESEncryptBlock(dll *syscall.DLL, plaintext [16]byte) ([16]byte, error) {
 	copy(inputBuffer[:16], plaintext[:])
 	// The rest of the buffer will be zeros
 
-	r1, _, _ := encryptProc.Call(
-		uintptr(unsafe.Pointer(&inputBuffer[0])),
-		uintptr(unsafe.Pointer(&outputBuffer[0])),
-		uintptr(1), // 1 sector
-		uintptr(1), // 1 = encrypt
-	)
-
-	if r1 != 0 {
-		return [16]byte{}, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
+	err := dev.AESStreamEncDec(inputBuffer, outputBuffer, 1, true) // 1 sector
+	if err != nil {
+		return [16]byte{}, err
 	}
 
 	// Extract the first 16 bytes from the output
@@ -164,12 +127,7 @@ func AESEncryptBlock(dll *syscall.DLL, plaintext [16]byte) ([16]byte, error) {
 }
 
 // AESDecryptBlock decrypts a single 16-byte AES block using the HSM
-func AESDecryptBlock(dll *syscall.DLL, ciphertext [16]byte) ([16]byte, error) {
-	decryptProc, err := dll.FindProc("AESStreamEncDec")
-	if err != nil {
-		return [16]byte{}, err
-	}
-
+func AESDecryptBlock(dev Device, ciphertext [16]byte) ([16]byte, error) {
 	// Create 512-byte buffers (one sector)
 	inputBuffer := make([]byte, sectorSize)
 	outputBuffer := make([]byte, sectorSize)
@@ -178,15 +136,9 @@ func AESDecryptBlock(dll *syscall.DLL, ciphertext [16]byte) ([16]byte, error) {
 	copy(inputBuffer[:16], ciphertext[:])
 	// The rest of the buffer will be zeros
 
-	r1, _, _ := decryptProc.Call(
-		uintptr(unsafe.Pointer(&inputBuffer[0])),
-		uintptr(unsafe.Pointer(&outputBuffer[0])),
-		uintptr(1), // 1 sector
-		uintptr(0), // 0 = decrypt
-	)
-
-	if r1 != 0 {
-		return [16]byte{}, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
+	err := dev.AESStreamEncDec(inputBuffer, outputBuffer, 1, false) // 1 sector
+	if err != nil {
+		return [16]byte{}, err
 	}
 
 	// Extract the first 16 bytes from the output
@@ -195,26 +147,6 @@ func AESDecryptBlock(dll *syscall.DLL, ciphertext [16]byte) ([16]byte, error) {
 	return result, nil
 }
 
-func AESDecryptFile(dll *syscall.DLL, sourceFilePath, sourceFileName, targetPath string) error {
-	fileAESProc, err := dll.FindProc("FileAES")
-	if err != nil {
-		return err
-	}
-
-	sourceFilePathBytes := append([]byte(sourceFilePath), 0)
-	sourceFileNameBytes := append([]byte(sourceFileName), 0)
-	targetPathBytes := append([]byte(targetPath), 0)
-
-	r1, _, _ := fileAESProc.Call(
-		uintptr(unsafe.Pointer(&sourceFilePathBytes[0])),
-		uintptr(unsafe.Pointer(&sourceFileNameBytes[0])),
-		uintptr(unsafe.Pointer(&targetPathBytes[0])),
-		uintptr(0), // enc=0 for decryption
-	)
-
-	if r1 != 0 {
-		return fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
-	return nil
+func AESDecryptFile(dev Device, sourceFilePath, sourceFileName, targetPath string) error {
+	return dev.FileAES(sourceFilePath, sourceFileName, targetPath, false)
 }
@@ -0,0 +1,215 @@
+package enigma
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"fmt"
+)
+
+// AESBlock is a cipher.Block backed by the device-resident AES key, for use
+// with the crypto/cipher modes. CTR, GCM and CBC decryption are batched so
+// that many blocks share a single AESStreamEncDec call; other modes fall
+// back to one call per block.
+//
+// cipher.Block has no way to report errors, so Encrypt, Decrypt and the
+// modes built on them panic if the device call fails. Use EncryptBlocks and
+// DecryptBlocks to get the error instead.
+type AESBlock struct {
+	dev Device
+}
+
+var _ cipher.Block = (*AESBlock)(nil)
+
+func NewAESBlock(dev Device) *AESBlock {
+	return &AESBlock{dev: dev}
+}
+
+func (b *AESBlock) BlockSize() int {
+	return 16
+}
+
+func (b *AESBlock) Encrypt(dst, src []byte) {
+	if len(src) < 16 || len(dst) < 16 {
+		panic("enigma: input not full block")
+	}
+	mustCrypt(b.EncryptBlocks(dst[:16], src[:16]))
+}
+
+func (b *AESBlock) Decrypt(dst, src []byte) {
+	if len(src) < 16 || len(dst) < 16 {
+		panic("enigma: input not full block")
+	}
+	mustCrypt(b.DecryptBlocks(dst[:16], src[:16]))
+}
+
+// EncryptBlocks encrypts src, a whole number of blocks, into dst, packing up
+// to streamSectors sectors of blocks into each device call. dst and src may
+// overlap entirely.
+func (b *AESBlock) EncryptBlocks(dst, src []byte) error {
+	return b.cryptBlocks(dst, src, true)
+}
+
+// DecryptBlocks is the inverse of EncryptBlocks.
+func (b *AESBlock) DecryptBlocks(dst, src []byte) error {
+	return b.cryptBlocks(dst, src, false)
+}
+
+func (b *AESBlock) cryptBlocks(dst, src []byte, encrypt bool) error {
+	if len(src)%16 != 0 {
+		return fmt.Errorf("input length %d is not a multiple of the AES block size", len(src))
+	}
+	if len(dst) < len(src) {
+		return fmt.Errorf("output smaller than input")
+	}
+
+	bufferSize := min((len(src)+sectorSize-1)/sectorSize, streamSectors) * sectorSize
+	input := make([]byte, bufferSize)
+	output := make([]byte, bufferSize)
+
+	for len(src) > 0 {
+		n := min(len(src), streamBatchSize)
+		sectors := (n + sectorSize - 1) / sectorSize
+		size := sectors * sectorSize
+
+		copy(input, src[:n])
+		clear(input[n:size])
+
+		if err := b.dev.AESStreamEncDec(input[:size], output[:size], sectors, encrypt); err != nil {
+			return err
+		}
+
+		copy(dst, output[:n])
+		dst, src = dst[n:], src[n:]
+	}
+
+	return nil
+}
+
+func mustCrypt(err error) {
+	if err != nil {
+		panic(fmt.Errorf("enigma: device AES operation failed: %w", err))
+	}
+}
+
+// counterKeystream fills ks with the encryption of consecutive counter
+// blocks starting at ctr, advancing ctr past them. inc selects between the
+// 128-bit counter of CTR mode and the 32-bit counter of GCM.
+func (b *AESBlock) counterKeystream(ks []byte, ctr *[16]byte, inc func(*[16]byte)) error {
+	for i := 0; i < len(ks); i += 16 {
+		copy(ks[i:], ctr[:])
+		inc(ctr)
+	}
+	return b.EncryptBlocks(ks, ks)
+}
+
+func inc128(ctr *[16]byte) {
+	for i := 15; i >= 0; i-- {
+		ctr[i]++
+		if ctr[i] != 0 {
+			break
+		}
+	}
+}
+
+type aesCTR struct {
+	b         *AESBlock
+	ctr       [16]byte
+	keystream []byte
+	buf       []byte
+}
+
+// NewCTR returns a CTR mode stream that encrypts a batch of counter blocks
+// per device call. cipher.NewCTR uses it automatically.
+func (b *AESBlock) NewCTR(iv []byte) cipher.Stream {
+	if len(iv) != 16 {
+		panic("cipher.NewCTR: IV length must equal block size")
+	}
+
+	c := &aesCTR{b: b}
+	copy(c.ctr[:], iv)
+	return c
+}
+
+func (c *aesCTR) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("crypto/cipher: output smaller than input")
+	}
+
+	for len(src) > 0 {
+		if len(c.keystream) == 0 {
+			c.refill(len(src))
+		}
+
+		n := subtle.XORBytes(dst, src, c.keystream)
+		c.keystream = c.keystream[n:]
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// refill generates enough keystream for want bytes, up to one batch.
+func (c *aesCTR) refill(want int) {
+	size := min((want+15)/16*16, streamBatchSize)
+	if cap(c.buf) < size {
+		c.buf = make([]byte, size)
+	}
+
+	c.keystream = c.buf[:size]
+	mustCrypt(c.b.counterKeystream(c.keystream, &c.ctr, inc128))
+}
+
+type aesCBCDecrypter struct {
+	b  *AESBlock
+	iv [16]byte
+}
+
+// NewCBCDecrypter returns a CBC decrypter that deciphers all blocks passed
+// to CryptBlocks in batched device calls before chaining them in Go.
+// cipher.NewCBCDecrypter uses it automatically. CBC encryption is
+// inherently sequential and goes through Encrypt one block at a time.
+func (b *AESBlock) NewCBCDecrypter(iv []byte) cipher.BlockMode {
+	if len(iv) != 16 {
+		panic("cipher.NewCBCDecrypter: IV length must equal block size")
+	}
+
+	c := &aesCBCDecrypter{b: b}
+	copy(c.iv[:], iv)
+	return c
+}
+
+func (c *aesCBCDecrypter) BlockSize() int {
+	return 16
+}
+
+func (c *aesCBCDecrypter) CryptBlocks(dst, src []byte) {
+	if len(src)%16 != 0 {
+		panic("crypto/cipher: input not full blocks")
+	}
+	if len(dst) < len(src) {
+		panic("crypto/cipher: output smaller than input")
+	}
+	if len(src) == 0 {
+		return
+	}
+
+	plain := make([]byte, len(src))
+	mustCrypt(c.b.DecryptBlocks(plain, src))
+
+	var next [16]byte
+	copy(next[:], src[len(src)-16:])
+
+	// Walk backwards so the previous ciphertext block is still intact when
+	// dst and src are the same buffer.
+	for i := len(src) - 16; i > 0; i -= 16 {
+		subtle.XORBytes(dst[i:i+16], plain[i:i+16], src[i-16:i])
+	}
+	subtle.XORBytes(dst[:16], plain[:16], c.iv[:])
+
+	c.iv = next
+}
+
+func (c *aesCBCDecrypter) SetIV(iv []byte) {
+	if len(iv) != 16 {
+		panic("cipher: incorrect length IV")
+	}
+	copy(c.iv[:], iv)
+}
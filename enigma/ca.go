@@ -0,0 +1,535 @@
+package enigma
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoCA is returned when a CA database has not been initialised.
+var ErrNoCA = errors.New("CA not initialised, run ca init first")
+
+// ErrCAExists is returned when initialising a CA database that already
+// holds a CA.
+var ErrCAExists = errors.New("CA already initialised")
+
+// ErrUnknownSerial is returned when revoking a serial the CA did not issue.
+var ErrUnknownSerial = errors.New("no certificate with this serial number was issued by the CA")
+
+// CA is a certificate authority whose key stays on the device. Its
+// certificate and everything it issues are recorded in a JSON database
+// file, from which revocation lists are built. Certificates and lists are
+// signed with CreateCertificate and CreateRevocationList.
+type CA struct {
+	path string
+	mu   sync.Mutex
+}
+
+type caFile struct {
+	Version     int                 `json:"version"`
+	KeyID       string              `json:"key_id"`
+	Certificate []byte              `json:"certificate"`
+	CRLNumber   int64               `json:"crl_number"`
+	Issued      []IssuedCertificate `json:"issued"`
+}
+
+// IssuedCertificate is a certificate recorded in a CA database. Serial is
+// the serial number in lowercase hex.
+type IssuedCertificate struct {
+	Serial      string     `json:"serial"`
+	Subject     string     `json:"subject"`
+	NotBefore   time.Time  `json:"not_before"`
+	NotAfter    time.Time  `json:"not_after"`
+	IsCA        bool       `json:"is_ca"`
+	Certificate []byte     `json:"certificate"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	Reason      int        `json:"reason,omitempty"`
+}
+
+// IssueOptions are the parts of an issued certificate that do not come
+// from the request.
+type IssueOptions struct {
+	// Validity is how long the certificate is valid for, ending no later
+	// than the CA certificate.
+	Validity time.Duration
+
+	// IsCA issues an intermediate CA certificate, which may issue at most
+	// MaxPathLen further levels of CAs. MaxPathLen -1 takes one less than
+	// the issuing CA allows, or no limit if it has none.
+	IsCA       bool
+	MaxPathLen int
+
+	// The SANs replace those of the request when any is set.
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+
+	// Usages default to the ones requested, then to digitalSignature and
+	// keyEncipherment for leaves and keyCertSign and cRLSign for CAs.
+	KeyUsage    x509.KeyUsage
+	ExtKeyUsage []x509.ExtKeyUsage
+}
+
+// NewCA returns the CA recorded in the database at path.
+func NewCA(path string) *CA {
+	return &CA{path: path}
+}
+
+// Init creates a self-signed root certificate for the key of signer, valid
+// for validity, and records it as the CA. maxPathLen limits the levels of
+// intermediate CAs below the root, -1 for no limit.
+func (c *CA) Init(signer *RSASigner, subject pkix.Name, validity time.Duration, maxPathLen int) (*x509.Certificate, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               subject,
+		NotBefore:             now,
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	setMaxPathLen(template, maxPathLen)
+
+	der, err := CreateCertificate(template, template, signer.Public(), signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.initWith(signer, der)
+}
+
+// InitWithCertificate records cert, such as an intermediate issued by
+// another CA, as the CA for the key of signer.
+func (c *CA) InitWithCertificate(signer *RSASigner, cert *x509.Certificate) (*x509.Certificate, error) {
+	if !cert.IsCA || cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return nil, errors.New("not a CA certificate")
+	}
+	if !signer.pub.Equal(cert.PublicKey) {
+		return nil, fmt.Errorf("the certificate is not for the public key of %s", signer.KeyID())
+	}
+
+	return c.initWith(signer, cert.Raw)
+}
+
+func (c *CA) initWith(signer *RSASigner, der []byte) (*x509.Certificate, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := os.Stat(c.path); err == nil {
+		return nil, fmt.Errorf("%w in %s", ErrCAExists, c.path)
+	}
+
+	db := &caFile{
+		Version:     1,
+		KeyID:       signer.KeyID(),
+		Certificate: der,
+		Issued:      []IssuedCertificate{issuedRecord(cert)},
+	}
+	if err := c.save(db); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// Certificate returns the CA certificate and the ID of its device key.
+func (c *CA) Certificate() (*x509.Certificate, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, err := c.load()
+	if err != nil {
+		return nil, "", err
+	}
+
+	cert, err := x509.ParseCertificate(db.Certificate)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return cert, db.KeyID, nil
+}
+
+// Issued returns the certificates recorded in the database, the CA
+// certificate first.
+func (c *CA) Issued() ([]IssuedCertificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return db.Issued, nil
+}
+
+// Sign issues a certificate for the subject and public key of csr, whose
+// signature must verify, and records it.
+func (c *CA) Sign(dev Device, csr *x509.CertificateRequest, opts IssueOptions) (*x509.Certificate, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("certificate request signature: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, signer, err := db.signer(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	notAfter := now.Add(opts.Validity)
+	if notAfter.After(issuer.NotAfter) {
+		notAfter = issuer.NotAfter
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		RawSubject:            csr.RawSubject,
+		NotBefore:             now,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
+		EmailAddresses:        csr.EmailAddresses,
+		URIs:                  csr.URIs,
+	}
+
+	if opts.DNSNames != nil || opts.IPAddresses != nil || opts.EmailAddresses != nil || opts.URIs != nil {
+		template.DNSNames = opts.DNSNames
+		template.IPAddresses = opts.IPAddresses
+		template.EmailAddresses = opts.EmailAddresses
+		template.URIs = opts.URIs
+	}
+
+	requestedUsage, requestedExtUsage, err := requestedUsages(csr)
+	if err != nil {
+		return nil, err
+	}
+
+	template.KeyUsage = opts.KeyUsage
+	if template.KeyUsage == 0 {
+		template.KeyUsage = requestedUsage
+	}
+	template.ExtKeyUsage = opts.ExtKeyUsage
+	if template.ExtKeyUsage == nil {
+		template.ExtKeyUsage = requestedExtUsage
+	}
+
+	if opts.IsCA {
+		if issuer.MaxPathLen == 0 {
+			return nil, errors.New("the CA may not issue intermediate CA certificates, its path length is 0")
+		}
+
+		maxPathLen := opts.MaxPathLen
+		if issuer.MaxPathLen > 0 {
+			if maxPathLen < 0 {
+				maxPathLen = issuer.MaxPathLen - 1
+			}
+			if maxPathLen >= issuer.MaxPathLen {
+				return nil, fmt.Errorf("path length %d must be below the %d of the CA", maxPathLen, issuer.MaxPathLen)
+			}
+		}
+
+		template.IsCA = true
+		setMaxPathLen(template, maxPathLen)
+		if template.KeyUsage == 0 {
+			template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		}
+	} else if template.KeyUsage == 0 {
+		template.KeyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	}
+
+	der, err := CreateCertificate(template, issuer, csr.PublicKey, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	db.Issued = append(db.Issued, issuedRecord(cert))
+	if err := c.save(db); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// Revoke records the certificate with serial as revoked for reason, an
+// RFC 5280 reason code.
+func (c *CA) Revoke(serial *big.Int, reason int) (*IssuedCertificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	hexSerial := serial.Text(16)
+	for i := range db.Issued {
+		issued := &db.Issued[i]
+		if issued.Serial != hexSerial {
+			continue
+		}
+
+		if issued.RevokedAt != nil {
+			return nil, fmt.Errorf("certificate %s was already revoked at %s", hexSerial, issued.RevokedAt.Format(time.RFC3339))
+		}
+		if i == 0 {
+			return nil, errors.New("the CA cannot revoke its own certificate")
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		issued.RevokedAt = &now
+		issued.Reason = reason
+
+		if err := c.save(db); err != nil {
+			return nil, err
+		}
+		return issued, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownSerial, hexSerial)
+}
+
+// CRL returns a DER revocation list of every revoked certificate, valid
+// for validity, with the next CRL number.
+func (c *CA) CRL(dev Device, validity time.Duration) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, signer, err := db.signer(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	template := &x509.RevocationList{
+		Number:     big.NewInt(db.CRLNumber + 1),
+		ThisUpdate: now,
+		NextUpdate: now.Add(validity),
+	}
+
+	for _, issued := range db.Issued {
+		if issued.RevokedAt == nil {
+			continue
+		}
+
+		serial, ok := new(big.Int).SetString(issued.Serial, 16)
+		if !ok {
+			return nil, fmt.Errorf("CA database %s: invalid serial %q", c.path, issued.Serial)
+		}
+
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   serial,
+			RevocationTime: *issued.RevokedAt,
+			ReasonCode:     issued.Reason,
+		})
+	}
+
+	der, err := CreateRevocationList(template, issuer, signer)
+	if err != nil {
+		return nil, err
+	}
+
+	db.CRLNumber++
+	if err := c.save(db); err != nil {
+		return nil, err
+	}
+
+	return der, nil
+}
+
+// signer returns the CA certificate and a signer for its key.
+func (db *caFile) signer(dev Device) (*x509.Certificate, *RSASigner, error) {
+	cert, err := x509.ParseCertificate(db.Certificate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("not an RSA key: %T", cert.PublicKey)
+	}
+
+	return cert, NewRSASigner(dev, db.KeyID, pub), nil
+}
+
+func (c *CA) load() (*caFile, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNoCA, c.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db := &caFile{}
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, fmt.Errorf("CA database %s: %w", c.path, err)
+	}
+	if db.Version != 1 {
+		return nil, fmt.Errorf("CA database %s: unsupported version %d", c.path, db.Version)
+	}
+
+	return db, nil
+}
+
+func (c *CA) save(db *caFile) error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	return writeAtomic(c.path, true, time.Time{}, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(db)
+	})
+}
+
+func issuedRecord(cert *x509.Certificate) IssuedCertificate {
+	return IssuedCertificate{
+		Serial:      cert.SerialNumber.Text(16),
+		Subject:     cert.Subject.String(),
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+		IsCA:        cert.IsCA,
+		Certificate: cert.Raw,
+	}
+}
+
+// randomSerial returns a positive 127-bit serial number, as RFC 5280 allows
+// at most 20 octets.
+func randomSerial() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 127)
+	serial, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, err
+	}
+	return serial.Add(serial, big.NewInt(1)), nil
+}
+
+func setMaxPathLen(template *x509.Certificate, maxPathLen int) {
+	if maxPathLen < 0 {
+		template.MaxPathLen = -1
+		return
+	}
+	template.MaxPathLen = maxPathLen
+	template.MaxPathLenZero = maxPathLen == 0
+}
+
+// requestedUsages reads the key usage and extended key usage extensions
+// of a request, as KeyUsageExtensions writes them.
+func requestedUsages(csr *x509.CertificateRequest) (x509.KeyUsage, []x509.ExtKeyUsage, error) {
+	var usage x509.KeyUsage
+	var extUsages []x509.ExtKeyUsage
+
+	for _, ext := range csr.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtKeyUsage):
+			var bits asn1.BitString
+			if rest, err := asn1.Unmarshal(ext.Value, &bits); err != nil || len(rest) != 0 {
+				return 0, nil, errors.New("invalid requested key usage")
+			}
+			for i := range len(keyUsageNames) {
+				if bits.At(i) != 0 {
+					usage |= 1 << i
+				}
+			}
+
+		case ext.Id.Equal(oidExtExtKeyUsage):
+			var oids []asn1.ObjectIdentifier
+			if rest, err := asn1.Unmarshal(ext.Value, &oids); err != nil || len(rest) != 0 {
+				return 0, nil, errors.New("invalid requested extended key usage")
+			}
+			for _, oid := range oids {
+				for extUsage, known := range oidExtKeyUsages {
+					if known.Equal(oid) {
+						extUsages = append(extUsages, extUsage)
+					}
+				}
+			}
+		}
+	}
+
+	return usage, extUsages, nil
+}
+
+var revocationReasons = []string{
+	"unspecified",
+	"keyCompromise",
+	"cACompromise",
+	"affiliationChanged",
+	"superseded",
+	"cessationOfOperation",
+	"certificateHold",
+	"",
+	"removeFromCRL",
+	"privilegeWithdrawn",
+	"aACompromise",
+}
+
+// ParseRevocationReason converts an RFC 5280 revocation reason name, such
+// as keyCompromise or superseded, to its reason code.
+func ParseRevocationReason(name string) (int, error) {
+	if name != "" {
+		if i := indexFold(revocationReasons, name); i >= 0 {
+			return i, nil
+		}
+	}
+
+	var names []string
+	for _, reason := range revocationReasons {
+		if reason != "" {
+			names = append(names, reason)
+		}
+	}
+	return 0, fmt.Errorf("unknown revocation reason %q, expected one of %s", name, strings.Join(names, ", "))
+}
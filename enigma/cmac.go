@@ -0,0 +1,153 @@
+package enigma
+
+import (
+	"crypto/subtle"
+	"hash"
+)
+
+// CMACSize is the size of an AES-CMAC in bytes.
+const CMACSize = 16
+
+// CMAC computes AES-CMAC (NIST SP 800-38B) keyed by the device AES key.
+// CMAC chains every block through the cipher, so each 16 bytes of input is
+// a separate device call.
+//
+// CMAC implements hash.Hash, which has no way to report errors. A failing
+// device call is returned from Write and MAC, and makes Sum panic as the
+// AESBlock methods do.
+type CMAC struct {
+	b      *AESBlock
+	k1, k2 [16]byte
+	x      [16]byte
+	buf    [16]byte
+	n      int
+	err    error
+}
+
+var _ hash.Hash = (*CMAC)(nil)
+
+// NewCMAC returns a CMAC keyed by the device AES key. Deriving the subkeys
+// takes one device call, whose error is returned.
+func NewCMAC(dev Device) (*CMAC, error) {
+	c := &CMAC{b: NewAESBlock(dev)}
+
+	var l [16]byte
+	if err := c.b.EncryptBlocks(l[:], l[:]); err != nil {
+		return nil, err
+	}
+
+	c.k1 = cmacDouble(l)
+	c.k2 = cmacDouble(c.k1)
+
+	return c, nil
+}
+
+// AESCMAC returns the AES-CMAC of message under the device AES key.
+func AESCMAC(dev Device, message []byte) ([]byte, error) {
+	c, err := NewCMAC(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Write(message)
+	return c.MAC()
+}
+
+// AESCMACVerify reports whether mac is the AES-CMAC of message, comparing
+// in constant time.
+func AESCMACVerify(dev Device, message, mac []byte) (bool, error) {
+	c, err := NewCMAC(dev)
+	if err != nil {
+		return false, err
+	}
+
+	c.Write(message)
+	return c.Verify(mac)
+}
+
+func (c *CMAC) Size() int      { return CMACSize }
+func (c *CMAC) BlockSize() int { return 16 }
+
+// Reset clears the input, keeping the subkeys.
+func (c *CMAC) Reset() {
+	c.x, c.buf, c.n, c.err = [16]byte{}, [16]byte{}, 0, nil
+}
+
+// Write adds p to the input. The last block is held back until the MAC is
+// taken, since it is processed differently.
+func (c *CMAC) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	written := len(p)
+	for len(p) > 0 {
+		if c.n == 16 {
+			subtle.XORBytes(c.x[:], c.x[:], c.buf[:])
+			if c.err = c.b.EncryptBlocks(c.x[:], c.x[:]); c.err != nil {
+				return 0, c.err
+			}
+			c.n = 0
+		}
+
+		n := copy(c.buf[c.n:], p)
+		c.n += n
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// Sum appends the MAC of the input so far to b without changing the state.
+// It panics if a device call fails.
+func (c *CMAC) Sum(b []byte) []byte {
+	mac, err := c.MAC()
+	mustCrypt(err)
+	return append(b, mac...)
+}
+
+// MAC returns the MAC of the input so far without changing the state.
+func (c *CMAC) MAC() ([]byte, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	last := c.buf
+	if c.n == 16 {
+		subtle.XORBytes(last[:], last[:], c.k1[:])
+	} else {
+		clear(last[c.n:])
+		last[c.n] = 0x80
+		subtle.XORBytes(last[:], last[:], c.k2[:])
+	}
+
+	mac := make([]byte, CMACSize)
+	subtle.XORBytes(mac, c.x[:], last[:])
+	if err := c.b.EncryptBlocks(mac, mac); err != nil {
+		return nil, err
+	}
+
+	return mac, nil
+}
+
+// Verify reports whether mac is the MAC of the input so far, comparing in
+// constant time.
+func (c *CMAC) Verify(mac []byte) (bool, error) {
+	want, err := c.MAC()
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(mac, want) == 1, nil
+}
+
+// cmacDouble multiplies a subkey by x in GF(2^128).
+func cmacDouble(in [16]byte) [16]byte {
+	var out [16]byte
+	carry := in[0] >> 7
+	for i := 0; i < 15; i++ {
+		out[i] = in[i]<<1 | in[i+1]>>7
+	}
+	out[15] = in[15]<<1 ^ byte(subtle.ConstantTimeSelect(int(carry), 0x87, 0))
+	return out
+}
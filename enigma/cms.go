@@ -0,0 +1,682 @@
+package enigma
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// CMS (RFC 5652) SignedData and EnvelopedData are encoded in DER with
+// encoding/asn1, for S/MIME tooling such as openssl cms.
+//
+// SignedData carries one signer, identified by the issuer and serial number
+// of its certificate, with the contentType, signingTime and messageDigest
+// signed attributes. rsa_sign hashes with SHA-256, so it signs the DER SET
+// OF those attributes directly and the digest algorithm is always SHA-256.
+//
+// EnvelopedData encrypts the content with a random AES-256-CBC key, which
+// is encrypted with PKCS#1 v1.5 for each recipient by rsa_encrypt and
+// decrypted by rsa_decrypt.
+var (
+	oidCMSData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidCMSSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidCMSEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttributeSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// cmsDigests lists the digest algorithms accepted when verifying, with the
+// RSA signature algorithm implying each of them.
+var cmsDigests = []struct {
+	digest    asn1.ObjectIdentifier
+	signature asn1.ObjectIdentifier
+	hash      crypto.Hash
+}{
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, crypto.SHA256},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, crypto.SHA384},
+	{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, crypto.SHA512},
+}
+
+var cmsKeySizes = map[string]int{
+	oidAES128CBC.String(): 16,
+	oidAES192CBC.String(): 24,
+	oidAES256CBC.String(): 32,
+}
+
+// ErrCMSFormat is returned for input that is not a DER ContentInfo of the
+// expected type, or uses CMS features that are not supported.
+var ErrCMSFormat = errors.New("not a supported CMS structure")
+
+// ErrCMSAlgorithm is returned for digest, signature and encryption
+// algorithms that are not supported.
+var ErrCMSAlgorithm = errors.New("unsupported CMS algorithm")
+
+// ErrCMSRecipient is returned when EnvelopedData has no recipient matching
+// the key, or a recipient cannot be identified.
+var ErrCMSRecipient = errors.New("no matching CMS recipient")
+
+// ErrCMSDecrypt is returned when the content of EnvelopedData cannot be
+// decrypted with the key, because it was encrypted for another key or was
+// modified.
+var ErrCMSDecrypt = errors.New("CMS decryption failed")
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type cmsEncapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+// cmsSignerInfo keeps SignedAttrs as the raw [0] element, since the
+// signature is over exactly those bytes with the SET OF tag.
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+type cmsIssuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsEnvelopedData struct {
+	Version              int
+	OriginatorInfo       asn1.RawValue   `asn1:"optional,tag:0"`
+	RecipientInfos       []asn1.RawValue `asn1:"set"`
+	EncryptedContentInfo cmsEncryptedContentInfo
+	UnprotectedAttrs     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsKeyTransRecipientInfo struct {
+	Version                int
+	RID                    asn1.RawValue
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type cmsEncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"optional,tag:0"`
+}
+
+// CMSSignOptions control SignCMS.
+type CMSSignOptions struct {
+	// Detached leaves the content out of the SignedData.
+	Detached bool
+	// Certificates are included after the signer certificate, such as
+	// the intermediates of its chain.
+	Certificates []*x509.Certificate
+	// SigningTime defaults to now.
+	SigningTime time.Time
+}
+
+// SignCMS returns a DER ContentInfo holding SignedData of content, signed
+// on the device with the key of signer. cert is the certificate of that
+// key and is included in the output.
+func SignCMS(signer *RSASigner, cert *x509.Certificate, content []byte, opts CMSSignOptions) ([]byte, error) {
+	if !signer.pub.Equal(cert.PublicKey) {
+		return nil, errors.New("cms: the signer key does not match the certificate")
+	}
+
+	signingTime := opts.SigningTime
+	if signingTime.IsZero() {
+		signingTime = time.Now()
+	}
+
+	digest := sha256.Sum256(content)
+	attributes, err := cmsSignedAttributes(
+		cmsAttributeValue{oidAttributeContentType, oidCMSData},
+		cmsAttributeValue{oidAttributeSigningTime, signingTime.UTC().Truncate(time.Second)},
+		cmsAttributeValue{oidAttributeMessageDigest, digest[:]},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	signedAttrs, err := cmsAttributeSet(attributes)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := signer.SignMessage(nil, signedAttrs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(cmsIssuerAndSerial{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: cmsDigests[0].digest}
+	sd := cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algorithm},
+		EncapContentInfo: cmsEncapContentInfo{EContentType: oidCMSData},
+		SignerInfos: []cmsSignerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256Algorithm,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attributes},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			Signature:          signature,
+		}},
+	}
+
+	if !opts.Detached {
+		eContent, err := asn1.Marshal(content)
+		if err != nil {
+			return nil, err
+		}
+		sd.EncapContentInfo.EContent = cmsExplicit(eContent)
+	}
+
+	var certificates []byte
+	for _, c := range append([]*x509.Certificate{cert}, opts.Certificates...) {
+		certificates = append(certificates, c.Raw...)
+	}
+	sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates}
+
+	return cmsMarshal(oidCMSSignedData, sd)
+}
+
+// CMSSignedData is parsed SignedData with one signer. Its signature has not
+// been checked until Verify succeeds.
+type CMSSignedData struct {
+	// Content is nil for a detached signature.
+	Content  []byte
+	Detached bool
+	// Certificates are all the certificates included, and Signer is the
+	// one of the signer, or nil if it is not included.
+	Certificates []*x509.Certificate
+	Signer       *x509.Certificate
+	// SigningTime is zero when the attribute is absent.
+	SigningTime time.Time
+
+	contentType asn1.ObjectIdentifier
+	signerInfo  cmsSignerInfo
+}
+
+// ParseCMSSignedData parses a DER ContentInfo holding SignedData without
+// checking it.
+func ParseCMSSignedData(der []byte) (*CMSSignedData, error) {
+	var sd cmsSignedData
+	if err := cmsUnmarshal(der, oidCMSSignedData, &sd); err != nil {
+		return nil, err
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%w: %d signers, expected one", ErrCMSFormat, len(sd.SignerInfos))
+	}
+
+	s := &CMSSignedData{
+		Detached:    len(sd.EncapContentInfo.EContent.FullBytes) == 0,
+		contentType: sd.EncapContentInfo.EContentType,
+		signerInfo:  sd.SignerInfos[0],
+	}
+
+	if !s.Detached {
+		if rest, err := asn1.Unmarshal(sd.EncapContentInfo.EContent.Bytes, &s.Content); err != nil || len(rest) != 0 {
+			return nil, fmt.Errorf("%w: encapsulated content is not a DER OCTET STRING", ErrCMSFormat)
+		}
+		if s.Content == nil {
+			s.Content = []byte{}
+		}
+	}
+
+	if len(sd.Certificates.Bytes) != 0 {
+		certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCMSFormat, err)
+		}
+		s.Certificates = certs
+	}
+
+	for _, cert := range s.Certificates {
+		if cmsIdentifies(s.signerInfo.SID, cert) {
+			s.Signer = cert
+			break
+		}
+	}
+
+	attributes, err := s.attributes()
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := attributes[oidAttributeSigningTime.String()]; ok {
+		if _, err := asn1.Unmarshal(value, &s.SigningTime); err != nil {
+			return nil, fmt.Errorf("%w: signingTime: %v", ErrCMSFormat, err)
+		}
+	}
+
+	return s, nil
+}
+
+// Verify checks the signature in software with the public key of Signer,
+// and that the content matches the signed digest. content is only used for
+// a detached signature. The certificate chain of Signer is not checked.
+func (s *CMSSignedData) Verify(content []byte) (bool, error) {
+	if s.Signer == nil {
+		return false, errors.New("cms: the signer certificate is not included")
+	}
+	pub, ok := s.Signer.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return false, fmt.Errorf("%w: signer key %T", ErrCMSAlgorithm, s.Signer.PublicKey)
+	}
+
+	if !s.Detached {
+		content = s.Content
+	} else if content == nil {
+		return false, errors.New("cms: a detached signature needs the content")
+	}
+
+	h, err := s.hash()
+	if err != nil {
+		return false, err
+	}
+	hasher := h.New()
+	hasher.Write(content)
+	contentDigest := hasher.Sum(nil)
+
+	// Without signed attributes the signature is of the content itself
+	if len(s.signerInfo.SignedAttrs.Bytes) == 0 {
+		return rsa.VerifyPKCS1v15(pub, h, contentDigest, s.signerInfo.Signature) == nil, nil
+	}
+
+	attributes, err := s.attributes()
+	if err != nil {
+		return false, err
+	}
+
+	var contentType asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(attributes[oidAttributeContentType.String()], &contentType); err != nil || !contentType.Equal(s.contentType) {
+		return false, nil
+	}
+	var messageDigest []byte
+	if _, err := asn1.Unmarshal(attributes[oidAttributeMessageDigest.String()], &messageDigest); err != nil || !bytes.Equal(messageDigest, contentDigest) {
+		return false, nil
+	}
+
+	signedAttrs, err := cmsAttributeSet(s.signerInfo.SignedAttrs.Bytes)
+	if err != nil {
+		return false, err
+	}
+	hasher = h.New()
+	hasher.Write(signedAttrs)
+
+	return rsa.VerifyPKCS1v15(pub, h, hasher.Sum(nil), s.signerInfo.Signature) == nil, nil
+}
+
+// hash returns the digest algorithm of the signer, checking that the
+// signature algorithm agrees with it.
+func (s *CMSSignedData) hash() (crypto.Hash, error) {
+	for _, d := range cmsDigests {
+		if !s.signerInfo.DigestAlgorithm.Algorithm.Equal(d.digest) {
+			continue
+		}
+		if alg := s.signerInfo.SignatureAlgorithm.Algorithm; !alg.Equal(oidRSAEncryption) && !alg.Equal(d.signature) {
+			return 0, fmt.Errorf("%w: signature %v", ErrCMSAlgorithm, alg)
+		}
+		return d.hash, nil
+	}
+	return 0, fmt.Errorf("%w: digest %v", ErrCMSAlgorithm, s.signerInfo.DigestAlgorithm.Algorithm)
+}
+
+// attributes returns the single value of each signed attribute by OID.
+func (s *CMSSignedData) attributes() (map[string][]byte, error) {
+	values := map[string][]byte{}
+	for rest := s.signerInfo.SignedAttrs.Bytes; len(rest) != 0; {
+		var attribute cmsAttribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attribute); err != nil {
+			return nil, fmt.Errorf("%w: signed attributes: %v", ErrCMSFormat, err)
+		}
+
+		var value asn1.RawValue
+		if extra, err := asn1.Unmarshal(attribute.Values.Bytes, &value); err != nil || len(extra) != 0 {
+			return nil, fmt.Errorf("%w: attribute %v must have one value", ErrCMSFormat, attribute.Type)
+		}
+		if _, ok := values[attribute.Type.String()]; ok {
+			return nil, fmt.Errorf("%w: repeated attribute %v", ErrCMSFormat, attribute.Type)
+		}
+		values[attribute.Type.String()] = value.FullBytes
+	}
+	return values, nil
+}
+
+type cmsAttributeValue struct {
+	oid   asn1.ObjectIdentifier
+	value any
+}
+
+// cmsSignedAttributes returns the concatenated encodings of attributes in
+// DER SET OF order.
+func cmsSignedAttributes(attributes ...cmsAttributeValue) ([]byte, error) {
+	encoded := make([][]byte, 0, len(attributes))
+	for _, a := range attributes {
+		value, err := asn1.Marshal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		attribute, err := asn1.Marshal(cmsAttribute{
+			Type:   a.oid,
+			Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, attribute)
+	}
+
+	slices.SortFunc(encoded, bytes.Compare)
+	return bytes.Join(encoded, nil), nil
+}
+
+// cmsAttributeSet returns the DER SET OF attributes, which is what is
+// signed in place of the [0] tag they are stored under.
+func cmsAttributeSet(attributes []byte) ([]byte, error) {
+	return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attributes})
+}
+
+// CMSRecipient is the holder of an RSA key in EnvelopedData. It is
+// identified by the issuer and serial number of Certificate, or when there
+// is none by the subject key ID of PublicKey, the SHA-1 of its PKCS#1
+// encoding.
+type CMSRecipient struct {
+	// KeyID is the key on the device: its public key for EncryptCMS,
+	// where empty means encrypting in software with the public key of
+	// Certificate or PublicKey, and its private key for DecryptCMS.
+	KeyID       string
+	Certificate *x509.Certificate
+	PublicKey   *rsa.PublicKey
+}
+
+// identifier returns the RecipientIdentifier and KeyTransRecipientInfo
+// version of r.
+func (r CMSRecipient) identifier() (asn1.RawValue, int, error) {
+	if r.Certificate != nil {
+		der, err := asn1.Marshal(cmsIssuerAndSerial{
+			Issuer:       asn1.RawValue{FullBytes: r.Certificate.RawIssuer},
+			SerialNumber: r.Certificate.SerialNumber,
+		})
+		return asn1.RawValue{FullBytes: der}, 0, err
+	}
+
+	if r.PublicKey != nil {
+		return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: subjectKeyID(r.PublicKey)}, 2, nil
+	}
+
+	return asn1.RawValue{}, 0, fmt.Errorf("%w: a recipient needs a certificate or public key", ErrCMSRecipient)
+}
+
+// matches reports whether the RecipientIdentifier rid names r. A recipient
+// without a certificate or public key matches any.
+func (r CMSRecipient) matches(rid asn1.RawValue) bool {
+	switch {
+	case r.Certificate != nil:
+		return cmsIdentifies(rid, r.Certificate)
+	case r.PublicKey != nil:
+		return rid.Class == asn1.ClassContextSpecific && rid.Tag == 0 && bytes.Equal(rid.Bytes, subjectKeyID(r.PublicKey))
+	default:
+		return true
+	}
+}
+
+// encryptKey encrypts the content key for r with PKCS#1 v1.5.
+func (r CMSRecipient) encryptKey(dev Device, key []byte) ([]byte, error) {
+	if r.KeyID != "" {
+		keyIDBytes := make([]byte, 8)
+		copy(keyIDBytes, []byte(r.KeyID))
+
+		encrypted := make([]byte, rsaCiphertextSize)
+		if err := dev.RSAEncrypt(keyIDBytes, key, encrypted); err != nil {
+			return nil, err
+		}
+		return encrypted, nil
+	}
+
+	pub := r.PublicKey
+	if r.Certificate != nil {
+		var ok bool
+		if pub, ok = r.Certificate.PublicKey.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("%w: recipient key %T", ErrCMSAlgorithm, r.Certificate.PublicKey)
+		}
+	}
+	return rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+}
+
+// EncryptCMS returns a DER ContentInfo holding EnvelopedData of content for
+// recipients, encrypted with AES-256-CBC.
+func EncryptCMS(dev Device, content []byte, recipients ...CMSRecipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%w: no recipients", ErrCMSRecipient)
+	}
+
+	key := make([]byte, 32)
+	defer clear(key)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	ed := cmsEnvelopedData{}
+	for _, r := range recipients {
+		rid, version, err := r.identifier()
+		if err != nil {
+			return nil, err
+		}
+		encryptedKey, err := r.encryptKey(dev, key)
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := asn1.Marshal(cmsKeyTransRecipientInfo{
+			Version:                version,
+			RID:                    rid,
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue},
+			EncryptedKey:           encryptedKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ed.RecipientInfos = append(ed.RecipientInfos, asn1.RawValue{FullBytes: info})
+
+		// Version 2 as soon as any recipient is named by key ID
+		ed.Version = max(ed.Version, version)
+	}
+
+	padded, err := PaddingPKCS7.Pad(content, aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+
+	ivParameter, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	ed.EncryptedContentInfo = cmsEncryptedContentInfo{
+		ContentType:                oidCMSData,
+		ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParameter}},
+		EncryptedContent:           padded,
+	}
+
+	return cmsMarshal(oidCMSEnvelopedData, ed)
+}
+
+// DecryptCMS decrypts the content of a DER ContentInfo holding
+// EnvelopedData with the private key of recipient on the device. Every key
+// transport recipient matching it is tried, which without a certificate or
+// public key is all of them. Content encrypted with AES-128, AES-192 or
+// AES-256 in CBC mode is supported.
+func DecryptCMS(dev Device, recipient CMSRecipient, der []byte) ([]byte, error) {
+	var ed cmsEnvelopedData
+	if err := cmsUnmarshal(der, oidCMSEnvelopedData, &ed); err != nil {
+		return nil, err
+	}
+
+	eci := ed.EncryptedContentInfo
+	keySize, ok := cmsKeySizes[eci.ContentEncryptionAlgorithm.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("%w: content encryption %v", ErrCMSAlgorithm, eci.ContentEncryptionAlgorithm.Algorithm)
+	}
+	var iv []byte
+	if rest, err := asn1.Unmarshal(eci.ContentEncryptionAlgorithm.Parameters.FullBytes, &iv); err != nil || len(rest) != 0 || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: invalid CBC IV", ErrCMSFormat)
+	}
+	if len(eci.EncryptedContent) == 0 || len(eci.EncryptedContent)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: encrypted content must be whole AES blocks", ErrCMSFormat)
+	}
+
+	var tried bool
+	var lastErr error
+	for _, info := range ed.RecipientInfos {
+		// Other kinds of RecipientInfo are context-tagged and skipped
+		var ktri cmsKeyTransRecipientInfo
+		if _, err := asn1.Unmarshal(info.FullBytes, &ktri); err != nil {
+			continue
+		}
+		if !ktri.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAEncryption) || !recipient.matches(ktri.RID) {
+			continue
+		}
+		tried = true
+
+		key, err := RSADecryptBytes(dev, recipient.KeyID, ktri.EncryptedKey)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(key) != keySize {
+			clear(key)
+			continue
+		}
+		content, err := cmsDecryptContent(key, iv, eci.EncryptedContent)
+		clear(key)
+		if err == nil {
+			return content, nil
+		}
+	}
+
+	if !tried {
+		return nil, ErrCMSRecipient
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCMSDecrypt, lastErr)
+	}
+	return nil, ErrCMSDecrypt
+}
+
+func cmsDecryptContent(key, iv, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	return PaddingPKCS7.Unpad(plaintext, aes.BlockSize)
+}
+
+// cmsIdentifies reports whether the SignerIdentifier or RecipientIdentifier
+// id, an issuer and serial number or a [0] subject key ID, names cert.
+func cmsIdentifies(id asn1.RawValue, cert *x509.Certificate) bool {
+	if id.Class == asn1.ClassContextSpecific && id.Tag == 0 {
+		return len(cert.SubjectKeyId) != 0 && bytes.Equal(id.Bytes, cert.SubjectKeyId)
+	}
+
+	var ias cmsIssuerAndSerial
+	if rest, err := asn1.Unmarshal(id.FullBytes, &ias); err != nil || len(rest) != 0 {
+		return false
+	}
+	return bytes.Equal(ias.Issuer.FullBytes, cert.RawIssuer) && ias.SerialNumber.Cmp(cert.SerialNumber) == 0
+}
+
+// subjectKeyID returns the key ID of pub as RFC 5280 section 4.2.1.2 method
+// 1 and crypto/x509 compute it.
+func subjectKeyID(pub *rsa.PublicKey) []byte {
+	sum := sha1.Sum(x509.MarshalPKCS1PublicKey(pub))
+	return sum[:]
+}
+
+// cmsExplicit wraps der in the [0] EXPLICIT tag of ContentInfo and
+// EncapsulatedContentInfo.
+func cmsExplicit(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+func cmsMarshal(contentType asn1.ObjectIdentifier, content any) ([]byte, error) {
+	der, err := asn1.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(cmsContentInfo{ContentType: contentType, Content: cmsExplicit(der)})
+}
+
+func cmsUnmarshal(der []byte, contentType asn1.ObjectIdentifier, content any) error {
+	var info cmsContentInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) != 0 {
+		return fmt.Errorf("%w: not a DER ContentInfo", ErrCMSFormat)
+	}
+	if !info.ContentType.Equal(contentType) {
+		return fmt.Errorf("%w: content type %v, expected %v", ErrCMSFormat, info.ContentType, contentType)
+	}
+	if rest, err := asn1.Unmarshal(info.Content.Bytes, content); err != nil {
+		return fmt.Errorf("%w: %v", ErrCMSFormat, err)
+	} else if len(rest) != 0 {
+		return fmt.Errorf("%w: data after the content", ErrCMSFormat)
+	}
+	return nil
+}
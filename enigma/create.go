@@ -6,10 +6,10 @@ import (
 	"syscall"
 )
 
-func Create(dllPath string) (*syscall.DLL, error) {
+func Create(dllPath string) (Device, error) {
 	dll, err := syscall.LoadDLL(dllPath)
 	if err != nil {
 		return nil, err
 	}
-	return dll, nil
+	return &DLLDevice{dll: dll}, nil
 }
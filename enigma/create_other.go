@@ -0,0 +1,12 @@
+//go:build !windows
+
+package enigma
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func Create(dllPath string) (Device, error) {
+	return nil, fmt.Errorf("cannot load %s: the DLL backend is not available on %s, use the software token instead", dllPath, runtime.GOOS)
+}
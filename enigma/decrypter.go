@@ -0,0 +1,110 @@
+package enigma
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// rsaCiphertextSize is the size of rsa_decrypt input, one 2048-bit block.
+const rsaCiphertextSize = DeviceKeyBits / 8
+
+// ErrCiphertextSize is returned for RSA ciphertext that is not exactly one
+// block of the device key size.
+var ErrCiphertextSize = fmt.Errorf("RSA ciphertext must be %d bytes", rsaCiphertextSize)
+
+// ErrDecryptScheme is returned for padding schemes the device does not
+// implement.
+var ErrDecryptScheme = errors.New("the device only decrypts PKCS#1 v1.5")
+
+// RSADecryptBytes decrypts a PKCS#1 v1.5 ciphertext with the private key
+// keyID. The length is checked before the device is called.
+func RSADecryptBytes(dev Device, keyID string, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) != rsaCiphertextSize {
+		return nil, fmt.Errorf("%w, not %d", ErrCiphertextSize, len(ciphertext))
+	}
+
+	keyIDBytes := make([]byte, 8)
+	copy(keyIDBytes, []byte(keyID))
+
+	message := make([]byte, rsaCiphertextSize)
+	n, err := dev.RSADecrypt(keyIDBytes, ciphertext, message)
+	if err != nil {
+		return nil, err
+	}
+	if n > len(message) {
+		return nil, fmt.Errorf("rsa_decrypt returned %d bytes", n)
+	}
+
+	return message[:n], nil
+}
+
+// RSADecrypter is a crypto.Decrypter for an RSA key on the device.
+type RSADecrypter struct {
+	dev   Device
+	keyID string
+	pub   *rsa.PublicKey
+}
+
+var _ crypto.Decrypter = (*RSADecrypter)(nil)
+
+// NewRSADecrypter returns a decrypter for the key keyID, whose public key is
+// pub, as returned by a KeyRing or GenerateKey.
+func NewRSADecrypter(dev Device, keyID string, pub *rsa.PublicKey) *RSADecrypter {
+	return &RSADecrypter{dev: dev, keyID: keyID, pub: pub}
+}
+
+// KeyID returns the device key ID.
+func (d *RSADecrypter) KeyID() string {
+	return d.keyID
+}
+
+// Public returns the *rsa.PublicKey of the key.
+func (d *RSADecrypter) Public() crypto.PublicKey {
+	return d.pub
+}
+
+// Decrypt decrypts a PKCS#1 v1.5 ciphertext. opts may be nil or
+// *rsa.PKCS1v15DecryptOptions; OAEP fails with ErrDecryptScheme. With a
+// SessionKeyLen, as in TLS-RSA, a ciphertext that does not decrypt to a key
+// of that length gives a random key instead of an error, like
+// rsa.DecryptPKCS1v15SessionKey, so failures do not show to a peer. The
+// device itself may still take different time to reject bad padding.
+func (d *RSADecrypter) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	sessionKeyLen := 0
+	switch opts := opts.(type) {
+	case nil:
+	case *rsa.PKCS1v15DecryptOptions:
+		sessionKeyLen = opts.SessionKeyLen
+	default:
+		return nil, fmt.Errorf("%w, not %T", ErrDecryptScheme, opts)
+	}
+
+	if sessionKeyLen == 0 {
+		return RSADecryptBytes(d.dev, d.keyID, ciphertext)
+	}
+
+	if rand == nil {
+		return nil, errors.New("a random source is needed for a session key")
+	}
+
+	key := make([]byte, sessionKeyLen)
+	if _, err := io.ReadFull(rand, key); err != nil {
+		return nil, err
+	}
+
+	// Only a decryption failure is hidden, not a missing key or login
+	plaintext, err := RSADecryptBytes(d.dev, d.keyID, ciphertext)
+	if err != nil && !errors.Is(err, ErrDecStreamFail) {
+		return nil, err
+	}
+
+	if err == nil && len(plaintext) == sessionKeyLen {
+		subtle.ConstantTimeCopy(1, key, plaintext)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,92 @@
+package enigma
+
+// Device is a handle to a token exposing the EnovaMX and MxpXMSS exports.
+// Every package function takes a Device, so callers never need to know
+// whether the token is reached through the Windows DLL or some other
+// implementation.
+//
+// Methods mirror the native exports one to one: buffers are allocated by
+// the caller with the sizes the DLL expects, and a non-zero status code is
+// reported as an error.
+type Device interface {
+	StatusDevice
+	PINDevice
+	AESDevice
+	RSADevice
+	XMSSDevice
+
+	// Release frees the underlying library or backing store.
+	Release() error
+}
+
+// StatusDevice covers the identification exports.
+type StatusDevice interface {
+	// APIVersion wraps MXAPIVersion.
+	APIVersion() (string, error)
+	// DetectDevice wraps mxApiDetectDev and reports whether a token is present.
+	DetectDevice() (bool, error)
+	// ChipSN wraps GetChipSN.
+	ChipSN() ([16]byte, error)
+}
+
+// PINDevice covers the login exports.
+type PINDevice interface {
+	// CheckLoginStatus wraps CheckLoginStatus.
+	CheckLoginStatus() (RETStatus, error)
+	// LoginPIN wraps mxLoginPIN.
+	LoginPIN(pin string) error
+	// ChangePIN wraps mxChangePIN.
+	ChangePIN(newPin string, confirmPin string) error
+}
+
+// AESDevice covers the exports using the token's AES key.
+type AESDevice interface {
+	// AESStreamEncDec wraps AESStreamEncDec. input and output must both hold
+	// at least sectors*512 bytes.
+	AESStreamEncDec(input []byte, output []byte, sectors int, encrypt bool) error
+	// FileAES wraps FileAES.
+	FileAES(sourceFilePath, sourceFileName, targetPath string, encrypt bool) error
+}
+
+// RSADevice covers the exports managing and using RSA key slots. Key and
+// custom IDs are 8 bytes, public key components 256 bytes.
+type RSADevice interface {
+	// GenerateRSAKey wraps generate_rsa_key.
+	GenerateRSAKey(customID, keyID, pubKeyN, pubKeyE []byte) error
+	// StoreExternalPublicKey wraps store_external_public_key.
+	StoreExternalPublicKey(customID, pubKeyN, pubKeyE, keyID []byte) error
+	// SetTransPublicKey wraps set_trans_public_key.
+	SetTransPublicKey(pubKeyN, pubKeyE []byte) error
+	// RSAEncrypt wraps rsa_encrypt. encrypted must hold 256 bytes.
+	RSAEncrypt(keyID, message, encrypted []byte) error
+	// RSADecrypt wraps rsa_decrypt and returns the number of bytes written
+	// to message.
+	RSADecrypt(keyID, cipher, message []byte) (int, error)
+	// RSASign wraps rsa_sign. signature must hold 256 bytes.
+	RSASign(keyID, message, signature []byte) error
+	// RSAVerify wraps rsa_verify.
+	RSAVerify(keyID, message, signature []byte) (bool, error)
+	// DeleteRSAKey wraps delete_rsa_key.
+	DeleteRSAKey(keyID []byte) error
+	// ListAllKeyIDs wraps list_all_key_ids. keyIDs and customIDs must each
+	// hold 16*8 bytes.
+	ListAllKeyIDs(keyIDs, customIDs []byte) (uint8, error)
+	// ResetAllKeys wraps reset_all_keys.
+	ResetAllKeys() error
+}
+
+// XMSSDevice covers the MxpXMSS exports.
+type XMSSDevice interface {
+	// XMSSOpenHandle wraps MxpOpenHandle.
+	XMSSOpenHandle() error
+	// XMSSCloseHandle wraps MxpCloseHandle.
+	XMSSCloseHandle() error
+	// XMSSGetParam wraps MxpGetParam.
+	XMSSGetParam(param *XMSSParam) error
+	// XMSSKeyGen wraps XmssKeyGen.
+	XMSSKeyGen(isXMSSMT bool, oid, skeyFile, pkeyFile string) error
+	// XMSSSign wraps XmssSign.
+	XMSSSign(skeyFile, msgFile, sigFile string) error
+	// XMSSVerify wraps XmssVerify.
+	XMSSVerify(pkeyFile, sigFile, msgFile string) error
+}
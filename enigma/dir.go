@@ -0,0 +1,236 @@
+package enigma
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ManifestName is the file AESSealDir and AESOpenDir write their results to
+// in the target directory, unless DirOptions.Manifest says otherwise.
+const ManifestName = "enigma-manifest.json"
+
+// DirOptions controls AESSealDir and AESOpenDir.
+type DirOptions struct {
+	// Include limits the walk to files matching at least one pattern; all
+	// files are included when it is empty. Exclude skips matching files and
+	// whole directories. Patterns use path.Match syntax and are matched
+	// against the slash-separated path relative to the source directory,
+	// or against the base name if they contain no slash.
+	Include []string
+	Exclude []string
+	// Overwrite replaces existing targets, as in FileOptions.
+	Overwrite bool
+	// Manifest overrides the manifest path.
+	Manifest string
+	// Progress, if set, is called before each file with its relative path.
+	Progress func(path string)
+}
+
+// DirEntry is the outcome for one file of a directory operation.
+type DirEntry struct {
+	Path   string `json:"path"`
+	Target string `json:"target,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DirResult summarizes a directory operation and is what the manifest holds.
+type DirResult struct {
+	Operation string     `json:"operation"`
+	Source    string     `json:"source"`
+	Target    string     `json:"target"`
+	Manifest  string     `json:"-"`
+	Started   time.Time  `json:"started"`
+	Finished  time.Time  `json:"finished"`
+	Succeeded int        `json:"succeeded"`
+	Failed    int        `json:"failed"`
+	Files     []DirEntry `json:"files"`
+}
+
+// Failures returns the entries that failed.
+func (r *DirResult) Failures() []DirEntry {
+	var failures []DirEntry
+	for _, entry := range r.Files {
+		if entry.Error != "" {
+			failures = append(failures, entry)
+		}
+	}
+	return failures
+}
+
+// AESSealDir encrypts every selected file under sourceDir with AESSealFile,
+// mirroring the tree under targetDir with ".emx" appended to each name.
+// Failures of individual files are recorded in the result and the manifest
+// rather than stopping the walk; the error is only set when the walk or the
+// manifest cannot be done at all.
+func AESSealDir(dev Device, sourceDir, targetDir string, opts DirOptions) (*DirResult, error) {
+	return walkDir("encrypt", sourceDir, targetDir, "", opts, func(source, rel string, fileOpts FileOptions) (string, *FileHeader, error) {
+		target := filepath.Join(targetDir, filepath.FromSlash(rel)+containerExtension)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return "", nil, err
+		}
+		return AESSealFile(dev, source, target, fileOpts)
+	})
+}
+
+// AESOpenDir decrypts every selected container under sourceDir with
+// AESOpenFile, mirroring the tree under targetDir and restoring the original
+// file names. Only files ending in ".emx" are considered. Failures are
+// handled as in AESSealDir.
+func AESOpenDir(dev Device, sourceDir, targetDir string, opts DirOptions) (*DirResult, error) {
+	return walkDir("decrypt", sourceDir, targetDir, containerExtension, opts, func(source, rel string, fileOpts FileOptions) (string, *FileHeader, error) {
+		dir := filepath.Join(targetDir, filepath.FromSlash(path.Dir(rel)))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", nil, err
+		}
+		return AESOpenFile(dev, source, dir, fileOpts)
+	})
+}
+
+type dirFileFunc func(source, rel string, opts FileOptions) (string, *FileHeader, error)
+
+// walkDir calls process for every selected regular file under sourceDir
+// whose name ends in suffix, then writes the manifest.
+func walkDir(operation, sourceDir, targetDir, suffix string, opts DirOptions, process dirFileFunc) (*DirResult, error) {
+	info, err := os.Stat(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", sourceDir)
+	}
+
+	for _, pattern := range append(append([]string(nil), opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return nil, err
+	}
+
+	manifest := opts.Manifest
+	if manifest == "" {
+		manifest = filepath.Join(targetDir, ManifestName)
+	}
+
+	result := &DirResult{
+		Operation: operation,
+		Source:    sourceDir,
+		Target:    targetDir,
+		Manifest:  manifest,
+		Started:   time.Now().UTC(),
+		Files:     []DirEntry{},
+	}
+
+	// Never descend into our own output when it lives under the source
+	absTarget, _ := filepath.Abs(targetDir)
+	absManifest, _ := filepath.Abs(manifest)
+
+	fileOpts := FileOptions{Overwrite: opts.Overwrite}
+
+	err = filepath.WalkDir(sourceDir, func(source string, d fs.DirEntry, walkErr error) error {
+		rel, err := filepath.Rel(sourceDir, source)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if walkErr != nil {
+			if source == sourceDir {
+				return walkErr
+			}
+			result.add(DirEntry{Path: rel, Error: walkErr.Error()})
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if abs, _ := filepath.Abs(source); abs == absManifest || (d.IsDir() && abs == absTarget && source != sourceDir) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if source == sourceDir {
+			return nil
+		}
+
+		if matchAny(opts.Exclude, rel) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() || !strings.HasSuffix(rel, suffix) || (len(opts.Include) > 0 && !matchAny(opts.Include, rel)) {
+			return nil
+		}
+
+		if opts.Progress != nil {
+			opts.Progress(rel)
+		}
+
+		target, header, err := process(source, rel, fileOpts)
+		if err != nil {
+			result.add(DirEntry{Path: rel, Error: err.Error()})
+		} else {
+			result.add(DirEntry{Path: rel, Target: target, Size: header.Size, SHA256: header.SHA256})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Finished = time.Now().UTC()
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeAtomic(manifest, true, time.Time{}, func(out io.Writer) error {
+		_, err := out.Write(append(data, '\n'))
+		return err
+	})
+	if err != nil {
+		return result, fmt.Errorf("writing manifest: %w", err)
+	}
+
+	return result, nil
+}
+
+func (r *DirResult) add(entry DirEntry) {
+	if entry.Error != "" {
+		r.Failed++
+	} else {
+		r.Succeeded++
+	}
+	r.Files = append(r.Files, entry)
+}
+
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
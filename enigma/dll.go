@@ -0,0 +1,523 @@
+//go:build windows
+
+package enigma
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// DLLDevice talks to the token through EnovaMX.dll or mxpxmss.dll.
+type DLLDevice struct {
+	dll *syscall.DLL
+}
+
+func (d *DLLDevice) Release() error {
+	return d.dll.Release()
+}
+
+func (d *DLLDevice) APIVersion() (string, error) {
+	versionProc, err := d.dll.FindProc("MXAPIVersion")
+	if err != nil {
+		return "", err
+	}
+
+	r1, _, _ := versionProc.Call()
+	if r1 == 0 {
+		return "", fmt.Errorf("failed to get version")
+	}
+
+	var bytes []byte
+	ptr := (*byte)(unsafe.Pointer(r1))
+	for *ptr != 0 { // Loop until null terminator
+		bytes = append(bytes, *ptr)
+		ptr = (*byte)(unsafe.Pointer(uintptr(unsafe.Pointer(ptr)) + 1))
+	}
+
+	return string(bytes), nil
+}
+
+func (d *DLLDevice) DetectDevice() (bool, error) {
+	detectDeviceProc, err := d.dll.FindProc("mxApiDetectDev")
+	if err != nil {
+		return false, err
+	}
+
+	r1, _, _ := detectDeviceProc.Call()
+	return r1 == 1, nil
+}
+
+func (d *DLLDevice) ChipSN() ([16]byte, error) {
+	uidProc, err := d.dll.FindProc("GetChipSN")
+	if err != nil {
+		return [16]byte{}, err
+	}
+
+	r1, _, _ := uidProc.Call()
+	if r1 == 0 {
+		return [16]byte{}, fmt.Errorf("failed to get UID")
+	}
+
+	var bytes [16]byte
+	ptr := (*[16]byte)(unsafe.Pointer(r1))
+	copy(bytes[:], ptr[:])
+
+	return bytes, nil
+}
+
+func (d *DLLDevice) CheckLoginStatus() (RETStatus, error) {
+	loginStatusProc, err := d.dll.FindProc("CheckLoginStatus")
+	if err != nil {
+		return RETStatus{}, err
+	}
+
+	r1, _, _ := loginStatusProc.Call()
+	if r1 == 0 {
+		return RETStatus{}, fmt.Errorf("Failed to check login status")
+	}
+
+	var status RETStatus
+	*(*uint32)(unsafe.Pointer(&status)) = uint32(r1)
+
+	return status, nil
+}
+
+func (d *DLLDevice) LoginPIN(pin string) error {
+	loginProc, err := d.dll.FindProc("mxLoginPIN")
+	if err != nil {
+		return err
+	}
+
+	pinBytes := append([]byte(pin), 0)
+
+	r1, _, _ := loginProc.Call(
+		uintptr(unsafe.Pointer(&pinBytes[0])),
+	)
+
+	if r1 != 0 {
+		return newStatusError("mxLoginPIN", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) ChangePIN(newPin string, confirmPin string) error {
+	changePinProc, err := d.dll.FindProc("mxChangePIN")
+	if err != nil {
+		return err
+	}
+
+	newPinBytes := append([]byte(newPin), 0)
+	confirmPinBytes := append([]byte(confirmPin), 0)
+
+	r1, _, _ := changePinProc.Call(
+		uintptr(unsafe.Pointer(&newPinBytes[0])),
+		uintptr(unsafe.Pointer(&confirmPinBytes[0])),
+	)
+
+	if r1 != 0 {
+		return newStatusError("mxChangePIN", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) AESStreamEncDec(input []byte, output []byte, sectors int, encrypt bool) error {
+	encDecProc, err := d.dll.FindProc("AESStreamEncDec")
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := encDecProc.Call(
+		uintptr(unsafe.Pointer(&input[0])),
+		uintptr(unsafe.Pointer(&output[0])),
+		uintptr(sectors),
+		boolArg(encrypt),
+	)
+
+	if r1 != 0 {
+		return newStatusError("AESStreamEncDec", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) FileAES(sourceFilePath, sourceFileName, targetPath string, encrypt bool) error {
+	fileAESProc, err := d.dll.FindProc("FileAES")
+	if err != nil {
+		return err
+	}
+
+	sourceFilePathBytes := append([]byte(sourceFilePath), 0)
+	sourceFileNameBytes := append([]byte(sourceFileName), 0)
+	targetPathBytes := append([]byte(targetPath), 0)
+
+	r1, _, _ := fileAESProc.Call(
+		uintptr(unsafe.Pointer(&sourceFilePathBytes[0])),
+		uintptr(unsafe.Pointer(&sourceFileNameBytes[0])),
+		uintptr(unsafe.Pointer(&targetPathBytes[0])),
+		boolArg(encrypt),
+	)
+
+	if r1 != 0 {
+		return newStatusError("FileAES", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) GenerateRSAKey(customID, keyID, pubKeyN, pubKeyE []byte) error {
+	generateKeyProc, err := d.dll.FindProc("generate_rsa_key")
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := generateKeyProc.Call(
+		uintptr(unsafe.Pointer(&customID[0])),
+		uintptr(unsafe.Pointer(&keyID[0])),
+		uintptr(unsafe.Pointer(&pubKeyN[0])),
+		uintptr(unsafe.Pointer(&pubKeyE[0])),
+	)
+
+	if r1 != 0 {
+		return newStatusError("generate_rsa_key", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) StoreExternalPublicKey(customID, pubKeyN, pubKeyE, keyID []byte) error {
+	importKeyProc, err := d.dll.FindProc("store_external_public_key")
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := importKeyProc.Call(
+		uintptr(unsafe.Pointer(&customID[0])),
+		uintptr(unsafe.Pointer(&pubKeyN[0])),
+		uintptr(unsafe.Pointer(&pubKeyE[0])),
+		uintptr(unsafe.Pointer(&keyID[0])),
+	)
+
+	if r1 != 0 {
+		return newStatusError("store_external_public_key", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) SetTransPublicKey(pubKeyN, pubKeyE []byte) error {
+	setTransKeyProc, err := d.dll.FindProc("set_trans_public_key")
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := setTransKeyProc.Call(
+		uintptr(unsafe.Pointer(&pubKeyN[0])),
+		uintptr(unsafe.Pointer(&pubKeyE[0])),
+	)
+
+	if r1 != 0 {
+		return newStatusError("set_trans_public_key", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) RSAEncrypt(keyID, message, encrypted []byte) error {
+	rsaEncryptProc, err := d.dll.FindProc("rsa_encrypt")
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := rsaEncryptProc.Call(
+		uintptr(unsafe.Pointer(&keyID[0])),
+		uintptr(unsafe.Pointer(&message[0])),
+		uintptr(len(message)),
+		uintptr(unsafe.Pointer(&encrypted[0])),
+	)
+
+	if r1 != 0 {
+		return newStatusError("rsa_encrypt", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) RSADecrypt(keyID, cipher, message []byte) (int, error) {
+	rsaDecryptProc, err := d.dll.FindProc("rsa_decrypt")
+	if err != nil {
+		return 0, err
+	}
+
+	messageLength := 0
+
+	r1, _, _ := rsaDecryptProc.Call(
+		uintptr(unsafe.Pointer(&keyID[0])),
+		uintptr(unsafe.Pointer(&cipher[0])),
+		uintptr(unsafe.Pointer(&message[0])),
+		uintptr(unsafe.Pointer(&messageLength)),
+	)
+
+	if r1 != 0 {
+		return 0, newStatusError("rsa_decrypt", uint8(r1))
+	}
+
+	return messageLength, nil
+}
+
+func (d *DLLDevice) RSASign(keyID, message, signature []byte) error {
+	signProc, err := d.dll.FindProc("rsa_sign")
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := signProc.Call(
+		uintptr(unsafe.Pointer(&keyID[0])),
+		uintptr(unsafe.Pointer(&message[0])),
+		uintptr(len(message)),
+		uintptr(unsafe.Pointer(&signature[0])),
+	)
+
+	if r1 != 0 {
+		return newStatusError("rsa_sign", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) RSAVerify(keyID, message, signature []byte) (bool, error) {
+	verifyProc, err := d.dll.FindProc("rsa_verify")
+	if err != nil {
+		return false, err
+	}
+
+	var result byte
+
+	r1, _, _ := verifyProc.Call(
+		uintptr(unsafe.Pointer(&keyID[0])),
+		uintptr(unsafe.Pointer(&message[0])),
+		uintptr(len(message)),
+		uintptr(unsafe.Pointer(&signature[0])),
+		uintptr(unsafe.Pointer(&result)),
+	)
+
+	if r1 != 0 {
+		return false, newStatusError("rsa_verify", uint8(r1))
+	}
+
+	return result == 1, nil
+}
+
+func (d *DLLDevice) DeleteRSAKey(keyID []byte) error {
+	deleteKeyProc, err := d.dll.FindProc("delete_rsa_key")
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := deleteKeyProc.Call(
+		uintptr(unsafe.Pointer(&keyID[0])),
+	)
+
+	if r1 != 0 {
+		return newStatusError("delete_rsa_key", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) ListAllKeyIDs(keyIDs, customIDs []byte) (uint8, error) {
+	listKeysProc, err := d.dll.FindProc("list_all_key_ids")
+	if err != nil {
+		return 0, err
+	}
+
+	var keyCount uint8
+
+	r1, _, _ := listKeysProc.Call(
+		uintptr(unsafe.Pointer(&keyCount)),
+		uintptr(unsafe.Pointer(&keyIDs[0])),
+		uintptr(unsafe.Pointer(&customIDs[0])),
+	)
+
+	if r1 != 0 {
+		return 0, newStatusError("list_all_key_ids", uint8(r1))
+	}
+
+	return keyCount, nil
+}
+
+func (d *DLLDevice) ResetAllKeys() error {
+	resetKeysProc, err := d.dll.FindProc("reset_all_keys")
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := resetKeysProc.Call()
+
+	if r1 != 0 {
+		return newStatusError("reset_all_keys", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) XMSSOpenHandle() error {
+	proc, err := d.dll.FindProc("MxpOpenHandle")
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := proc.Call()
+	if r1 != 0 {
+		return newStatusError("MxpOpenHandle", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) XMSSCloseHandle() error {
+	proc, err := d.dll.FindProc("MxpCloseHandle")
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := proc.Call()
+	if r1 != 0 {
+		return newStatusError("MxpCloseHandle", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) XMSSGetParam(param *XMSSParam) error {
+	proc, err := d.dll.FindProc("MxpGetParam")
+	if err != nil {
+		return err
+	}
+
+	var raw struct {
+		Index      [8]byte
+		XMSSID     byte
+		IndexBytes byte
+	}
+
+	r1, _, _ := proc.Call(uintptr(unsafe.Pointer(&raw)))
+	if r1 != 0 {
+		return newStatusError("MxpGetParam", uint8(r1))
+	}
+
+	param.Index = raw.Index
+	param.XMSSID = raw.XMSSID
+	param.IndexBytes = raw.IndexBytes
+
+	return nil
+}
+
+func (d *DLLDevice) XMSSKeyGen(isXMSSMT bool, oid, skeyFile, pkeyFile string) error {
+	proc, err := d.dll.FindProc("XmssKeyGen")
+	if err != nil {
+		return err
+	}
+
+	oidPtr, err := syscall.BytePtrFromString(oid)
+	if err != nil {
+		return err
+	}
+	skPtr, err := syscall.BytePtrFromString(skeyFile)
+	if err != nil {
+		return err
+	}
+	pkPtr, err := syscall.BytePtrFromString(pkeyFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(oidPtr)
+
+	r1, _, _ := proc.Call(
+		boolArg(isXMSSMT),
+		uintptr(unsafe.Pointer(oidPtr)),
+		uintptr(unsafe.Pointer(skPtr)),
+		uintptr(unsafe.Pointer(pkPtr)),
+	)
+	if r1 != 0 {
+		fmt.Println("Error in XMSSKeyGen")
+		fmt.Println(uint8(r1))
+		return newStatusError("XmssKeyGen", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) XMSSSign(skeyFile, msgFile, sigFile string) error {
+	proc, err := d.dll.FindProc("XmssSign")
+	if err != nil {
+		return err
+	}
+
+	skPtr, err := syscall.BytePtrFromString(skeyFile)
+	if err != nil {
+		return err
+	}
+	msgPtr, err := syscall.BytePtrFromString(msgFile)
+	if err != nil {
+		return err
+	}
+	sigPtr, err := syscall.BytePtrFromString(sigFile)
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := proc.Call(
+		uintptr(unsafe.Pointer(skPtr)),
+		uintptr(unsafe.Pointer(msgPtr)),
+		uintptr(unsafe.Pointer(sigPtr)),
+	)
+	if r1 != 0 {
+		return newStatusError("XmssSign", uint8(r1))
+	}
+
+	return nil
+}
+
+func (d *DLLDevice) XMSSVerify(pkeyFile, sigFile, msgFile string) error {
+	proc, err := d.dll.FindProc("XmssVerify")
+	if err != nil {
+		return err
+	}
+
+	pkPtr, err := syscall.BytePtrFromString(pkeyFile)
+	if err != nil {
+		return err
+	}
+	sigPtr, err := syscall.BytePtrFromString(sigFile)
+	if err != nil {
+		return err
+	}
+	msgPtr, err := syscall.BytePtrFromString(msgFile)
+	if err != nil {
+		return err
+	}
+
+	r1, _, _ := proc.Call(
+		uintptr(unsafe.Pointer(pkPtr)),
+		uintptr(unsafe.Pointer(sigPtr)),
+		uintptr(unsafe.Pointer(msgPtr)),
+	)
+	// print r1
+	fmt.Println(uint8(r1))
+	if r1 != 0 {
+		return newStatusError("XmssVerify", uint8(r1))
+	}
+
+	return nil
+}
+
+func boolArg(b bool) uintptr {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,313 @@
+package enigma
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// An AES envelope is a 16-byte header followed by one or more segments:
+//
+//	magic "ENMX" | version (1) | random nonce prefix (11)
+//	segment 0 | segment 1 | ... | final segment
+//
+// Each segment is AES-GCM over the device key of up to envelopeSegmentSize
+// plaintext bytes, with the header as additional data and the 16-byte nonce
+// prefix | segment index (uint32, big-endian) | final flag (0 or 1). All
+// segments but the final one are full, and the final one may be empty, so
+// reordered, truncated or extended envelopes fail authentication.
+const (
+	envelopeVersion     = 1
+	envelopeHeaderSize  = 16
+	envelopeSegmentSize = 64 * 1024
+	envelopeTagSize     = 16
+)
+
+var envelopeMagic = []byte("ENMX")
+
+// ErrEnvelopeFormat is returned when the input does not start with a
+// supported AES envelope header, as is the case for raw AESEncrypt output.
+var ErrEnvelopeFormat = errors.New("not an AES envelope or unsupported envelope version")
+
+// ErrEnvelopeAuth is returned when an AES envelope fails authentication
+// because it was modified, truncated or encrypted under another key.
+var ErrEnvelopeAuth = errors.New("AES envelope authentication failed")
+
+func newEnvelopeAEAD(dev Device) (*aesGCM, error) {
+	aead, err := NewAESBlock(dev).NewGCM(envelopeHeaderSize, envelopeTagSize)
+	if err != nil {
+		return nil, err
+	}
+	return aead.(*aesGCM), nil
+}
+
+// segmentAEAD seals the segments of an envelope. Open returns errGCMOpen
+// when authentication fails.
+type segmentAEAD interface {
+	seal(dst, nonce, plaintext, additionalData []byte) ([]byte, error)
+	Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error)
+}
+
+// envelopeNonce returns the nonce of a segment, starting with the 11-byte
+// prefix.
+func envelopeNonce(prefix []byte, index uint32, final bool) []byte {
+	nonce := make([]byte, 16)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[11:], index)
+	if final {
+		nonce[15] = 1
+	}
+	return nonce
+}
+
+type aesSealWriter struct {
+	aead    segmentAEAD
+	w       io.Writer
+	header  []byte
+	prefix  []byte
+	index   uint32
+	pending []byte
+	sealed  []byte
+	err     error
+	closed  bool
+}
+
+// NewAESSealWriter writes an AES envelope header to w and returns a writer
+// that encrypts and authenticates everything written to it, one segment at
+// a time. Close writes the final segment; it does not close w.
+func NewAESSealWriter(dev Device, w io.Writer) (io.WriteCloser, error) {
+	aead, err := newEnvelopeAEAD(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, envelopeHeaderSize)
+	copy(header, envelopeMagic)
+	header[4] = envelopeVersion
+	if _, err := rand.Read(header[5:]); err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return newSegmentWriter(aead, w, header, header[5:]), nil
+}
+
+// newSegmentWriter returns a writer sealing segments to w after a header
+// that has already been written.
+func newSegmentWriter(aead segmentAEAD, w io.Writer, header, prefix []byte) *aesSealWriter {
+	return &aesSealWriter{
+		aead:    aead,
+		w:       w,
+		header:  header,
+		prefix:  prefix,
+		pending: make([]byte, 0, envelopeSegmentSize),
+		sealed:  make([]byte, 0, envelopeSegmentSize+envelopeTagSize),
+	}
+}
+
+func (s *aesSealWriter) Write(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.closed {
+		return 0, errors.New("write to closed AES seal writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full segment is only sealed once more data arrives, since the
+		// final segment must carry the final flag.
+		if len(s.pending) == envelopeSegmentSize {
+			if err := s.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := copy(s.pending[len(s.pending):cap(s.pending)], p)
+		s.pending = s.pending[:len(s.pending)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+func (s *aesSealWriter) Close() error {
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+
+	if s.err != nil {
+		return s.err
+	}
+
+	return s.seal(true)
+}
+
+func (s *aesSealWriter) seal(final bool) error {
+	if !final && s.index == ^uint32(0) {
+		s.err = errors.New("AES envelope exceeds the maximum number of segments")
+		return s.err
+	}
+
+	sealed, err := s.aead.seal(s.sealed[:0], envelopeNonce(s.prefix, s.index, final), s.pending, s.header)
+	if err != nil {
+		s.err = err
+		return err
+	}
+
+	s.sealed = sealed
+	s.pending = s.pending[:0]
+	s.index++
+
+	if _, err := s.w.Write(s.sealed); err != nil {
+		s.err = err
+		return err
+	}
+
+	return nil
+}
+
+type aesOpenReader struct {
+	aead    segmentAEAD
+	authErr error
+	r       io.Reader
+	header  []byte
+	prefix  []byte
+	index   uint32
+	buf     []byte
+	opened  []byte
+	ready   []byte
+	eof     bool
+	err     error
+}
+
+// NewAESOpenReader reads an AES envelope header from r and returns a reader
+// that authenticates and decrypts the envelope one segment at a time. Data
+// from a segment is only returned once its tag has been verified; a
+// modified or truncated envelope fails with ErrEnvelopeAuth.
+func NewAESOpenReader(dev Device, r io.Reader) (io.Reader, error) {
+	header := make([]byte, envelopeHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrEnvelopeFormat
+		}
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:4], envelopeMagic) || header[4] != envelopeVersion {
+		return nil, ErrEnvelopeFormat
+	}
+
+	aead, err := newEnvelopeAEAD(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSegmentReader(aead, r, header, header[5:], ErrEnvelopeAuth), nil
+}
+
+// newSegmentReader returns a reader opening the segments that follow header
+// in r, failing with authErr on any that do not authenticate.
+func newSegmentReader(aead segmentAEAD, r io.Reader, header, prefix []byte, authErr error) *aesOpenReader {
+	return &aesOpenReader{
+		aead:    aead,
+		authErr: authErr,
+		r:       r,
+		header:  header,
+		prefix:  prefix,
+		// One byte of look-ahead tells a full segment from the final one
+		buf:    make([]byte, 0, envelopeSegmentSize+envelopeTagSize+1),
+		opened: make([]byte, 0, envelopeSegmentSize),
+	}
+}
+
+func (o *aesOpenReader) Read(p []byte) (int, error) {
+	for len(o.ready) == 0 {
+		if o.err != nil {
+			return 0, o.err
+		}
+		o.err = o.fill()
+	}
+
+	n := copy(p, o.ready)
+	o.ready = o.ready[n:]
+	return n, nil
+}
+
+func (o *aesOpenReader) fill() error {
+	for !o.eof && len(o.buf) < cap(o.buf) {
+		n, err := o.r.Read(o.buf[len(o.buf):cap(o.buf)])
+		o.buf = o.buf[:len(o.buf)+n]
+		if err == io.EOF {
+			o.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	segment := o.buf
+	if !o.eof {
+		segment = o.buf[:envelopeSegmentSize+envelopeTagSize]
+	}
+
+	opened, err := o.aead.Open(o.opened[:0], envelopeNonce(o.prefix, o.index, o.eof), segment, o.header)
+	if err == errGCMOpen {
+		return o.authErr
+	} else if err != nil {
+		return err
+	}
+
+	o.ready = opened
+	o.index++
+
+	if o.eof {
+		return io.EOF
+	}
+
+	o.buf = o.buf[:copy(o.buf, o.buf[len(segment):])]
+	return nil
+}
+
+// AESSeal encrypts and authenticates plaintext into an AES envelope. Unlike
+// AESEncryptBytes the result is randomized, so equal plaintexts give
+// different envelopes.
+func AESSeal(dev Device, plaintext []byte) ([]byte, error) {
+	var envelope bytes.Buffer
+
+	w, err := NewAESSealWriter(dev, &envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return envelope.Bytes(), nil
+}
+
+// AESOpen authenticates and decrypts an envelope produced by AESSeal.
+func AESOpen(dev Device, envelope []byte) ([]byte, error) {
+	r, err := NewAESOpenReader(dev, bytes.NewReader(envelope))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return plaintext, nil
+}
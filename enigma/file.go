@@ -0,0 +1,364 @@
+package enigma
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A file container is a short clear-text header followed by an AES envelope:
+//
+//	magic "EMXF" | version (1) | device UID (16)
+//	envelope of: metadata length (uint32, big-endian) | metadata JSON | content
+//
+// The metadata is a FileHeader. Only the device UID is readable without the
+// device, so that a file from another token can be reported as such; it is
+// repeated in the authenticated metadata.
+const (
+	containerVersion     = 1
+	containerHeaderSize  = 21
+	containerMaxMetadata = 64 * 1024
+	containerExtension   = ".emx"
+)
+
+var containerMagic = []byte("EMXF")
+
+// ErrContainerFormat is returned when a file is not an encrypted file
+// container.
+var ErrContainerFormat = errors.New("not an encrypted file container or unsupported container version")
+
+// ErrContainerDevice is returned when a container was encrypted on another
+// device.
+var ErrContainerDevice = errors.New("file was encrypted on another device")
+
+// ErrContainerChecksum is returned when decrypted content does not match the
+// size and SHA-256 checksum recorded at encryption time.
+var ErrContainerChecksum = errors.New("decrypted file does not match its checksum")
+
+// FileHeader is the metadata stored in a file container.
+type FileHeader struct {
+	Name      string      `json:"name"`
+	Size      int64       `json:"size"`
+	ModTime   time.Time   `json:"mtime"`
+	Mode      os.FileMode `json:"mode"`
+	DeviceUID string      `json:"device_uid"`
+	SHA256    string      `json:"sha256"`
+}
+
+// FileOptions controls AESSealFile and AESOpenFile.
+type FileOptions struct {
+	// Overwrite replaces an existing target instead of failing with
+	// ErrTargetFileExists.
+	Overwrite bool
+	// Progress, if set, is called as content is processed with the number
+	// of plaintext bytes done so far and the total.
+	Progress func(done, total int64)
+}
+
+// AESSealFile encrypts sourcePath into a file container and returns the path
+// written along with the stored metadata. targetPath may name the container
+// or an existing directory to place it in; if empty, the container is
+// written next to the source. Either way the default name is the source name
+// with ".emx" appended. The container is written to a temporary file and
+// renamed into place, so the target never holds partial output.
+func AESSealFile(dev Device, sourcePath, targetPath string, opts FileOptions) (string, *FileHeader, error) {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil, fmt.Errorf("%s is not a regular file", sourcePath)
+	}
+
+	target, err := resolveTarget(targetPath, filepath.Dir(sourcePath), info.Name()+containerExtension)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := checkTarget(target, opts.Overwrite); err != nil {
+		return "", nil, err
+	}
+
+	uid, err := dev.ChipSN()
+	if err != nil {
+		return "", nil, err
+	}
+
+	// The checksum belongs in the metadata at the front of the envelope, so
+	// the source is hashed before it is encrypted.
+	checksum := sha256.New()
+	if _, err := io.Copy(checksum, source); err != nil {
+		return "", nil, err
+	}
+	if _, err := source.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+
+	header := &FileHeader{
+		Name:      info.Name(),
+		Size:      info.Size(),
+		ModTime:   info.ModTime().UTC(),
+		Mode:      info.Mode().Perm(),
+		DeviceUID: hex.EncodeToString(uid[:]),
+		SHA256:    hex.EncodeToString(checksum.Sum(nil)),
+	}
+
+	metadata, err := json.Marshal(header)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = writeAtomic(target, opts.Overwrite, time.Time{}, func(out io.Writer) error {
+		prefix := make([]byte, 0, containerHeaderSize)
+		prefix = append(prefix, containerMagic...)
+		prefix = append(prefix, containerVersion)
+		prefix = append(prefix, uid[:]...)
+		if _, err := out.Write(prefix); err != nil {
+			return err
+		}
+
+		w, err := NewAESSealWriter(dev, out)
+		if err != nil {
+			return err
+		}
+
+		if err := binary.Write(w, binary.BigEndian, uint32(len(metadata))); err != nil {
+			return err
+		}
+		if _, err := w.Write(metadata); err != nil {
+			return err
+		}
+
+		// Hash again while encrypting to catch changes since the first pass
+		recheck := sha256.New()
+		progress := &progressReader{r: io.TeeReader(source, recheck), total: header.Size, fn: opts.Progress}
+		if _, err := io.Copy(w, progress); err != nil {
+			return err
+		}
+
+		if progress.done != header.Size || hex.EncodeToString(recheck.Sum(nil)) != header.SHA256 {
+			return fmt.Errorf("%s changed while it was being encrypted", sourcePath)
+		}
+
+		return w.Close()
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return target, header, nil
+}
+
+// AESOpenFile decrypts a file container from AESSealFile and returns the path
+// written along with the stored metadata. targetPath may name the output
+// file or an existing directory to place it in; if empty, the file is
+// written next to the container. Either way the default name is the one
+// recorded in the container. The content is checked against the stored size
+// and checksum before the output is renamed into place, and its modification
+// time and permissions are restored.
+func AESOpenFile(dev Device, sourcePath, targetPath string, opts FileOptions) (string, *FileHeader, error) {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer source.Close()
+
+	prefix := make([]byte, containerHeaderSize)
+	if _, err := io.ReadFull(source, prefix); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return "", nil, ErrContainerFormat
+		}
+		return "", nil, err
+	}
+	if !bytes.Equal(prefix[:4], containerMagic) || prefix[4] != containerVersion {
+		return "", nil, ErrContainerFormat
+	}
+
+	uid, err := dev.ChipSN()
+	if err != nil {
+		return "", nil, err
+	}
+	if !bytes.Equal(prefix[5:], uid[:]) {
+		return "", nil, fmt.Errorf("%w: %x", ErrContainerDevice, prefix[5:])
+	}
+
+	r, err := NewAESOpenReader(dev, source)
+	if err != nil {
+		return "", nil, err
+	}
+
+	header, err := readFileHeader(r)
+	if err != nil {
+		return "", nil, err
+	}
+	if header.DeviceUID != hex.EncodeToString(uid[:]) {
+		return "", nil, fmt.Errorf("%w: %s", ErrContainerDevice, header.DeviceUID)
+	}
+
+	// The stored name is only used as a file name, never as a path
+	name := filepath.Base(header.Name)
+	if name == "." || name == ".." || name == string(filepath.Separator) || name != header.Name {
+		return "", nil, fmt.Errorf("container holds an invalid file name %q", header.Name)
+	}
+
+	target, err := resolveTarget(targetPath, filepath.Dir(sourcePath), name)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := checkTarget(target, opts.Overwrite); err != nil {
+		return "", nil, err
+	}
+
+	err = writeAtomic(target, opts.Overwrite, header.ModTime, func(out io.Writer) error {
+		checksum := sha256.New()
+		progress := &progressReader{r: r, total: header.Size, fn: opts.Progress}
+		if _, err := io.Copy(io.MultiWriter(out, checksum), progress); err != nil {
+			return err
+		}
+
+		if progress.done != header.Size || hex.EncodeToString(checksum.Sum(nil)) != header.SHA256 {
+			return ErrContainerChecksum
+		}
+
+		if f, ok := out.(*os.File); ok {
+			return f.Chmod(header.Mode.Perm())
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return target, header, nil
+}
+
+func readFileHeader(r io.Reader) (*FileHeader, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, containerReadError(err)
+	}
+	if length > containerMaxMetadata {
+		return nil, ErrContainerFormat
+	}
+
+	metadata := make([]byte, length)
+	if _, err := io.ReadFull(r, metadata); err != nil {
+		return nil, containerReadError(err)
+	}
+
+	var header FileHeader
+	if err := json.Unmarshal(metadata, &header); err != nil {
+		return nil, ErrContainerFormat
+	}
+
+	return &header, nil
+}
+
+// containerReadError maps an envelope that authenticates but ends early to
+// ErrContainerFormat.
+func containerReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrContainerFormat
+	}
+	return err
+}
+
+// resolveTarget returns targetPath, or name inside it if it is a directory,
+// or name inside defaultDir if it is empty.
+func resolveTarget(targetPath, defaultDir, name string) (string, error) {
+	if targetPath == "" {
+		return filepath.Join(defaultDir, name), nil
+	}
+
+	info, err := os.Stat(targetPath)
+	if err == nil && info.IsDir() {
+		return filepath.Join(targetPath, name), nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	return targetPath, nil
+}
+
+func checkTarget(target string, overwrite bool) error {
+	if overwrite {
+		return nil
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		return fmt.Errorf("%s already exists: %w", target, ErrTargetFileExists)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// writeAtomic calls write with a temporary file next to target and renames
+// it over target once write succeeds, setting its modification time first
+// unless modTime is zero. The temporary file is removed on failure.
+func writeAtomic(target string, overwrite bool, modTime time.Time, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if !modTime.IsZero() {
+		if err := os.Chtimes(tmp.Name(), modTime, modTime); err != nil {
+			return err
+		}
+	}
+
+	// Check again in case the target appeared while writing
+	if err := checkTarget(target, overwrite); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+// progressReader counts the bytes read through it and reports them to fn.
+type progressReader struct {
+	r     io.Reader
+	done  int64
+	total int64
+	fn    func(done, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if p.fn != nil && n > 0 {
+		p.fn(p.done, p.total)
+	}
+	return n, err
+}
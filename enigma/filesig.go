@@ -0,0 +1,228 @@
+package enigma
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+)
+
+// rsa_sign hashes whatever it is given with SHA-256 and cannot sign a
+// digest, and passing a whole file through it is slow. Files are therefore
+// hashed in software, and the device signs a short statement naming the
+// digest, the key and the time:
+//
+//	enigma-file-signature v1
+//	hash SHA-512
+//	digest <hex digest of the file>
+//	size <bytes>
+//	key <key ID>
+//	fingerprint <hex SHA-256 of the PKIX public key>
+//	time <RFC 3339 UTC>
+//
+// The statement is signed with PKCS#1 v1.5 and SHA-256 like any device
+// signature, so it verifies with rsa_verify or with the public key alone.
+// The signature is kept in a detached JSON file holding the same fields.
+const (
+	fileSignatureVersion   = 1
+	fileSignatureAlgorithm = "RSASSA-PKCS1-v1_5-SHA256"
+
+	// FileSignatureExt is appended to a file name for its detached
+	// signature.
+	FileSignatureExt = ".sig"
+)
+
+// ErrFileSignatureFormat is returned for signature files that are not
+// valid or use an unsupported version or algorithm.
+var ErrFileSignatureFormat = errors.New("not a file signature or unsupported signature version")
+
+// FileSignature is a detached signature of a file, as written to its .sig
+// file. Digest is the hex digest of the file with Hash.
+type FileSignature struct {
+	Version     int       `json:"version"`
+	Algorithm   string    `json:"algorithm"`
+	Hash        string    `json:"hash"`
+	Digest      string    `json:"digest"`
+	Size        int64     `json:"size"`
+	KeyID       string    `json:"key_id"`
+	Fingerprint string    `json:"fingerprint"`
+	Timestamp   time.Time `json:"timestamp"`
+	Signature   []byte    `json:"signature"`
+}
+
+var fileHashes = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// ParseFileHash returns the hash named sha256, sha384 or sha512, also
+// written SHA-256 and so on.
+func ParseFileHash(name string) (crypto.Hash, error) {
+	normalized := strings.ReplaceAll(strings.ToUpper(name), "-", "")
+	for _, h := range fileHashes {
+		if strings.ReplaceAll(h.String(), "-", "") == normalized {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported hash %q, expected sha256, sha384 or sha512", name)
+}
+
+func newFileHash(h crypto.Hash) (hash.Hash, error) {
+	switch h {
+	case crypto.SHA256:
+		return sha256.New(), nil
+	case crypto.SHA384:
+		return sha512.New384(), nil
+	case crypto.SHA512:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash %v, expected SHA-256, SHA-384 or SHA-512", h)
+	}
+}
+
+// SignFile hashes everything read from r with h and signs the digest on
+// the device with the key of signer.
+func SignFile(signer *RSASigner, r io.Reader, h crypto.Hash) (*FileSignature, error) {
+	digest, size, err := hashFile(h, r)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints, err := Fingerprints(signer.pub)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := &FileSignature{
+		Version:     fileSignatureVersion,
+		Algorithm:   fileSignatureAlgorithm,
+		Hash:        h.String(),
+		Digest:      hex.EncodeToString(digest),
+		Size:        size,
+		KeyID:       signer.KeyID(),
+		Fingerprint: fingerprints.SHA256,
+		Timestamp:   time.Now().UTC().Truncate(time.Second),
+	}
+
+	sig.Signature, err = signer.SignMessage(nil, sig.statement(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return sig, nil
+}
+
+// ParseFileSignature parses the JSON of a .sig file.
+func ParseFileSignature(data []byte) (*FileSignature, error) {
+	var sig FileSignature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFileSignatureFormat, err)
+	}
+
+	if sig.Version != fileSignatureVersion || sig.Algorithm != fileSignatureAlgorithm {
+		return nil, ErrFileSignatureFormat
+	}
+	if _, err := ParseFileHash(sig.Hash); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFileSignatureFormat, err)
+	}
+
+	return &sig, nil
+}
+
+// Marshal returns the JSON of the .sig file.
+func (s *FileSignature) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Verify checks the signature in software with pub, then that everything
+// read from r matches the signed digest. It returns an error if pub is not
+// the key the signature names.
+func (s *FileSignature) Verify(r io.Reader, pub *rsa.PublicKey) (bool, error) {
+	fingerprints, err := Fingerprints(pub)
+	if err != nil {
+		return false, err
+	}
+	if fingerprints.SHA256 != s.Fingerprint {
+		return false, fmt.Errorf("signed by the key with fingerprint %s, not %s", s.Fingerprint, fingerprints.SHA256)
+	}
+
+	if !VerifyBytesOffline(pub, s.statement(), s.Signature) {
+		return false, nil
+	}
+
+	return s.matches(r)
+}
+
+// VerifyOnDevice checks the signature with rsa_verify and the key keyID,
+// then that everything read from r matches the signed digest. keyID may
+// differ from the key ID in the signature, such as for a public key
+// imported on another device.
+func (s *FileSignature) VerifyOnDevice(dev Device, keyID string, r io.Reader) (bool, error) {
+	keyIDBytes := make([]byte, 8)
+	copy(keyIDBytes, []byte(keyID))
+
+	valid, err := dev.RSAVerify(keyIDBytes, s.statement(), s.Signature)
+	if err != nil || !valid {
+		return false, err
+	}
+
+	return s.matches(r)
+}
+
+// matches reports whether r has the signed size and digest.
+func (s *FileSignature) matches(r io.Reader) (bool, error) {
+	h, err := ParseFileHash(s.Hash)
+	if err != nil {
+		return false, err
+	}
+
+	digest, size, err := hashFile(h, r)
+	if err != nil {
+		return false, err
+	}
+
+	want, err := hex.DecodeString(s.Digest)
+	if err != nil {
+		return false, nil
+	}
+
+	return size == s.Size && subtle.ConstantTimeCompare(digest, want) == 1, nil
+}
+
+// statement returns the message the device signs.
+func (s *FileSignature) statement() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "enigma-file-signature v%d\n", s.Version)
+	fmt.Fprintf(&b, "hash %s\n", s.Hash)
+	fmt.Fprintf(&b, "digest %s\n", s.Digest)
+	fmt.Fprintf(&b, "size %d\n", s.Size)
+	fmt.Fprintf(&b, "key %s\n", s.KeyID)
+	fmt.Fprintf(&b, "fingerprint %s\n", s.Fingerprint)
+	fmt.Fprintf(&b, "time %s\n", s.Timestamp.UTC().Format(time.RFC3339))
+	return b.Bytes()
+}
+
+func hashFile(h crypto.Hash, r io.Reader) ([]byte, int64, error) {
+	hasher, err := newFileHash(h)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := io.Copy(hasher, r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return hasher.Sum(nil), size, nil
+}
@@ -0,0 +1,241 @@
+package enigma
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// aesGCM implements GCM (NIST SP 800-38D) over an AESBlock. The counter mode
+// keystream, including the block that masks the tag, is generated in batched
+// device calls, while GHASH runs in Go with the hash key fetched once.
+type aesGCM struct {
+	b         *AESBlock
+	h         gcmFieldElement
+	nonceSize int
+	tagSize   int
+}
+
+// gcmFieldElement is an element of GF(2^128) in GCM bit order, where the
+// most significant bit of hi is the coefficient of x^0.
+type gcmFieldElement struct {
+	hi, lo uint64
+}
+
+var errGCMOpen = errors.New("cipher: message authentication failed")
+
+// NewGCM returns GCM with the given nonce and tag sizes. cipher.NewGCM and
+// its variants use it automatically.
+func (b *AESBlock) NewGCM(nonceSize, tagSize int) (cipher.AEAD, error) {
+	if tagSize < 12 || tagSize > 16 {
+		return nil, errors.New("cipher: incorrect tag size given to GCM")
+	}
+	if nonceSize <= 0 {
+		return nil, errors.New("cipher: the nonce can't have zero length")
+	}
+
+	var h [16]byte
+	if err := b.EncryptBlocks(h[:], h[:]); err != nil {
+		return nil, err
+	}
+
+	return &aesGCM{
+		b:         b,
+		h:         loadFieldElement(h[:]),
+		nonceSize: nonceSize,
+		tagSize:   tagSize,
+	}, nil
+}
+
+func (g *aesGCM) NonceSize() int {
+	return g.nonceSize
+}
+
+func (g *aesGCM) Overhead() int {
+	return g.tagSize
+}
+
+func (g *aesGCM) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	ret, err := g.seal(dst, nonce, plaintext, additionalData)
+	mustCrypt(err)
+	return ret
+}
+
+// seal is Seal returning device errors rather than panicking on them.
+func (g *aesGCM) seal(dst, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != g.nonceSize {
+		panic("crypto/cipher: incorrect nonce length given to GCM")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+g.tagSize)
+	ciphertext, tag := out[:len(plaintext)], out[len(plaintext):]
+
+	tagMask, err := g.crypt(ciphertext, plaintext, g.deriveCounter(nonce))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := g.ghash(additionalData, ciphertext)
+	subtle.XORBytes(tag, sum[:g.tagSize], tagMask[:g.tagSize])
+
+	return ret, nil
+}
+
+func (g *aesGCM) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != g.nonceSize {
+		panic("crypto/cipher: incorrect nonce length given to GCM")
+	}
+	if len(ciphertext) < g.tagSize {
+		return nil, errGCMOpen
+	}
+
+	tag := ciphertext[len(ciphertext)-g.tagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-g.tagSize]
+
+	// Hash before decrypting, since out may overwrite ciphertext
+	sum := g.ghash(additionalData, ciphertext)
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	tagMask, err := g.crypt(out, ciphertext, g.deriveCounter(nonce))
+	if err != nil {
+		return nil, err
+	}
+
+	subtle.XORBytes(sum[:], sum[:], tagMask[:])
+	if subtle.ConstantTimeCompare(sum[:g.tagSize], tag) != 1 {
+		clear(out)
+		return nil, errGCMOpen
+	}
+
+	return ret, nil
+}
+
+// crypt XORs in with the keystream starting at inc32(j0) and returns the
+// encryption of j0 itself, which masks the tag. Both come out of the same
+// batches, so short messages cost a single device call.
+func (g *aesGCM) crypt(out, in []byte, j0 [16]byte) ([16]byte, error) {
+	var tagMask [16]byte
+
+	ctr := j0
+	buf := make([]byte, min((len(in)+15)/16*16+16, streamBatchSize))
+
+	for first := true; first || len(in) > 0; first = false {
+		size := (len(in) + 15) / 16 * 16
+		if first {
+			size += 16
+		}
+		keystream := buf[:min(size, len(buf))]
+
+		if err := g.b.counterKeystream(keystream, &ctr, inc32); err != nil {
+			return tagMask, err
+		}
+
+		if first {
+			copy(tagMask[:], keystream)
+			keystream = keystream[16:]
+		}
+
+		n := subtle.XORBytes(out, in, keystream)
+		out, in = out[n:], in[n:]
+	}
+
+	return tagMask, nil
+}
+
+func (g *aesGCM) deriveCounter(nonce []byte) [16]byte {
+	var j0 [16]byte
+	if len(nonce) == 12 {
+		copy(j0[:], nonce)
+		j0[15] = 1
+		return j0
+	}
+
+	var y gcmFieldElement
+	g.update(&y, nonce)
+	y.lo ^= uint64(len(nonce)) * 8
+	y = g.mul(y)
+
+	binary.BigEndian.PutUint64(j0[:8], y.hi)
+	binary.BigEndian.PutUint64(j0[8:], y.lo)
+	return j0
+}
+
+func (g *aesGCM) ghash(additionalData, ciphertext []byte) [16]byte {
+	var y gcmFieldElement
+	g.update(&y, additionalData)
+	g.update(&y, ciphertext)
+
+	y.hi ^= uint64(len(additionalData)) * 8
+	y.lo ^= uint64(len(ciphertext)) * 8
+	y = g.mul(y)
+
+	var out [16]byte
+	binary.BigEndian.PutUint64(out[:8], y.hi)
+	binary.BigEndian.PutUint64(out[8:], y.lo)
+	return out
+}
+
+// update absorbs data into y, zero padding the final partial block.
+func (g *aesGCM) update(y *gcmFieldElement, data []byte) {
+	for len(data) > 0 {
+		var block [16]byte
+		n := copy(block[:], data)
+		data = data[n:]
+
+		x := loadFieldElement(block[:])
+		y.hi ^= x.hi
+		y.lo ^= x.lo
+		*y = g.mul(*y)
+	}
+}
+
+// mul returns x·H using the bitwise algorithm of SP 800-38D, masking rather
+// than branching on key and data bits.
+func (g *aesGCM) mul(x gcmFieldElement) gcmFieldElement {
+	var z gcmFieldElement
+	v := g.h
+
+	for i := 0; i < 128; i++ {
+		var bit uint64
+		if i < 64 {
+			bit = x.hi >> (63 - i) & 1
+		} else {
+			bit = x.lo >> (127 - i) & 1
+		}
+
+		mask := -bit
+		z.hi ^= v.hi & mask
+		z.lo ^= v.lo & mask
+
+		carry := -(v.lo & 1)
+		v.lo = v.lo>>1 | v.hi<<63
+		v.hi = v.hi>>1 ^ 0xe100000000000000&carry
+	}
+
+	return z
+}
+
+func loadFieldElement(b []byte) gcmFieldElement {
+	return gcmFieldElement{
+		hi: binary.BigEndian.Uint64(b[:8]),
+		lo: binary.BigEndian.Uint64(b[8:16]),
+	}
+}
+
+func inc32(ctr *[16]byte) {
+	binary.BigEndian.PutUint32(ctr[12:], binary.BigEndian.Uint32(ctr[12:])+1)
+}
+
+// sliceForAppend extends in by n bytes, reusing its capacity when possible,
+// and returns the whole slice along with the appended tail.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,176 @@
+package enigma
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// rsa_encrypt takes at most one modulus worth of message, so longer data is
+// sealed with a hybrid RSA envelope: a 261-byte header followed by segments
+// as in the AES envelope:
+//
+//	magic "EMXR" | version (1) | content key encrypted by rsa_encrypt (256)
+//	segment 0 | segment 1 | ... | final segment
+//
+// The content key is a random AES-256 key, and the segments are AES-GCM
+// under it in software, with the header as additional data. Since the key
+// is never reused, the nonce prefix is all zeros. The header does not name
+// the RSA key: the key ID a sender stored a recipient's public key under is
+// not the ID of the private key on the recipient's device.
+const (
+	rsaEnvelopeVersion    = 1
+	rsaEnvelopeKeySize    = 256
+	rsaEnvelopeHeaderSize = 5 + rsaEnvelopeKeySize
+	rsaContentKeySize     = 32
+)
+
+var rsaEnvelopeMagic = []byte("EMXR")
+
+// ErrRSAEnvelopeFormat is returned when the input does not start with a
+// supported RSA envelope header.
+var ErrRSAEnvelopeFormat = errors.New("not an RSA envelope or unsupported envelope version")
+
+// ErrRSAEnvelopeAuth is returned when an RSA envelope fails authentication
+// because it was modified or truncated, or sealed for another key.
+var ErrRSAEnvelopeAuth = errors.New("RSA envelope authentication failed")
+
+// softwareAEAD adapts a crypto/cipher AEAD to segmentAEAD.
+type softwareAEAD struct {
+	cipher.AEAD
+}
+
+func (a softwareAEAD) seal(dst, nonce, plaintext, additionalData []byte) ([]byte, error) {
+	return a.Seal(dst, nonce, plaintext, additionalData), nil
+}
+
+func (a softwareAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	out, err := a.AEAD.Open(dst, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, errGCMOpen
+	}
+	return out, nil
+}
+
+func newContentAEAD(key []byte) (segmentAEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCMWithNonceSize(block, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	return softwareAEAD{aead}, nil
+}
+
+// NewRSASealWriter writes an RSA envelope header for the public key keyID to
+// w and returns a writer that encrypts and authenticates everything written
+// to it. keyID may be a generated key or one stored with ImportKey. Close
+// writes the final segment; it does not close w.
+func NewRSASealWriter(dev Device, keyID string, w io.Writer) (io.WriteCloser, error) {
+	key := make([]byte, rsaContentKeySize)
+	defer clear(key)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	keyIDBytes := make([]byte, 8)
+	copy(keyIDBytes, []byte(keyID))
+
+	header := make([]byte, rsaEnvelopeHeaderSize)
+	copy(header, rsaEnvelopeMagic)
+	header[4] = rsaEnvelopeVersion
+	if err := dev.RSAEncrypt(keyIDBytes, key, header[5:]); err != nil {
+		return nil, err
+	}
+
+	aead, err := newContentAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return newSegmentWriter(aead, w, header, make([]byte, 11)), nil
+}
+
+// NewRSAOpenReader reads an RSA envelope header from r, decrypts its content
+// key with the private key keyID and returns a reader that authenticates
+// and decrypts the rest as NewAESOpenReader does. A modified or truncated
+// envelope fails with ErrRSAEnvelopeAuth.
+func NewRSAOpenReader(dev Device, keyID string, r io.Reader) (io.Reader, error) {
+	header := make([]byte, rsaEnvelopeHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrRSAEnvelopeFormat
+		}
+		return nil, err
+	}
+
+	if !bytes.Equal(header[:4], rsaEnvelopeMagic) || header[4] != rsaEnvelopeVersion {
+		return nil, ErrRSAEnvelopeFormat
+	}
+
+	key, err := RSADecryptBytes(dev, keyID, header[5:])
+	if err != nil {
+		return nil, fmt.Errorf("decrypting the content key: %w", err)
+	}
+	defer clear(key)
+
+	if len(key) != rsaContentKeySize {
+		return nil, ErrRSAEnvelopeAuth
+	}
+
+	aead, err := newContentAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSegmentReader(aead, r, header, make([]byte, 11), ErrRSAEnvelopeAuth), nil
+}
+
+// RSASeal encrypts and authenticates plaintext of any length for the public
+// key keyID into an RSA envelope.
+func RSASeal(dev Device, keyID string, plaintext []byte) ([]byte, error) {
+	var envelope bytes.Buffer
+
+	w, err := NewRSASealWriter(dev, keyID, &envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return envelope.Bytes(), nil
+}
+
+// RSAOpen authenticates and decrypts an envelope produced by RSASeal with
+// the private key keyID.
+func RSAOpen(dev Device, keyID string, envelope []byte) ([]byte, error) {
+	r, err := NewRSAOpenReader(dev, keyID, bytes.NewReader(envelope))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return plaintext, nil
+}
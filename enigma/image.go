@@ -0,0 +1,240 @@
+package enigma
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// In-place image conversion overwrites the image a chunk at a time. Before
+// each chunk is overwritten its original content is saved to a journal
+// next to the image:
+//
+//	magic "EMXJ" | version (1) | operation (1) | device UID (16)
+//	image size (uint64) | chunk offset (uint64) | chunk length (uint32)
+//	chunk content | SHA-256 of everything before
+//
+// The journal is replaced atomically, so after an interruption it always
+// holds the complete original of a chunk that may have been partly
+// overwritten. Resuming writes that content back and continues from there.
+const (
+	imageJournalVersion    = 1
+	imageJournalHeaderSize = 42
+	imageJournalSuffix     = ".enigma-journal"
+	imageChunkSize         = 1 << 20
+)
+
+var imageJournalMagic = []byte("EMXJ")
+
+// ErrImageJournal is returned when an image has a journal that cannot be
+// used to resume: it is damaged, or belongs to the other operation, another
+// device or an image of another size.
+var ErrImageJournal = errors.New("cannot resume from the image journal")
+
+// ImageOptions controls AESEncryptImage and AESDecryptImage.
+type ImageOptions struct {
+	// Progress, if set, is called after each chunk with the number of bytes
+	// of the image done so far, including any done before a resume, and
+	// the total.
+	Progress func(done, total int64)
+}
+
+// ImageResult describes an image conversion.
+type ImageResult struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// ResumedAt is the offset an interrupted conversion was resumed from,
+	// or -1.
+	ResumedAt int64 `json:"resumed_at"`
+}
+
+// AESEncryptImage encrypts the disk or volume image at path in place with
+// AESXTS. The image must hold a whole number of sectors. If a previous call
+// was interrupted, the conversion resumes where it stopped; running it on
+// an image that was already encrypted encrypts it twice.
+func AESEncryptImage(dev Device, path string, opts ImageOptions) (*ImageResult, error) {
+	return convertImage(dev, path, true, opts)
+}
+
+// AESDecryptImage decrypts an image from AESEncryptImage in place, resuming
+// in the same way.
+func AESDecryptImage(dev Device, path string, opts ImageOptions) (*ImageResult, error) {
+	return convertImage(dev, path, false, opts)
+}
+
+func convertImage(dev Device, path string, encrypt bool, opts ImageOptions) (*ImageResult, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	size := info.Size()
+	if size%ImageSectorSize != 0 {
+		return nil, ErrImageSize
+	}
+
+	uid, err := dev.ChipSN()
+	if err != nil {
+		return nil, err
+	}
+
+	operation := byte(2)
+	if encrypt {
+		operation = 1
+	}
+
+	result := &ImageResult{Path: path, Size: size, ResumedAt: -1}
+	journal := path + imageJournalSuffix
+
+	start, err := resumeImage(f, journal, operation, uid, size)
+	if err != nil {
+		return nil, err
+	}
+	if start >= 0 {
+		result.ResumedAt = start
+	} else {
+		start = 0
+	}
+
+	x := NewAESXTS(dev)
+	buf := make([]byte, min(size, imageChunkSize))
+
+	for off := start; off < size; {
+		n, err := convertChunk(f, x, journal, encrypt, operation, uid, size, off, buf)
+		if err != nil {
+			return nil, fmt.Errorf("%s may be partly converted, run again to resume: %w", path, err)
+		}
+
+		off += n
+		if opts.Progress != nil {
+			opts.Progress(off, size)
+		}
+	}
+
+	if err := os.Remove(journal); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// convertChunk converts the chunk at off in place, journaling it first, and
+// returns its length.
+func convertChunk(f *os.File, x *AESXTS, journal string, encrypt bool, operation byte, uid [16]byte, size, off int64, buf []byte) (int64, error) {
+	chunk := buf[:min(int64(len(buf)), size-off)]
+	if _, err := f.ReadAt(chunk, off); err != nil {
+		return 0, err
+	}
+
+	if err := writeImageJournal(journal, operation, uid, size, off, chunk); err != nil {
+		return 0, err
+	}
+
+	var err error
+	sector := uint64(off / ImageSectorSize)
+	if encrypt {
+		err = x.EncryptSectors(chunk, chunk, sector)
+	} else {
+		err = x.DecryptSectors(chunk, chunk, sector)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := f.WriteAt(chunk, off); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+
+	return int64(len(chunk)), nil
+}
+
+// resumeImage restores the chunk saved in an existing journal and returns
+// its offset, or -1 if there is no journal.
+func resumeImage(f *os.File, journal string, operation byte, uid [16]byte, size int64) (int64, error) {
+	data, err := os.ReadFile(journal)
+	if errors.Is(err, os.ErrNotExist) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if len(data) < imageJournalHeaderSize+sha256.Size || !bytes.Equal(data[:4], imageJournalMagic) || data[4] != imageJournalVersion {
+		return 0, fmt.Errorf("%w: %s is damaged", ErrImageJournal, journal)
+	}
+
+	body, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if checksum := sha256.Sum256(body); !bytes.Equal(checksum[:], sum) {
+		return 0, fmt.Errorf("%w: %s is damaged", ErrImageJournal, journal)
+	}
+
+	if data[5] != operation {
+		other := "decryption"
+		if data[5] == 1 {
+			other = "encryption"
+		}
+		return 0, fmt.Errorf("%w: it belongs to an interrupted %s", ErrImageJournal, other)
+	}
+	if !bytes.Equal(data[6:22], uid[:]) {
+		return 0, fmt.Errorf("%w: it was written with device %x", ErrImageJournal, data[6:22])
+	}
+
+	journalSize := int64(binary.BigEndian.Uint64(data[22:30]))
+	offset := int64(binary.BigEndian.Uint64(data[30:38]))
+	length := int64(binary.BigEndian.Uint32(data[38:42]))
+	chunk := body[imageJournalHeaderSize:]
+
+	if journalSize != size || int64(len(chunk)) != length || offset%ImageSectorSize != 0 || offset+length > size {
+		return 0, fmt.Errorf("%w: it does not match the image", ErrImageJournal)
+	}
+
+	if _, err := f.WriteAt(chunk, offset); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+
+	return offset, nil
+}
+
+func writeImageJournal(journal string, operation byte, uid [16]byte, size, offset int64, chunk []byte) error {
+	return writeAtomic(journal, true, time.Time{}, func(out io.Writer) error {
+		header := make([]byte, 0, imageJournalHeaderSize)
+		header = append(header, imageJournalMagic...)
+		header = append(header, imageJournalVersion, operation)
+		header = append(header, uid[:]...)
+		header = binary.BigEndian.AppendUint64(header, uint64(size))
+		header = binary.BigEndian.AppendUint64(header, uint64(offset))
+		header = binary.BigEndian.AppendUint32(header, uint32(len(chunk)))
+
+		checksum := sha256.New()
+		w := io.MultiWriter(out, checksum)
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+
+		_, err := out.Write(checksum.Sum(nil))
+		return err
+	})
+}
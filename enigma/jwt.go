@@ -0,0 +1,243 @@
+package enigma
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// JWTs are compact JWS (RFC 7515) with RSASSA-PKCS1-v1_5. rsa_sign hashes
+// with SHA-256, so the device only signs RS256; RS384 and RS512 need the
+// message hashed with SHA-384 or SHA-512 inside the signature, which the
+// device cannot produce and which cannot be converted afterwards. They are
+// verified in software only.
+const (
+	JWTAlgRS256 = "RS256"
+	JWTAlgRS384 = "RS384"
+	JWTAlgRS512 = "RS512"
+)
+
+// ErrJWTFormat is returned for tokens that are not a compact JWS with a
+// JSON header and claims object.
+var ErrJWTFormat = errors.New("not a compact JWS token")
+
+// ErrJWTAlgorithm is returned for algorithms other than RS256, RS384 and
+// RS512, including none, and for RS384 and RS512 on the device.
+var ErrJWTAlgorithm = errors.New("unsupported JWT algorithm")
+
+// ErrJWTClaims is returned when the claims of a token with a valid
+// signature are not acceptable, such as an expired token.
+var ErrJWTClaims = errors.New("JWT claims rejected")
+
+var jwtHashes = map[string]crypto.Hash{
+	JWTAlgRS256: crypto.SHA256,
+	JWTAlgRS384: crypto.SHA384,
+	JWTAlgRS512: crypto.SHA512,
+}
+
+// JWTHeader is the JOSE header of a token.
+type JWTHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// JWT is a parsed compact JWS token. Its signature has not been checked
+// until Verify or VerifyOnDevice succeeds.
+type JWT struct {
+	Header    JWTHeader
+	Claims    map[string]any
+	Signature []byte
+
+	signingInput string
+}
+
+// SignJWT signs claims, a JSON object, as an RS256 token with the kid
+// header set to the key ID of signer. Numbers in claims are kept as
+// written.
+func SignJWT(signer *RSASigner, claims []byte) (string, error) {
+	if _, err := decodeClaims(claims); err != nil {
+		return "", err
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, claims); err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(JWTHeader{Algorithm: JWTAlgRS256, Type: "JWT", KeyID: signer.KeyID()})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(compact.Bytes())
+
+	signature, err := signer.SignMessage(nil, []byte(signingInput), nil)
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// ParseJWT splits and decodes a compact token without checking it.
+func ParseJWT(token string) (*JWT, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTFormat
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrJWTFormat, err)
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrJWTFormat, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrJWTFormat, err)
+	}
+
+	t := &JWT{Signature: signature, signingInput: parts[0] + "." + parts[1]}
+	if err := json.Unmarshal(headerJSON, &t.Header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrJWTFormat, err)
+	}
+	if t.Claims, err = decodeClaims(claimsJSON); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Verify checks the signature in software with pub, for RS256, RS384 or
+// RS512 tokens.
+func (t *JWT) Verify(pub *rsa.PublicKey) (bool, error) {
+	h, ok := jwtHashes[t.Header.Algorithm]
+	if !ok {
+		return false, fmt.Errorf("%w: %q", ErrJWTAlgorithm, t.Header.Algorithm)
+	}
+
+	var digest []byte
+	switch h {
+	case crypto.SHA256:
+		sum := sha256.Sum256([]byte(t.signingInput))
+		digest = sum[:]
+	case crypto.SHA384:
+		sum := sha512.Sum384([]byte(t.signingInput))
+		digest = sum[:]
+	default:
+		sum := sha512.Sum512([]byte(t.signingInput))
+		digest = sum[:]
+	}
+
+	return rsa.VerifyPKCS1v15(pub, h, digest, t.Signature) == nil, nil
+}
+
+// VerifyOnDevice checks the signature with rsa_verify and the key keyID,
+// which only supports RS256.
+func (t *JWT) VerifyOnDevice(dev Device, keyID string) (bool, error) {
+	if t.Header.Algorithm != JWTAlgRS256 {
+		return false, fmt.Errorf("%w: the device only verifies RS256, not %q", ErrJWTAlgorithm, t.Header.Algorithm)
+	}
+
+	keyIDBytes := make([]byte, 8)
+	copy(keyIDBytes, []byte(keyID))
+
+	// rsa_verify reads one modulus of signature
+	if len(t.Signature) != rsaCiphertextSize {
+		return false, nil
+	}
+
+	return dev.RSAVerify(keyIDBytes, []byte(t.signingInput), t.Signature)
+}
+
+// ValidateClaims checks the exp and nbf claims against now, allowing leeway
+// for clock skew, and the iss and aud claims against issuer and audience
+// unless they are empty. It fails with ErrJWTClaims.
+func (t *JWT) ValidateClaims(now time.Time, leeway time.Duration, issuer, audience string) error {
+	if exp, ok, err := t.numericDate("exp"); err != nil {
+		return err
+	} else if ok && !now.Before(exp.Add(leeway)) {
+		return fmt.Errorf("%w: expired at %s", ErrJWTClaims, exp.UTC().Format(time.RFC3339))
+	}
+
+	if nbf, ok, err := t.numericDate("nbf"); err != nil {
+		return err
+	} else if ok && now.Add(leeway).Before(nbf) {
+		return fmt.Errorf("%w: not valid before %s", ErrJWTClaims, nbf.UTC().Format(time.RFC3339))
+	}
+
+	if issuer != "" {
+		if iss, _ := t.Claims["iss"].(string); iss != issuer {
+			return fmt.Errorf("%w: issuer %q, want %q", ErrJWTClaims, iss, issuer)
+		}
+	}
+
+	if audience != "" {
+		var audiences []string
+		switch aud := t.Claims["aud"].(type) {
+		case string:
+			audiences = []string{aud}
+		case []any:
+			for _, a := range aud {
+				if s, ok := a.(string); ok {
+					audiences = append(audiences, s)
+				}
+			}
+		}
+		if !slices.Contains(audiences, audience) {
+			return fmt.Errorf("%w: audience %q not in %q", ErrJWTClaims, audience, audiences)
+		}
+	}
+
+	return nil
+}
+
+// numericDate returns a NumericDate claim, which is seconds since the epoch,
+// possibly fractional.
+func (t *JWT) numericDate(name string) (time.Time, bool, error) {
+	value, ok := t.Claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrJWTClaims, name)
+	}
+	seconds, err := number.Float64()
+	if err != nil || math.IsInf(seconds, 0) || math.Abs(seconds) > 1<<40 {
+		return time.Time{}, false, fmt.Errorf("%w: invalid %s", ErrJWTClaims, name)
+	}
+
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)), true, nil
+}
+
+// decodeClaims parses a claims object, keeping numbers as json.Number.
+func decodeClaims(data []byte) (map[string]any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var claims map[string]any
+	if err := decoder.Decode(&claims); err != nil || claims == nil {
+		return nil, fmt.Errorf("%w: claims must be a JSON object", ErrJWTFormat)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: data after the claims object", ErrJWTFormat)
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,50 @@
+package enigma
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// DeriveKey derives length bytes of key material from the device AES key
+// with the NIST SP 800-108 KDF in counter mode, using AES-CMAC as the PRF.
+// Each block of output is the CMAC of
+//
+//	counter (uint32) | label | 0x00 | context | length in bits (uint32)
+//
+// The result depends only on the device key, label, context and length, so
+// it is reproducible on the same device and unrelated on any other. Keys
+// derived with the same label and context but different lengths are not
+// prefixes of each other.
+func DeriveKey(dev Device, label, context []byte, length int) ([]byte, error) {
+	if length <= 0 || uint64(length)*8 > 0xffffffff {
+		return nil, fmt.Errorf("derived key length %d is out of range", length)
+	}
+
+	prf, err := NewCMAC(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	input := make([]byte, 0, 4+len(label)+1+len(context)+4)
+	input = append(input, 0, 0, 0, 0)
+	input = append(input, label...)
+	input = append(input, 0)
+	input = append(input, context...)
+	input = binary.BigEndian.AppendUint32(input, uint32(length*8))
+
+	key := make([]byte, 0, (length+CMACSize-1)/CMACSize*CMACSize)
+	for counter := uint32(1); len(key) < length; counter++ {
+		binary.BigEndian.PutUint32(input, counter)
+
+		prf.Reset()
+		prf.Write(input)
+
+		block, err := prf.MAC()
+		if err != nil {
+			return nil, err
+		}
+		key = append(key, block...)
+	}
+
+	return key[:length], nil
+}
@@ -0,0 +1,185 @@
+package enigma
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// DeviceKeyBits is the only RSA key size the device stores.
+const DeviceKeyBits = 2048
+
+// ErrKeySize is returned for public keys the device cannot store.
+var ErrKeySize = fmt.Errorf("the device only stores %d-bit RSA keys", DeviceKeyBits)
+
+// ParsePublicKey parses an RSA public key in any of the formats other tools
+// produce: a PKIX SubjectPublicKeyInfo, PKCS#1 or X.509 certificate, either
+// PEM or DER, a JSON Web Key or an OpenSSH public key line. For a
+// certificate the key it certifies is returned.
+func ParsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	trimmed := bytes.TrimSpace(data)
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return parseJWK(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("ssh-")):
+		return parseAuthorizedKey(trimmed)
+	case bytes.Contains(trimmed, []byte("-----BEGIN")):
+		block, _ := pem.Decode(trimmed)
+		if block == nil {
+			return nil, errors.New("invalid PEM data")
+		}
+		return parseDERPublicKey(block.Type, block.Bytes)
+	default:
+		return parseDERPublicKey("", data)
+	}
+}
+
+// parseDERPublicKey parses the body of a PEM block of the given type, or
+// DER of any supported type if blockType is empty.
+func parseDERPublicKey(blockType string, der []byte) (*rsa.PublicKey, error) {
+	var key any
+	var err error
+
+	switch blockType {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(der)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(der)
+	case "CERTIFICATE":
+		key, err = parseCertificateKey(der)
+	case "":
+		if key, err = x509.ParsePKIXPublicKey(der); err == nil {
+			break
+		}
+		if key, err = x509.ParsePKCS1PublicKey(der); err == nil {
+			break
+		}
+		if key, err = parseCertificateKey(der); err != nil {
+			return nil, errors.New("not a PEM, DER, JWK or OpenSSH public key")
+		}
+	default:
+		return nil, fmt.Errorf("PEM block %q is not a public key or certificate", blockType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an RSA key: %T", key)
+	}
+	return pub, nil
+}
+
+func parseCertificateKey(der []byte) (any, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return cert.PublicKey, nil
+}
+
+func parseJWK(data []byte) (*rsa.PublicKey, error) {
+	var key jwk
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid JWK: %w", err)
+	}
+	if key.KeyType != "RSA" {
+		return nil, fmt.Errorf("not an RSA key: JWK kty %q", key.KeyType)
+	}
+
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWK n: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWK e: %w", err)
+	}
+
+	return publicKeyFromBytes(n, e)
+}
+
+// parseAuthorizedKey parses a line from an OpenSSH .pub or authorized_keys
+// file, without options.
+func parseAuthorizedKey(line []byte) (*rsa.PublicKey, error) {
+	fields := bytes.Fields(line)
+	if len(fields) < 2 {
+		return nil, errors.New("invalid OpenSSH public key")
+	}
+	if string(fields[0]) != "ssh-rsa" {
+		return nil, fmt.Errorf("not an RSA key: OpenSSH key type %s", fields[0])
+	}
+
+	wire, err := base64.StdEncoding.DecodeString(string(fields[1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenSSH public key: %w", err)
+	}
+
+	var parts [3][]byte
+	for i := range parts {
+		if len(wire) < 4 || uint64(len(wire)-4) < uint64(binary.BigEndian.Uint32(wire)) {
+			return nil, errors.New("invalid OpenSSH public key")
+		}
+		n := binary.BigEndian.Uint32(wire)
+		parts[i], wire = wire[4:4+n], wire[4+n:]
+	}
+	if string(parts[0]) != "ssh-rsa" || len(wire) != 0 {
+		return nil, errors.New("invalid OpenSSH public key")
+	}
+
+	return publicKeyFromBytes(parts[2], parts[1])
+}
+
+// devicePublicKey fills the 256-byte modulus and exponent buffers the
+// device expects, rejecting keys of another size.
+func devicePublicKey(pub *rsa.PublicKey) (n, e []byte, err error) {
+	if pub.N.BitLen() != DeviceKeyBits {
+		return nil, nil, fmt.Errorf("%w, not %d-bit", ErrKeySize, pub.N.BitLen())
+	}
+
+	n = make([]byte, 256)
+	e = make([]byte, 256)
+	pub.N.FillBytes(n)
+	big.NewInt(int64(pub.E)).FillBytes(e)
+
+	return n, e, nil
+}
+
+// ImportRSAPublicKey stores pub on the device under customID and returns
+// its key ID. The key must be 2048 bits.
+func ImportRSAPublicKey(dev Device, customID string, pub *rsa.PublicKey) (string, error) {
+	n, e, err := devicePublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+
+	customIDBytes := make([]byte, 8)
+	copy(customIDBytes, []byte(customID))
+
+	keyID := make([]byte, 8)
+	if err := dev.StoreExternalPublicKey(customIDBytes, n, e, keyID); err != nil {
+		return "", err
+	}
+
+	return string(bytes.TrimRight(keyID, "\x00")), nil
+}
+
+// SetTransRSAPublicKey sets pub as the transmission public key. The key
+// must be 2048 bits.
+func SetTransRSAPublicKey(dev Device, pub *rsa.PublicKey) error {
+	n, e, err := devicePublicKey(pub)
+	if err != nil {
+		return err
+	}
+
+	return dev.SetTransPublicKey(n, e)
+}
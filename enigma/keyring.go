@@ -0,0 +1,197 @@
+package enigma
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrUnknownPublicKey is returned when a key ring holds no public key for a
+// key ID.
+var ErrUnknownPublicKey = errors.New("public key not in the key ring")
+
+// KeyRing remembers the public part of RSA keys in a JSON file. The device
+// only returns a public key from generate_rsa_key, and has no export to read
+// it back later, so it has to be kept when the key is generated or
+// imported. Entries are kept per device UID, since key IDs are only unique
+// within a device.
+type KeyRing struct {
+	path string
+	mu   sync.Mutex
+}
+
+type keyRingFile struct {
+	Version int                                `json:"version"`
+	Devices map[string]map[string]keyRingEntry `json:"devices"`
+}
+
+type keyRingEntry struct {
+	N []byte `json:"n"`
+	E int    `json:"e"`
+}
+
+// NewKeyRing returns a key ring stored at path, which is created on the
+// first Remember.
+func NewKeyRing(path string) *KeyRing {
+	return &KeyRing{path: path}
+}
+
+// Remember stores pub as the public key of keyID on dev, replacing any
+// earlier one.
+func (k *KeyRing) Remember(dev Device, keyID string, pub *rsa.PublicKey) error {
+	return k.update(dev, func(keys map[string]keyRingEntry) {
+		keys[keyID] = keyRingEntry{N: pub.N.Bytes(), E: pub.E}
+	})
+}
+
+// Forget removes the public key of keyID on dev.
+func (k *KeyRing) Forget(dev Device, keyID string) error {
+	return k.update(dev, func(keys map[string]keyRingEntry) {
+		delete(keys, keyID)
+	})
+}
+
+// ForgetAll removes every public key of dev.
+func (k *KeyRing) ForgetAll(dev Device) error {
+	return k.update(dev, func(keys map[string]keyRingEntry) {
+		clear(keys)
+	})
+}
+
+// PublicKey returns the remembered public key of keyID on dev. Generated
+// key IDs are handed out again after a key is deleted, so the entry is
+// checked against the key now under keyID: the device signs a random
+// challenge, which must verify with the remembered key. Public keys
+// imported without a private key cannot sign and are only checked to still
+// be on the device. A stale entry is forgotten, and PublicKey fails with
+// ErrUnknownPublicKey as it does when there is no entry.
+func (k *KeyRing) PublicKey(dev Device, keyID string) (*rsa.PublicKey, error) {
+	uid, err := keyRingDevice(dev)
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	ring, err := k.load()
+	k.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := ring.Devices[uid][keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s was not generated or imported with this key ring", ErrUnknownPublicKey, keyID)
+	}
+
+	pub, err := publicKeyFromBytes(entry.N, big.NewInt(int64(entry.E)).Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	if _, signature, err := SignBytes(dev, keyID, challenge); err == nil {
+		if !VerifyBytesOffline(pub, challenge, signature) {
+			return nil, k.forgetStale(dev, keyID, "was replaced by another key")
+		}
+		return pub, nil
+	}
+
+	_, _, keyIDs, _, err := ListKeys(dev)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(keyIDs, keyID) {
+		return nil, k.forgetStale(dev, keyID, "is no longer on the device")
+	}
+
+	return pub, nil
+}
+
+// forgetStale removes the entry of keyID and returns the ErrUnknownPublicKey
+// explaining why.
+func (k *KeyRing) forgetStale(dev Device, keyID, reason string) error {
+	if err := k.Forget(dev, keyID); err != nil {
+		return fmt.Errorf("%w: %s %s, and the stale entry was not removed: %v", ErrUnknownPublicKey, keyID, reason, err)
+	}
+	return fmt.Errorf("%w: %s %s", ErrUnknownPublicKey, keyID, reason)
+}
+
+func (k *KeyRing) update(dev Device, change func(keys map[string]keyRingEntry)) error {
+	uid, err := keyRingDevice(dev)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	ring, err := k.load()
+	if err != nil {
+		return err
+	}
+
+	keys := ring.Devices[uid]
+	if keys == nil {
+		keys = map[string]keyRingEntry{}
+		ring.Devices[uid] = keys
+	}
+	change(keys)
+	if len(keys) == 0 {
+		delete(ring.Devices, uid)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return err
+	}
+
+	return writeAtomic(k.path, true, time.Time{}, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(ring)
+	})
+}
+
+func (k *KeyRing) load() (*keyRingFile, error) {
+	ring := &keyRingFile{Version: 1, Devices: map[string]map[string]keyRingEntry{}}
+
+	data, err := os.ReadFile(k.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ring, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, ring); err != nil {
+		return nil, fmt.Errorf("key ring %s: %w", k.path, err)
+	}
+	if ring.Version != 1 {
+		return nil, fmt.Errorf("key ring %s: unsupported version %d", k.path, ring.Version)
+	}
+	if ring.Devices == nil {
+		ring.Devices = map[string]map[string]keyRingEntry{}
+	}
+
+	return ring, nil
+}
+
+func keyRingDevice(dev Device) (string, error) {
+	uid, err := dev.ChipSN()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(uid[:]), nil
+}
@@ -0,0 +1,157 @@
+package enigma
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Keystore file layout:
+//
+//	magic (8) | version (1) | iterations (4, big endian) | salt (16) | nonce (12) | ciphertext
+//
+// The ciphertext is the JSON encoded softState sealed with AES-256-GCM under
+// a PBKDF2-SHA256 key derived from the passphrase. Everything before the
+// ciphertext is authenticated as additional data.
+const (
+	keystoreMagic      = "ENIGMAKS"
+	keystoreVersion    = 1
+	keystoreIterations = 100000
+	keystoreSaltSize   = 16
+	keystoreHeaderSize = len(keystoreMagic) + 1 + 4 + keystoreSaltSize
+)
+
+var errKeystoreFormat = errors.New("keystore: unrecognised file format")
+
+// softSlot is one of the 16 RSA key slots. PrivateKey holds the PKCS#1 DER
+// encoding and is empty for public keys stored with store_external_public_key.
+type softSlot struct {
+	KeyID      string `json:"key_id"`
+	CustomID   string `json:"custom_id"`
+	N          []byte `json:"n"`
+	E          []byte `json:"e"`
+	PrivateKey []byte `json:"private_key,omitempty"`
+}
+
+type softState struct {
+	UID       []byte       `json:"uid"`
+	AESKey    []byte       `json:"aes_key"`
+	PIN       string       `json:"pin"`
+	RetryLeft uint8        `json:"retry_left"`
+	LoggedIn  bool         `json:"logged_in"`
+	DeviceKey []byte       `json:"device_key"`
+	TransKeyN []byte       `json:"trans_key_n,omitempty"`
+	TransKeyE []byte       `json:"trans_key_e,omitempty"`
+	Slots     [16]softSlot `json:"slots"`
+}
+
+func loadKeystore(path string, passphrase string) (*softState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < keystoreHeaderSize+12 || string(data[:len(keystoreMagic)]) != keystoreMagic {
+		return nil, errKeystoreFormat
+	}
+
+	header := data[:keystoreHeaderSize]
+	if header[len(keystoreMagic)] != keystoreVersion {
+		return nil, fmt.Errorf("keystore: unsupported version %d", header[len(keystoreMagic)])
+	}
+
+	iterations := binary.BigEndian.Uint32(header[len(keystoreMagic)+1:])
+	salt := header[keystoreHeaderSize-keystoreSaltSize:]
+
+	aead, err := keystoreAEAD(passphrase, salt, int(iterations))
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := data[keystoreHeaderSize : keystoreHeaderSize+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, data[keystoreHeaderSize+aead.NonceSize():], header)
+	if err != nil {
+		return nil, errors.New("keystore: wrong passphrase or corrupted file")
+	}
+
+	state := &softState{}
+	if err := json.Unmarshal(plaintext, state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func saveKeystore(path string, passphrase string, state *softState) error {
+	plaintext, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, keystoreSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	var header bytes.Buffer
+	header.WriteString(keystoreMagic)
+	header.WriteByte(keystoreVersion)
+	binary.Write(&header, binary.BigEndian, uint32(keystoreIterations))
+	header.Write(salt)
+
+	aead, err := keystoreAEAD(passphrase, salt, keystoreIterations)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	out := append(bytes.Clone(header.Bytes()), nonce...)
+	out = aead.Seal(out, nonce, plaintext, header.Bytes())
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func keystoreAEAD(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,203 @@
+package enigma
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Key wrapping protects key material with the device AES key using the AES
+// key wrap of RFC 3394 and its padded variant from RFC 5649. Each step of
+// the algorithm depends on the previous one, so every block is a separate
+// AESEncryptBlock or AESDecryptBlock call.
+
+// ErrKeyUnwrap is returned when a wrapped key fails its integrity check,
+// because it was modified, wrapped under another key or with the other
+// variant.
+var ErrKeyUnwrap = errors.New("key unwrap integrity check failed")
+
+var (
+	keyWrapIV    = [8]byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+	keyWrapAIV32 = [4]byte{0xa6, 0x59, 0x59, 0xa6}
+)
+
+// WrapKey wraps key with the RFC 3394 AES key wrap. key must be a multiple
+// of 8 bytes and at least 16 bytes long; the result is 8 bytes longer.
+func WrapKey(dev Device, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, fmt.Errorf("key length %d is not a multiple of 8 bytes of at least 16", len(key))
+	}
+
+	return wrapBlocks(dev, keyWrapIV, key)
+}
+
+// UnwrapKey reverses WrapKey, returning ErrKeyUnwrap if the integrity check
+// fails.
+func UnwrapKey(dev Device, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, fmt.Errorf("wrapped key length %d is not a multiple of 8 bytes of at least 24", len(wrapped))
+	}
+
+	iv, key, err := unwrapBlocks(dev, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(iv[:], keyWrapIV[:]) != 1 {
+		return nil, ErrKeyUnwrap
+	}
+
+	return key, nil
+}
+
+// WrapKeyWithPadding wraps key with the RFC 5649 AES key wrap with padding,
+// which accepts keys of any length from 1 byte up. The result is the key
+// length rounded up to 8 bytes, plus 8.
+func WrapKeyWithPadding(dev Device, key []byte) ([]byte, error) {
+	if len(key) == 0 || uint64(len(key)) > 0xffffffff {
+		return nil, fmt.Errorf("key length %d is out of range", len(key))
+	}
+
+	var iv [8]byte
+	copy(iv[:4], keyWrapAIV32[:])
+	binary.BigEndian.PutUint32(iv[4:], uint32(len(key)))
+
+	padded := make([]byte, (len(key)+7)/8*8)
+	copy(padded, key)
+
+	// A single padded block is encrypted directly with the IV
+	if len(padded) == 8 {
+		var block [16]byte
+		copy(block[:8], iv[:])
+		copy(block[8:], padded)
+
+		wrapped, err := AESEncryptBlock(dev, block)
+		if err != nil {
+			return nil, err
+		}
+		return wrapped[:], nil
+	}
+
+	return wrapBlocks(dev, iv, padded)
+}
+
+// UnwrapKeyWithPadding reverses WrapKeyWithPadding, returning ErrKeyUnwrap
+// if the integrity check fails.
+func UnwrapKeyWithPadding(dev Device, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, fmt.Errorf("wrapped key length %d is not a multiple of 8 bytes of at least 16", len(wrapped))
+	}
+
+	var (
+		iv     [8]byte
+		padded []byte
+	)
+
+	if len(wrapped) == 16 {
+		var block [16]byte
+		copy(block[:], wrapped)
+
+		plain, err := AESDecryptBlock(dev, block)
+		if err != nil {
+			return nil, err
+		}
+		copy(iv[:], plain[:8])
+		padded = plain[8:]
+	} else {
+		var err error
+		iv, padded, err = unwrapBlocks(dev, wrapped)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Check the constant half, the length and the zero padding together so
+	// that a failure does not reveal which part was wrong
+	mli := binary.BigEndian.Uint32(iv[4:])
+	length := int(mli & 0x7fffffff)
+	ok := subtle.ConstantTimeCompare(iv[:4], keyWrapAIV32[:])
+	ok &= subtle.ConstantTimeEq(int32(mli>>31), 0)
+	ok &= subtle.ConstantTimeLessOrEq(len(padded)-7, length)
+	ok &= subtle.ConstantTimeLessOrEq(length, len(padded))
+
+	var padding byte
+	for i := range padded {
+		inPadding := subtle.ConstantTimeLessOrEq(length, i)
+		padding |= byte(subtle.ConstantTimeSelect(inPadding, int(padded[i]), 0))
+	}
+	ok &= subtle.ConstantTimeByteEq(padding, 0)
+
+	if ok != 1 {
+		return nil, ErrKeyUnwrap
+	}
+
+	return padded[:length], nil
+}
+
+// wrapBlocks is the wrapping process W of RFC 3394 over the 8-byte blocks
+// of plaintext with initial value iv.
+func wrapBlocks(dev Device, iv [8]byte, plaintext []byte) ([]byte, error) {
+	n := len(plaintext) / 8
+	out := make([]byte, 8+len(plaintext))
+	copy(out[8:], plaintext)
+
+	a := iv
+	var block [16]byte
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			r := out[i*8 : i*8+8]
+			copy(block[:8], a[:])
+			copy(block[8:], r)
+
+			b, err := AESEncryptBlock(dev, block)
+			if err != nil {
+				return nil, err
+			}
+
+			copy(a[:], b[:8])
+			xorCounter(&a, uint64(n*j+i))
+			copy(r, b[8:])
+		}
+	}
+
+	copy(out[:8], a[:])
+	return out, nil
+}
+
+// unwrapBlocks is the unwrapping process W^-1 of RFC 3394, returning the
+// recovered initial value for the caller to check.
+func unwrapBlocks(dev Device, wrapped []byte) ([8]byte, []byte, error) {
+	n := len(wrapped)/8 - 1
+	out := make([]byte, len(wrapped)-8)
+	copy(out, wrapped[8:])
+
+	var a [8]byte
+	copy(a[:], wrapped[:8])
+
+	var block [16]byte
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			r := out[(i-1)*8 : i*8]
+			xorCounter(&a, uint64(n*j+i))
+			copy(block[:8], a[:])
+			copy(block[8:], r)
+
+			b, err := AESDecryptBlock(dev, block)
+			if err != nil {
+				return a, nil, err
+			}
+
+			copy(a[:], b[:8])
+			copy(r, b[8:])
+		}
+	}
+
+	return a, out, nil
+}
+
+func xorCounter(a *[8]byte, t uint64) {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], t)
+	subtle.XORBytes(a[:], a[:], counter[:])
+}
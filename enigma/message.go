@@ -1,27 +1,78 @@
 package enigma
 
+import (
+	"fmt"
+)
+
+var codeMessages = map[uint8]string{
+	0x00: "STATUS_OK",
+	0x01: "ERR_MX_NO_EXIST",
+	0x02: "ERR_MX_HANDLE_FAIL",
+	0x10: "ERR_MX_UPDATE_KEY_FAIL",
+	0x31: "ERR_SEND_LOGIN_CMD_FAIL",
+	0x32: "ERR_INVALID_PWD_LENGTH",
+	0x33: "ERR_LOGIN_FAIL",
+	0x35: "ERR_OVER_FAIL_RETRY_COUNT",
+	0x50: "ERR_SOURCE_FILE_OPEN_FAIL",
+	0x51: "ERR_TARGET_FILE_IS_EXIST",
+	0x52: "ERR_TARGET_FILE_OPEN_FAIL",
+	0x54: "ERR_ENC_STREAM_FAIL",
+	0x58: "ERR_DEC_STREAM_FAIL",
+	0x64: "ERR_FFE_CMD_ABORT",
+	0xFE: "MX_LICENSE_INVALID",
+}
+
 func GetCodeMessage(code uint8) string {
-	errMap := map[uint8]string{
-		0x00: "STATUS_OK",
-		0x01: "ERR_MX_NO_EXIST",
-		0x02: "ERR_MX_HANDLE_FAIL",
-		0x10: "ERR_MX_UPDATE_KEY_FAIL",
-		0x31: "ERR_SEND_LOGIN_CMD_FAIL",
-		0x32: "ERR_INVALID_PWD_LENGTH",
-		0x33: "ERR_LOGIN_FAIL",
-		0x35: "ERR_OVER_FAIL_RETRY_COUNT",
-		0x50: "ERR_SOURCE_FILE_OPEN_FAIL",
-		0x51: "ERR_TARGET_FILE_IS_EXIST",
-		0x52: "ERR_TARGET_FILE_OPEN_FAIL",
-		0x54: "ERR_ENC_STREAM_FAIL",
-		0x58: "ERR_DEC_STREAM_FAIL",
-		0x64: "ERR_FFE_CMD_ABORT",
-		0xFE: "MX_LICENSE_INVALID",
+	if msg, ok := codeMessages[code]; ok {
+		return msg
 	}
 
-	if msg, ok := errMap[code]; ok {
+	return "UNKNOWN"
+}
+
+// StatusError is a non-zero status code returned by the export named in Op.
+// Use errors.Is with the Err* sentinels to test for a particular code.
+type StatusError struct {
+	Code uint8
+	Op   string
+}
+
+func (e *StatusError) Error() string {
+	msg, ok := codeMessages[e.Code]
+	if !ok {
+		msg = fmt.Sprintf("UNKNOWN (0x%02X)", e.Code)
+	}
+
+	if e.Op == "" {
 		return msg
 	}
 
-	return "UNKNOWN"
+	return e.Op + ": " + msg
+}
+
+// Is reports whether target is a StatusError with the same code, ignoring Op.
+func (e *StatusError) Is(target error) bool {
+	t, ok := target.(*StatusError)
+	return ok && t.Code == e.Code
+}
+
+var (
+	ErrMXNoExist          = &StatusError{Code: 0x01}
+	ErrMXHandleFail       = &StatusError{Code: 0x02}
+	ErrMXUpdateKeyFail    = &StatusError{Code: 0x10}
+	ErrSendLoginCmdFail   = &StatusError{Code: 0x31}
+	ErrInvalidPwdLength   = &StatusError{Code: 0x32}
+	ErrLoginFail          = &StatusError{Code: 0x33}
+	ErrOverFailRetryCount = &StatusError{Code: 0x35}
+	ErrSourceFileOpenFail = &StatusError{Code: 0x50}
+	ErrTargetFileExists   = &StatusError{Code: 0x51}
+	ErrTargetFileOpenFail = &StatusError{Code: 0x52}
+	ErrEncStreamFail      = &StatusError{Code: 0x54}
+	ErrDecStreamFail      = &StatusError{Code: 0x58}
+	ErrFFECmdAbort        = &StatusError{Code: 0x64}
+	ErrLicenseInvalid     = &StatusError{Code: 0xFE}
+)
+
+func newStatusError(op string, code uint8) error {
+	return &StatusError{Code: code, Op: op}
 }
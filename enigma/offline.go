@@ -0,0 +1,28 @@
+package enigma
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// VerifyBytesOffline checks a signature from SignBytes with the public key
+// alone, as rsa_verify does on the device: the message is hashed with
+// SHA-256 and the signature, one modulus long, is PKCS#1 v1.5.
+func VerifyBytesOffline(pub *rsa.PublicKey, messageBytes []byte, signature []byte) bool {
+	digest := sha256.Sum256(messageBytes)
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+}
+
+// VerifyOffline checks a base64 signature from Sign with the public key
+// alone. pub may come from PublicKeyFromBase64 with the values GenerateKey
+// returns, or from ParsePublicKey.
+func VerifyOffline(pub *rsa.PublicKey, message string, signature string) (bool, error) {
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false, err
+	}
+
+	return VerifyBytesOffline(pub, []byte(message), signatureBytes), nil
+}
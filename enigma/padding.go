@@ -0,0 +1,172 @@
+package enigma
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+// Padding selects how AES plaintext is extended to a whole number of blocks.
+type Padding int
+
+const (
+	// PaddingISO9797M2 appends 0x80 and then zero bytes, always adding at
+	// least one byte. It is the scheme used by the device and the default.
+	PaddingISO9797M2 Padding = iota
+	// PaddingPKCS7 appends n bytes of value n, always adding at least one.
+	PaddingPKCS7
+	// PaddingZero appends zero bytes up to the block boundary, adding none to
+	// aligned input. Trailing zero bytes of the plaintext are lost on
+	// unpadding.
+	PaddingZero
+	// PaddingNone adds nothing; the caller guarantees aligned input.
+	PaddingNone
+)
+
+var paddingNames = map[Padding]string{
+	PaddingISO9797M2: "iso9797-m2",
+	PaddingPKCS7:     "pkcs7",
+	PaddingZero:      "zero",
+	PaddingNone:      "none",
+}
+
+func (p Padding) String() string {
+	if name, ok := paddingNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Padding(%d)", int(p))
+}
+
+// ParsePadding returns the padding named by s, one of iso9797-m2, pkcs7,
+// zero or none.
+func ParsePadding(s string) (Padding, error) {
+	for p, name := range paddingNames {
+		if strings.EqualFold(s, name) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown padding %q, expected iso9797-m2, pkcs7, zero or none", s)
+}
+
+// PaddingError is returned when data does not end in valid padding of the
+// expected scheme, typically because it was decrypted with the wrong key or
+// padding, or was corrupted.
+type PaddingError struct {
+	Padding Padding
+}
+
+func (e *PaddingError) Error() string {
+	return "invalid " + e.Padding.String() + " padding"
+}
+
+// Pad returns a copy of data padded to a multiple of blockSize. Only
+// PaddingNone can fail, when data is not already aligned.
+func (p Padding) Pad(data []byte, blockSize int) ([]byte, error) {
+	n := blockSize - len(data)%blockSize
+
+	switch p {
+	case PaddingISO9797M2:
+		padded := make([]byte, len(data)+n)
+		copy(padded, data)
+		padded[len(data)] = 0x80
+		return padded, nil
+	case PaddingPKCS7:
+		padded := make([]byte, len(data)+n)
+		copy(padded, data)
+		for i := len(data); i < len(padded); i++ {
+			padded[i] = byte(n)
+		}
+		return padded, nil
+	case PaddingZero:
+		padded := make([]byte, (len(data)+blockSize-1)/blockSize*blockSize)
+		copy(padded, data)
+		return padded, nil
+	case PaddingNone:
+		if len(data)%blockSize != 0 {
+			return nil, fmt.Errorf("input length %d is not a multiple of the block size %d, as padding none requires", len(data), blockSize)
+		}
+		return append([]byte(nil), data...), nil
+	}
+
+	return nil, fmt.Errorf("unknown padding %v", p)
+}
+
+// Unpad strips the padding from data, which must be a whole number of
+// blocks. The padding is checked in constant time with respect to the
+// contents of the final block, and a *PaddingError is returned when it is
+// malformed. The result aliases data.
+func (p Padding) Unpad(data []byte, blockSize int) ([]byte, error) {
+	if len(data)%blockSize != 0 {
+		return nil, ErrCiphertextLength
+	}
+	if p == PaddingNone {
+		return data, nil
+	}
+	if len(data) == 0 {
+		if p == PaddingZero {
+			return data, nil
+		}
+		return nil, &PaddingError{Padding: p}
+	}
+
+	last := data[len(data)-blockSize:]
+
+	var n, good int
+	switch p {
+	case PaddingISO9797M2:
+		n, good = unpadISO9797M2(last)
+	case PaddingPKCS7:
+		n, good = unpadPKCS7(last)
+	case PaddingZero:
+		n, good = unpadZero(last), 1
+	default:
+		return nil, fmt.Errorf("unknown padding %v", p)
+	}
+
+	if good != 1 {
+		return nil, &PaddingError{Padding: p}
+	}
+
+	return data[:len(data)-n], nil
+}
+
+// unpadISO9797M2 finds the last non-zero byte of the block, which must be
+// 0x80, and returns the padding length along with 1 if it is valid.
+func unpadISO9797M2(last []byte) (int, int) {
+	found, index, value := 0, 0, 0
+	for i, b := range last {
+		nonZero := 1 - subtle.ConstantTimeByteEq(b, 0)
+		index = subtle.ConstantTimeSelect(nonZero, i, index)
+		value = subtle.ConstantTimeSelect(nonZero, int(b), value)
+		found |= nonZero
+	}
+
+	good := found & subtle.ConstantTimeByteEq(byte(value), 0x80)
+	return len(last) - index, good
+}
+
+// unpadPKCS7 checks that the final n bytes of the block all equal n, for n
+// between 1 and the block size, and returns n along with 1 if they do.
+func unpadPKCS7(last []byte) (int, int) {
+	n := int(last[len(last)-1])
+	good := 1 - subtle.ConstantTimeByteEq(byte(n), 0)
+	good &= subtle.ConstantTimeLessOrEq(n, len(last))
+
+	for i, b := range last {
+		inPadding := subtle.ConstantTimeLessOrEq(len(last)-i, n)
+		matches := subtle.ConstantTimeByteEq(b, byte(n))
+		good &= subtle.ConstantTimeSelect(inPadding, matches, 1)
+	}
+
+	return subtle.ConstantTimeSelect(good, n, 0), good
+}
+
+// unpadZero returns the number of trailing zero bytes in the block.
+func unpadZero(last []byte) int {
+	n, trailing := 0, 1
+	for i := len(last) - 1; i >= 0; i-- {
+		trailing &= subtle.ConstantTimeByteEq(last[i], 0)
+		n += trailing
+	}
+	return n
+}
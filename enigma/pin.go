@@ -1,13 +1,5 @@
-//go:build windows
-
 package enigma
 
-import (
-	"fmt"
-	"syscall"
-	"unsafe"
-)
-
 type RETStatus struct {
 	Result                byte
 	RetryCountLeftIsValid byte
@@ -15,73 +7,43 @@ type RETStatus struct {
 	Reserved              byte
 }
 
-func LoginStatus(dll *syscall.DLL) (bool, int, bool, error) {
-	loginStatusProc, err := dll.FindProc("CheckLoginStatus")
+func LoginStatus(dev Device) (bool, int, bool, error) {
+	status, err := dev.CheckLoginStatus()
 	if err != nil {
 		return false, 0, false, err
 	}
 
-	r1, _, _ := loginStatusProc.Call()
-	if r1 == 0 {
-		return false, 0, false, fmt.Errorf("Failed to check login status")
-	}
-
-	var status RETStatus
-	*(*uint32)(unsafe.Pointer(&status)) = uint32(r1)
-
 	if status.Result != 0 {
-		return false, int(status.RetryCountLeft), status.RetryCountLeftIsValid == 1, fmt.Errorf("%s", GetCodeMessage(status.Result))
+		return false, int(status.RetryCountLeft), status.RetryCountLeftIsValid == 1, newStatusError("CheckLoginStatus", status.Result)
 	}
 
 	if status.RetryCountLeftIsValid != 0 && status.RetryCountLeft == 0 {
-		return false, int(status.RetryCountLeft), status.RetryCountLeftIsValid == 1, fmt.Errorf("%s", GetCodeMessage(0x35))
+		return false, int(status.RetryCountLeft), status.RetryCountLeftIsValid == 1, newStatusError("CheckLoginStatus", 0x35)
 	}
 
 	return true, int(status.RetryCountLeft), status.RetryCountLeftIsValid == 1, nil
 }
 
-func Login(dll *syscall.DLL, pin string) (bool, error) {
-	loginProc, err := dll.FindProc("mxLoginPIN")
+func Login(dev Device, pin string) (bool, error) {
+	err := dev.LoginPIN(pin)
 	if err != nil {
 		return false, err
 	}
 
-	pinBytes := append([]byte(pin), 0)
-
-	r1, _, _ := loginProc.Call(
-		uintptr(unsafe.Pointer(&pinBytes[0])),
-	)
-
-	if r1 != 0 {
-		return false, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
 	return true, nil
 }
 
-func ChangePin(dll *syscall.DLL, oldPin string, newPin string) (bool, error) {
+func ChangePin(dev Device, oldPin string, newPin string) (bool, error) {
 
-	res, err := Login(dll, oldPin)
+	res, err := Login(dev, oldPin)
 	if !res {
 		return false, err
 	}
 
-	changePinProc, err := dll.FindProc("mxChangePIN")
+	err = dev.ChangePIN(newPin, newPin)
 	if err != nil {
 		return false, err
 	}
 
-	newPinBytes := append([]byte(newPin), 0)
-	newPinBytesPointer := uintptr(unsafe.Pointer(&newPinBytes[0]))
-
-	r1, _, _ := changePinProc.Call(
-		newPinBytesPointer,
-		newPinBytesPointer,
-	)
-
-	if r1 != 0 {
-		return false, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
 	return true, nil
 }
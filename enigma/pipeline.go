@@ -0,0 +1,343 @@
+package enigma
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrPipelineClosed is returned for requests made to a closed AESPipeline.
+var ErrPipelineClosed = errors.New("AES pipeline is closed")
+
+// PipelineOptions controls NewAESPipeline. Zero values select the defaults.
+type PipelineOptions struct {
+	// BatchSectors is the largest number of sectors sent to the device in
+	// one AESStreamEncDec call. The default is streamSectors.
+	BatchSectors int
+	// Depth is the number of batch buffers in flight. The default of 3 lets
+	// one batch be filled and one be copied out while the device works on
+	// a third.
+	Depth int
+}
+
+// PipelineStats counts the work done by an AESPipeline.
+type PipelineStats struct {
+	Requests uint64 `json:"requests"`
+	Bytes    uint64 `json:"bytes"`
+	Calls    uint64 `json:"calls"`
+	Sectors  uint64 `json:"sectors"`
+}
+
+// AESPipeline coalesces AES requests from any number of goroutines into
+// multi-sector AESStreamEncDec calls. Because the device applies the key to
+// every 16-byte block independently, blocks from different requests are
+// packed back to back, so a single block costs 16 bytes of a batch rather
+// than a whole sector.
+//
+// Requests flow through three stages: a gather goroutine copies them into a
+// batch buffer, a device goroutine makes the calls one at a time, and a
+// scatter goroutine copies the results out and completes the requests.
+// Batches are handed to the device as soon as it is idle, so a lone request
+// is not delayed, while requests arriving during a call are combined into
+// the next one. Calls in one direction are never mixed with the other in a
+// batch.
+//
+// All methods are safe for concurrent use. Close must be called to stop the
+// goroutines.
+type AESPipeline struct {
+	dev          Device
+	batchSize    int
+	requests     chan *pipelineRequest
+	mu           sync.RWMutex
+	closed       bool
+	done         chan struct{}
+	requestCount atomic.Uint64
+	byteCount    atomic.Uint64
+	callCount    atomic.Uint64
+	sectorCount  atomic.Uint64
+}
+
+type pipelineRequest struct {
+	dst, src []byte
+	encrypt  bool
+	err      error
+	done     chan struct{}
+}
+
+// pipelineSegment is the part of a request held in a batch.
+type pipelineSegment struct {
+	req    *pipelineRequest
+	offset int
+	length int
+	last   bool
+}
+
+type pipelineBatch struct {
+	input    []byte
+	output   []byte
+	n        int
+	encrypt  bool
+	segments []pipelineSegment
+	err      error
+}
+
+// NewAESPipeline starts a pipeline sending requests to dev.
+func NewAESPipeline(dev Device, opts PipelineOptions) *AESPipeline {
+	if opts.BatchSectors <= 0 {
+		opts.BatchSectors = streamSectors
+	}
+	if opts.Depth <= 0 {
+		opts.Depth = 3
+	}
+
+	p := &AESPipeline{
+		dev:       dev,
+		batchSize: opts.BatchSectors * sectorSize,
+		requests:  make(chan *pipelineRequest),
+		done:      make(chan struct{}),
+	}
+
+	free := make(chan *pipelineBatch, opts.Depth)
+	for i := 0; i < opts.Depth; i++ {
+		free <- &pipelineBatch{
+			input:  make([]byte, p.batchSize),
+			output: make([]byte, p.batchSize),
+		}
+	}
+
+	device := make(chan *pipelineBatch)
+	scatter := make(chan *pipelineBatch, opts.Depth)
+
+	go p.gather(free, device)
+	go p.call(device, scatter)
+	go p.scatter(scatter, free)
+
+	return p
+}
+
+// EncryptBlocks encrypts src, a whole number of blocks, into dst. dst and
+// src may overlap entirely or not at all.
+func (p *AESPipeline) EncryptBlocks(dst, src []byte) error {
+	return p.cryptBlocks(dst, src, true)
+}
+
+// DecryptBlocks is the inverse of EncryptBlocks.
+func (p *AESPipeline) DecryptBlocks(dst, src []byte) error {
+	return p.cryptBlocks(dst, src, false)
+}
+
+// EncryptBytes is AESEncryptBytes through the pipeline.
+func (p *AESPipeline) EncryptBytes(inputData []byte) ([]byte, error) {
+	return p.EncryptBytesWithPadding(inputData, PaddingISO9797M2)
+}
+
+// DecryptBytes is AESDecryptBytes through the pipeline.
+func (p *AESPipeline) DecryptBytes(inputData []byte) ([]byte, error) {
+	return p.DecryptBytesWithPadding(inputData, PaddingISO9797M2)
+}
+
+// EncryptBytesWithPadding is AESEncryptBytesWithPadding through the
+// pipeline.
+func (p *AESPipeline) EncryptBytesWithPadding(inputData []byte, padding Padding) ([]byte, error) {
+	padded, err := padding.Pad(inputData, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.EncryptBlocks(padded, padded); err != nil {
+		return nil, err
+	}
+
+	return padded, nil
+}
+
+// DecryptBytesWithPadding is AESDecryptBytesWithPadding through the
+// pipeline.
+func (p *AESPipeline) DecryptBytesWithPadding(inputData []byte, padding Padding) ([]byte, error) {
+	if len(inputData)%16 != 0 {
+		return nil, ErrCiphertextLength
+	}
+
+	output := make([]byte, len(inputData))
+	if err := p.DecryptBlocks(output, inputData); err != nil {
+		return nil, err
+	}
+
+	return padding.Unpad(output, 16)
+}
+
+// Stats returns the work done so far. Requests and Bytes count what has
+// been accepted into a batch, Calls and Sectors what has been sent to the
+// device.
+func (p *AESPipeline) Stats() PipelineStats {
+	return PipelineStats{
+		Requests: p.requestCount.Load(),
+		Bytes:    p.byteCount.Load(),
+		Calls:    p.callCount.Load(),
+		Sectors:  p.sectorCount.Load(),
+	}
+}
+
+// Close completes the requests already made, stops the pipeline and fails
+// later requests with ErrPipelineClosed. It does not release the device.
+func (p *AESPipeline) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.requests)
+	}
+	p.mu.Unlock()
+
+	<-p.done
+	return nil
+}
+
+func (p *AESPipeline) cryptBlocks(dst, src []byte, encrypt bool) error {
+	if len(src)%16 != 0 {
+		return fmt.Errorf("input length %d is not a multiple of the AES block size", len(src))
+	}
+	if len(dst) < len(src) {
+		return fmt.Errorf("output smaller than input")
+	}
+	if len(src) == 0 {
+		return nil
+	}
+
+	req := &pipelineRequest{dst: dst[:len(src)], src: src, encrypt: encrypt, done: make(chan struct{})}
+
+	p.mu.RLock()
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrPipelineClosed
+	}
+	p.requests <- req
+	p.mu.RUnlock()
+
+	<-req.done
+	return req.err
+}
+
+// gather packs requests into batches and hands each to the device stage
+// once the device is ready for it or the batch is full. A request that does
+// not fit, or goes the other way, is held back for the next batch.
+func (p *AESPipeline) gather(free <-chan *pipelineBatch, device chan<- *pipelineBatch) {
+	defer close(device)
+
+	var (
+		pending  *pipelineRequest
+		offset   int
+		batch    *pipelineBatch
+		requests = p.requests
+	)
+
+	for {
+		if batch == nil {
+			if pending == nil && requests == nil {
+				return
+			}
+
+			batch = <-free
+			batch.n, batch.err, batch.segments = 0, nil, batch.segments[:0]
+		}
+
+		// Fill the batch from the held-back request first
+		if pending != nil && (batch.n == 0 || batch.encrypt == pending.encrypt) {
+			if batch.n == 0 {
+				batch.encrypt = pending.encrypt
+			}
+
+			n := min(len(pending.src)-offset, p.batchSize-batch.n)
+			copy(batch.input[batch.n:], pending.src[offset:offset+n])
+			batch.segments = append(batch.segments, pipelineSegment{
+				req:    pending,
+				offset: offset,
+				length: n,
+				last:   offset+n == len(pending.src),
+			})
+			batch.n += n
+			offset += n
+
+			if offset == len(pending.src) {
+				pending, offset = nil, 0
+			}
+		}
+
+		// Accept new requests only when nothing is held back and there is
+		// room left; hand the batch over whenever the device is ready
+		in := requests
+		if pending != nil || batch.n == p.batchSize {
+			in = nil
+		}
+		var out chan<- *pipelineBatch
+		if batch.n > 0 {
+			out = device
+		}
+
+		if in == nil && out == nil {
+			// Nothing is held back and the batch is empty, so this is only
+			// reached once requests is closed and drained
+			return
+		}
+
+		select {
+		case req, ok := <-in:
+			if !ok {
+				requests = nil
+				continue
+			}
+			p.requestCount.Add(1)
+			p.byteCount.Add(uint64(len(req.src)))
+			pending = req
+		case out <- batch:
+			batch = nil
+		}
+	}
+}
+
+// call makes one device call per batch.
+func (p *AESPipeline) call(device <-chan *pipelineBatch, scatter chan<- *pipelineBatch) {
+	defer close(scatter)
+
+	for batch := range device {
+		sectors := (batch.n + sectorSize - 1) / sectorSize
+		size := sectors * sectorSize
+		clear(batch.input[batch.n:size])
+
+		batch.err = p.dev.AESStreamEncDec(batch.input[:size], batch.output[:size], sectors, batch.encrypt)
+
+		p.callCount.Add(1)
+		p.sectorCount.Add(uint64(sectors))
+
+		scatter <- batch
+	}
+}
+
+// scatter copies results back to the requests and completes each one with
+// its last segment. Batches arrive in order, so a request's segments are
+// always seen in order.
+func (p *AESPipeline) scatter(scatter <-chan *pipelineBatch, free chan<- *pipelineBatch) {
+	defer close(p.done)
+
+	for batch := range scatter {
+		position := 0
+		for _, segment := range batch.segments {
+			req := segment.req
+			if batch.err != nil {
+				if req.err == nil {
+					req.err = batch.err
+				}
+			} else {
+				copy(req.dst[segment.offset:], batch.output[position:position+segment.length])
+			}
+			position += segment.length
+
+			if segment.last {
+				close(req.done)
+			}
+		}
+
+		clear(batch.segments)
+		free <- batch
+	}
+}
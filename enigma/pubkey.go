@@ -0,0 +1,203 @@
+package enigma
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math"
+	"math/big"
+)
+
+// PublicKeyFromBase64 converts the base64 modulus and exponent returned by
+// GenerateKey into an RSA public key.
+func PublicKeyFromBase64(pubKeyN string, pubKeyE string) (*rsa.PublicKey, error) {
+	n, err := base64.StdEncoding.DecodeString(pubKeyN)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.StdEncoding.DecodeString(pubKeyE)
+	if err != nil {
+		return nil, err
+	}
+
+	return publicKeyFromBytes(n, e)
+}
+
+// publicKeyFromBytes converts a big-endian modulus and exponent, as held in
+// the device buffers, into an RSA public key.
+func publicKeyFromBytes(n, e []byte) (*rsa.PublicKey, error) {
+	modulus := new(big.Int).SetBytes(n)
+	exponent := new(big.Int).SetBytes(e)
+
+	if modulus.Sign() == 0 || modulus.Bit(0) == 0 {
+		return nil, errors.New("invalid RSA modulus")
+	}
+	if !exponent.IsInt64() || exponent.Int64() > math.MaxInt || exponent.Int64() < 3 || exponent.Bit(0) == 0 {
+		return nil, errors.New("invalid RSA public exponent")
+	}
+
+	return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+}
+
+// MarshalPublicKeyPEM encodes pub as a PKIX SubjectPublicKeyInfo in a
+// "PUBLIC KEY" PEM block, the format most tools expect.
+func MarshalPublicKeyPEM(pub *rsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// MarshalPKCS1PublicKeyPEM encodes pub as PKCS#1 in an "RSA PUBLIC KEY"
+// PEM block.
+func MarshalPKCS1PublicKeyPEM(pub *rsa.PublicKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(pub)})
+}
+
+// jwk is an RSA public key in JSON Web Key form (RFC 7517).
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid,omitempty"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+}
+
+func newJWK(keyID string, pub *rsa.PublicKey) jwk {
+	return jwk{
+		KeyType: "RSA",
+		KeyID:   keyID,
+		N:       base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+// MarshalPublicKeyJWK encodes pub as a JSON Web Key with kid set to keyID.
+func MarshalPublicKeyJWK(keyID string, pub *rsa.PublicKey) ([]byte, error) {
+	return json.Marshal(newJWK(keyID, pub))
+}
+
+// sshWireKey is the OpenSSH wire encoding of pub: string "ssh-rsa" | mpint
+// e | mpint n.
+func sshWireKey(pub *rsa.PublicKey) []byte {
+	appendString := func(b, s []byte) []byte {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+		return append(b, s...)
+	}
+	// mpints are two's complement, so a set top bit needs a leading zero
+	mpint := func(x *big.Int) []byte {
+		b := x.Bytes()
+		if len(b) > 0 && b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+
+	var wire []byte
+	wire = appendString(wire, []byte("ssh-rsa"))
+	wire = appendString(wire, mpint(big.NewInt(int64(pub.E))))
+	wire = appendString(wire, mpint(pub.N))
+	return wire
+}
+
+// MarshalAuthorizedKey encodes pub as an OpenSSH authorized_keys line with
+// keyID as the comment.
+func MarshalAuthorizedKey(keyID string, pub *rsa.PublicKey) []byte {
+	line := "ssh-rsa " + base64.StdEncoding.EncodeToString(sshWireKey(pub))
+	if keyID != "" {
+		line += " " + keyID
+	}
+	return []byte(line + "\n")
+}
+
+// PublicKeyFingerprints identifies a public key in the forms other tools
+// print.
+type PublicKeyFingerprints struct {
+	// SHA256 is the hex SHA-256 of the PKIX DER encoding, as used for key
+	// pinning.
+	SHA256 string `json:"sha256"`
+	// OpenSSH is the fingerprint ssh-keygen -l prints.
+	OpenSSH string `json:"openssh"`
+	// JWKThumbprint is the RFC 7638 SHA-256 thumbprint.
+	JWKThumbprint string `json:"jwk_thumbprint"`
+}
+
+// Fingerprints returns the fingerprints of pub.
+func Fingerprints(pub *rsa.PublicKey) (*PublicKeyFingerprints, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	// The thumbprint input has only the required members, sorted, which
+	// json.Marshal does for maps
+	key := newJWK("", pub)
+	thumbprintInput, err := json.Marshal(map[string]string{"e": key.E, "kty": key.KeyType, "n": key.N})
+	if err != nil {
+		return nil, err
+	}
+
+	spki := sha256.Sum256(der)
+	ssh := sha256.Sum256(sshWireKey(pub))
+	thumbprint := sha256.Sum256(thumbprintInput)
+
+	return &PublicKeyFingerprints{
+		SHA256:        hex.EncodeToString(spki[:]),
+		OpenSSH:       "SHA256:" + base64.RawStdEncoding.EncodeToString(ssh[:]),
+		JWKThumbprint: base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+	}, nil
+}
+
+// PublicKeyExport holds a public key in every supported format.
+type PublicKeyExport struct {
+	KeyID        string                 `json:"key_id"`
+	Bits         int                    `json:"bits"`
+	PEM          string                 `json:"pem"`
+	DER          []byte                 `json:"der"`
+	PKCS1        string                 `json:"pkcs1"`
+	JWK          json.RawMessage        `json:"jwk"`
+	OpenSSH      string                 `json:"openssh"`
+	Fingerprints *PublicKeyFingerprints `json:"fingerprints"`
+}
+
+// ExportPublicKey encodes pub, the public part of the device key keyID, in
+// every supported format.
+func ExportPublicKey(keyID string, pub *rsa.PublicKey) (*PublicKeyExport, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	pemKey, err := MarshalPublicKeyPEM(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	jwkKey, err := MarshalPublicKeyJWK(keyID, pub)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprints, err := Fingerprints(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublicKeyExport{
+		KeyID:        keyID,
+		Bits:         pub.N.BitLen(),
+		PEM:          string(pemKey),
+		DER:          der,
+		PKCS1:        string(MarshalPKCS1PublicKeyPEM(pub)),
+		JWK:          jwkKey,
+		OpenSSH:      string(MarshalAuthorizedKey(keyID, pub)),
+		Fingerprints: fingerprints,
+	}, nil
+}
@@ -1,12 +1,7 @@
-//go:build windows
-
 package enigma
 
 import (
 	"encoding/base64"
-	"fmt"
-	"syscall"
-	"unsafe"
 )
 
 func TrimLeadingZeroes(data []byte) []byte {
@@ -18,12 +13,7 @@ func TrimLeadingZeroes(data []byte) []byte {
 	return data[len(data)-1:]
 }
 
-func GenerateKey(dll *syscall.DLL, customID string) (bool, string, string, string, error) {
-	generateKeyProc, err := dll.FindProc("generate_rsa_key")
-	if err != nil {
-		return false, "", "", "", err
-	}
-
+func GenerateKey(dev Device, customID string) (bool, string, string, string, error) {
 	customIDBytes := make([]byte, 8)
 	copy(customIDBytes, []byte(customID))
 
@@ -31,15 +21,9 @@ func GenerateKey(dll *syscall.DLL, customID string) (bool, string, string, strin
 	pubKeyN := make([]byte, 256)
 	pubKeyE := make([]byte, 256)
 
-	r1, _, _ := generateKeyProc.Call(
-		uintptr(unsafe.Pointer(&customIDBytes[0])),
-		uintptr(unsafe.Pointer(&keyID[0])),
-		uintptr(unsafe.Pointer(&pubKeyN[0])),
-		uintptr(unsafe.Pointer(&pubKeyE[0])),
-	)
-
-	if r1 != 0 {
-		return false, "", "", "", fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
+	err := dev.GenerateRSAKey(customIDBytes, keyID, pubKeyN, pubKeyE)
+	if err != nil {
+		return false, "", "", "", err
 	}
 
 	keyIDStr := string(keyID)
@@ -49,114 +33,50 @@ func GenerateKey(dll *syscall.DLL, customID string) (bool, string, string, strin
 	return true, keyIDStr, pubKeyNStr, pubKeyEStr, nil
 }
 
-func ImportKey(dll *syscall.DLL, customID string, pubKeyN string, pubKeyE string) (bool, string, error) {
-	importKeyProc, err := dll.FindProc("store_external_public_key")
-	if err != nil {
-		return false, "", err
-	}
-
-	customIDBytes := make([]byte, 8)
-	copy(customIDBytes, []byte(customID))
-
-	pubKeyNBytes, err := base64.StdEncoding.DecodeString(pubKeyN)
+// ImportKey stores the public key with the base64 modulus and exponent
+// pubKeyN and pubKeyE on the device and returns its key ID. Keys other than
+// 2048 bits fail with ErrKeySize.
+func ImportKey(dev Device, customID string, pubKeyN string, pubKeyE string) (bool, string, error) {
+	pub, err := PublicKeyFromBase64(pubKeyN, pubKeyE)
 	if err != nil {
 		return false, "", err
 	}
 
-	pubKeyEBytes, err := base64.StdEncoding.DecodeString(pubKeyE)
+	keyIDStr, err := ImportRSAPublicKey(dev, customID, pub)
 	if err != nil {
 		return false, "", err
 	}
 
-	pubKeyNBuffer := make([]byte, 256)
-	copy(pubKeyNBuffer, pubKeyNBytes)
-
-	pubKeyEBuffer := make([]byte, 256)
-	if len(pubKeyEBytes) < 256 {
-		copy(pubKeyEBuffer[256-len(pubKeyEBytes):], pubKeyEBytes)
-	} else {
-		copy(pubKeyEBuffer, pubKeyEBytes)
-	}
-
-	keyID := make([]byte, 8)
-
-	r1, _, _ := importKeyProc.Call(
-		uintptr(unsafe.Pointer(&customIDBytes[0])),
-		uintptr(unsafe.Pointer(&pubKeyNBuffer[0])),
-		uintptr(unsafe.Pointer(&pubKeyEBuffer[0])),
-		uintptr(unsafe.Pointer(&keyID[0])),
-	)
-
-	if r1 != 0 {
-		return false, "", fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
-	keyIDStr := string(keyID)
-
 	return true, keyIDStr, nil
 }
 
-func SetTransKey(dll *syscall.DLL, pubKeyN string, pubKeyE string) (bool, string, error) {
-	setTransKeyProc, err := dll.FindProc("set_trans_public_key")
+// SetTransKey sets the public key with the base64 modulus and exponent
+// pubKeyN and pubKeyE as the transmission key. Keys other than 2048 bits
+// fail with ErrKeySize.
+func SetTransKey(dev Device, pubKeyN string, pubKeyE string) (bool, string, error) {
+	pub, err := PublicKeyFromBase64(pubKeyN, pubKeyE)
 	if err != nil {
 		return false, "", err
 	}
 
-	pubKeyNBytes, err := base64.StdEncoding.DecodeString(pubKeyN)
-	if err != nil {
+	if err := SetTransRSAPublicKey(dev, pub); err != nil {
 		return false, "", err
 	}
 
-	pubKeyEBytes, err := base64.StdEncoding.DecodeString(pubKeyE)
-	if err != nil {
-		return false, "", err
-	}
-
-	pubKeyNBuffer := make([]byte, 256)
-	copy(pubKeyNBuffer, pubKeyNBytes)
-
-	pubKeyEBuffer := make([]byte, 256)
-	if len(pubKeyEBytes) < 256 {
-		copy(pubKeyEBuffer[256-len(pubKeyEBytes):], pubKeyEBytes)
-	} else {
-		copy(pubKeyEBuffer, pubKeyEBytes)
-	}
-
-	r1, _, _ := setTransKeyProc.Call(
-		uintptr(unsafe.Pointer(&pubKeyNBuffer[0])),
-		uintptr(unsafe.Pointer(&pubKeyEBuffer[0])),
-	)
-
-	if r1 != 0 {
-		return false, "", fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
 	return true, "TRANSKEY", nil
 }
 
-func RSAEncrypt(dll *syscall.DLL, keyID string, message string) (bool, string, error) {
-	rsaEncryptProc, err := dll.FindProc("rsa_encrypt")
-	if err != nil {
-		return false, "", err
-	}
-
+func RSAEncrypt(dev Device, keyID string, message string) (bool, string, error) {
 	keyIDBytes := make([]byte, 8)
 	copy(keyIDBytes, []byte(keyID))
 
 	messageBytes := []byte(message)
-	messageLength := len(messageBytes)
 
 	encryptedMessage := make([]byte, 256)
 
-	r1, _, _ := rsaEncryptProc.Call(
-		uintptr(unsafe.Pointer(&keyIDBytes[0])),
-		uintptr(unsafe.Pointer(&messageBytes[0])),
-		uintptr(messageLength),
-		uintptr(unsafe.Pointer(&encryptedMessage[0])),
-	)
-
-	if r1 != 0 {
-		return false, "", fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
+	err := dev.RSAEncrypt(keyIDBytes, messageBytes, encryptedMessage)
+	if err != nil {
+		return false, "", err
 	}
 
 	encryptedMessageStr := base64.StdEncoding.EncodeToString(encryptedMessage)
@@ -164,68 +84,37 @@ func RSAEncrypt(dll *syscall.DLL, keyID string, message string) (bool, string, e
 	return true, encryptedMessageStr, nil
 }
 
-func RSADecrypt(dll *syscall.DLL, keyID string, cipher string) (bool, string, error) {
-	rsaDecryptProc, err := dll.FindProc("rsa_decrypt")
+func RSADecrypt(dev Device, keyID string, cipher string) (bool, string, error) {
+	cipherBytes, err := base64.StdEncoding.DecodeString(cipher)
 	if err != nil {
 		return false, "", err
 	}
 
-	keyIDBytes := make([]byte, 8)
-	copy(keyIDBytes, []byte(keyID))
-
-	cipherBytes, err := base64.StdEncoding.DecodeString(cipher)
+	message, err := RSADecryptBytes(dev, keyID, cipherBytes)
 	if err != nil {
 		return false, "", err
 	}
 
-	message := make([]byte, 256)
-	messageLength := 0
-
-	r1, _, _ := rsaDecryptProc.Call(
-		uintptr(unsafe.Pointer(&keyIDBytes[0])),
-		uintptr(unsafe.Pointer(&cipherBytes[0])),
-		uintptr(unsafe.Pointer(&message[0])),
-		uintptr(unsafe.Pointer(&messageLength)),
-	)
-
-	if r1 != 0 {
-		return false, "", fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
-	messageStr := string(message[:messageLength])
-
-	return true, messageStr, nil
+	return true, string(message), nil
 }
 
-func SignBytes(dll *syscall.DLL, keyID string, messageBytes []byte) (bool, []byte, error) {
-	signProc, err := dll.FindProc("rsa_sign")
-	if err != nil {
-		return false, nil, err
-	}
-
+func SignBytes(dev Device, keyID string, messageBytes []byte) (bool, []byte, error) {
 	keyIDBytes := make([]byte, 8)
 	copy(keyIDBytes, []byte(keyID))
 
-	messageLength := len(messageBytes)
 	signature := make([]byte, 256)
 
-	r1, _, _ := signProc.Call(
-		uintptr(unsafe.Pointer(&keyIDBytes[0])),
-		uintptr(unsafe.Pointer(&messageBytes[0])),
-		uintptr(messageLength),
-		uintptr(unsafe.Pointer(&signature[0])),
-	)
-
-	if r1 != 0 {
-		return false, nil, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
+	err := dev.RSASign(keyIDBytes, messageBytes, signature)
+	if err != nil {
+		return false, nil, err
 	}
 
 	return true, signature, nil
 }
 
-func Sign(dll *syscall.DLL, keyID string, message string) (bool, string, error) {
+func Sign(dev Device, keyID string, message string) (bool, string, error) {
 	messageBytes := []byte(message)
-	ok, signature, err := SignBytes(dll, keyID, messageBytes)
+	ok, signature, err := SignBytes(dev, keyID, messageBytes)
 	if err != nil || !ok {
 		return false, "", err
 	}
@@ -233,78 +122,44 @@ func Sign(dll *syscall.DLL, keyID string, message string) (bool, string, error)
 	return true, signatureStr, nil
 }
 
-func Verify(dll *syscall.DLL, keyID string, message string, signature string) (bool, bool, error) {
-	verifyProc, err := dll.FindProc("rsa_verify")
-	if err != nil {
-		return false, false, err
-	}
-
+func Verify(dev Device, keyID string, message string, signature string) (bool, bool, error) {
 	keyIDBytes := make([]byte, 8)
 	copy(keyIDBytes, []byte(keyID))
 
 	messageBytes := []byte(message)
-	messageLength := len(messageBytes)
 
 	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
 	if err != nil {
 		return false, false, err
 	}
 
-	var result byte
-
-	r1, _, _ := verifyProc.Call(
-		uintptr(unsafe.Pointer(&keyIDBytes[0])),
-		uintptr(unsafe.Pointer(&messageBytes[0])),
-		uintptr(messageLength),
-		uintptr(unsafe.Pointer(&signatureBytes[0])),
-		uintptr(unsafe.Pointer(&result)),
-	)
-
-	if r1 != 0 {
-		return false, false, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
+	valid, err := dev.RSAVerify(keyIDBytes, messageBytes, signatureBytes)
+	if err != nil {
+		return false, false, err
 	}
 
-	return true, result == 1, nil
+	return true, valid, nil
 }
 
-func DeleteKey(dll *syscall.DLL, keyID string) (bool, error) {
-	deleteKeyProc, err := dll.FindProc("delete_rsa_key")
-	if err != nil {
-		return false, err
-	}
-
+func DeleteKey(dev Device, keyID string) (bool, error) {
 	keyIDBytes := make([]byte, 8)
 	copy(keyIDBytes, []byte(keyID))
 
-	r1, _, _ := deleteKeyProc.Call(
-		uintptr(unsafe.Pointer(&keyIDBytes[0])),
-	)
-
-	if r1 != 0 {
-		return false, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
+	err := dev.DeleteRSAKey(keyIDBytes)
+	if err != nil {
+		return false, err
 	}
 
 	return true, nil
 }
 
-func ListKeys(dll *syscall.DLL) (bool, uint8, []string, []string, error) {
-	listKeysProc, err := dll.FindProc("list_all_key_ids")
-	if err != nil {
-		return false, 0, nil, nil, err
-	}
-
-	var keyCount uint8
+func ListKeys(dev Device) (bool, uint8, []string, []string, error) {
 	keyIDs := make([]byte, 16*8)
 	customIDs := make([]byte, 16*8)
 
-	r1, _, _ := listKeysProc.Call(
-		uintptr(unsafe.Pointer(&keyCount)),
-		uintptr(unsafe.Pointer(&keyIDs[0])),
-		uintptr(unsafe.Pointer(&customIDs[0])),
-	)
-
-	if r1 != 0 {
-		return false, 0, nil, nil, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
+	keyCount, err := dev.ListAllKeyIDs(keyIDs, customIDs)
+	if err != nil {
+		return false, 0, nil, nil, err
 	}
 
 	keyIDList := make([]string, 0)
@@ -354,17 +209,11 @@ func ListKeys(dll *syscall.DLL) (bool, uint8, []string, []string, error) {
 	return true, keyCount, keyIDList, customIDList, nil
 }
 
-func ResetKeys(dll *syscall.DLL) (bool, error) {
-	resetKeysProc, err := dll.FindProc("reset_all_keys")
+func ResetKeys(dev Device) (bool, error) {
+	err := dev.ResetAllKeys()
 	if err != nil {
 		return false, err
 	}
 
-	r1, _, _ := resetKeysProc.Call()
-
-	if r1 != 0 {
-		return false, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
 	return true, nil
 }
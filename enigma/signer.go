@@ -0,0 +1,80 @@
+package enigma
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrPrehashed is returned when asked to sign a digest. rsa_sign hashes the
+// whole message itself, so a digest computed elsewhere cannot be signed.
+var ErrPrehashed = errors.New("the device signs whole messages and cannot sign a precomputed digest, use SignMessage")
+
+// ErrSignatureScheme is returned for signature schemes the device does not
+// implement.
+var ErrSignatureScheme = errors.New("the device only signs with PKCS#1 v1.5 and SHA-256")
+
+// RSASigner is a crypto.Signer for an RSA key on the device.
+//
+// rsa_sign takes the message rather than its digest and signs its SHA-256
+// with PKCS#1 v1.5, so only SignMessage works, and only for that scheme.
+// Sign, which receives a digest, always fails with ErrPrehashed. SignMessage
+// has the signature of crypto.MessageSigner, which x509, tls and other
+// packages use in place of Sign from Go 1.25.
+type RSASigner struct {
+	dev   Device
+	keyID string
+	pub   *rsa.PublicKey
+}
+
+var _ crypto.Signer = (*RSASigner)(nil)
+
+// NewRSASigner returns a signer for the key keyID, whose public key is pub,
+// as returned by a KeyRing or GenerateKey.
+func NewRSASigner(dev Device, keyID string, pub *rsa.PublicKey) *RSASigner {
+	return &RSASigner{dev: dev, keyID: keyID, pub: pub}
+}
+
+// KeyID returns the device key ID.
+func (s *RSASigner) KeyID() string {
+	return s.keyID
+}
+
+// Public returns the *rsa.PublicKey of the key.
+func (s *RSASigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign fails with ErrPrehashed, since the device cannot sign a digest.
+func (s *RSASigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return nil, ErrPrehashed
+}
+
+// SignMessage signs message with PKCS#1 v1.5 and SHA-256 on the device.
+// opts must be nil or crypto.SHA256; other hashes and PSS fail with
+// ErrSignatureScheme. The signature is checked against the public key
+// before it is returned, which catches a public key that does not belong
+// to the key ID.
+func (s *RSASigner) SignMessage(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts != nil {
+		if _, pss := opts.(*rsa.PSSOptions); pss {
+			return nil, fmt.Errorf("%w, not PSS", ErrSignatureScheme)
+		}
+		if hash := opts.HashFunc(); hash != crypto.SHA256 {
+			return nil, fmt.Errorf("%w, not %v", ErrSignatureScheme, hash)
+		}
+	}
+
+	_, signature, err := SignBytes(s.dev, s.keyID, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if !VerifyBytesOffline(s.pub, message, signature) {
+		return nil, fmt.Errorf("signature of %s does not verify with its public key", s.keyID)
+	}
+
+	return signature, nil
+}
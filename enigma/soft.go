@@ -0,0 +1,630 @@
+package enigma
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	softVersion      = "enigma-soft 1.0.0"
+	softDefaultPIN   = "000000"
+	softMaxRetry     = 5
+	softDeviceKeyID  = "enova-00"
+	softRSAKeyBits   = 2048
+	softKeySlotCount = 16
+)
+
+// SoftDevice is a software token emulating the EnovaMX.dll exports. Its AES
+// key, RSA key slots, PIN and retry counter are kept in an encrypted
+// keystore file that is rewritten after every change, so state survives
+// across processes the same way it does on the dongle.
+//
+// Like the hardware, AESStreamEncDec applies the AES key to every 16-byte
+// block independently, key IDs are 8 bytes ("enova-01" to "enova-16" for
+// the 16 slots) and the built-in device key "enova-00" is never listed,
+// deleted or reset. rsa_sign signs the SHA-256 digest of the message with
+// PKCS#1 v1.5 and rsa_encrypt uses PKCS#1 v1.5 padding, silently truncating
+// messages longer than one modulus. Failures are reported with the codes
+// from GetCodeMessage. The XMSS exports are not available.
+type SoftDevice struct {
+	mu         sync.Mutex
+	path       string
+	passphrase string
+	state      *softState
+}
+
+// CreateSoft opens the software token stored at keystorePath, creating a
+// fresh token with PIN 000000 if the file does not exist yet.
+func CreateSoft(keystorePath string, passphrase string) (Device, error) {
+	state, err := loadKeystore(keystorePath, passphrase)
+	if errors.Is(err, fs.ErrNotExist) {
+		state, err = newSoftState()
+		if err != nil {
+			return nil, err
+		}
+		err = saveKeystore(keystorePath, passphrase, state)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &SoftDevice{
+		path:       keystorePath,
+		passphrase: passphrase,
+		state:      state,
+	}, nil
+}
+
+func newSoftState() (*softState, error) {
+	state := &softState{
+		UID:       make([]byte, 16),
+		AESKey:    make([]byte, 32),
+		PIN:       softDefaultPIN,
+		RetryLeft: softMaxRetry,
+	}
+
+	if _, err := rand.Read(state.UID); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(state.AESKey); err != nil {
+		return nil, err
+	}
+
+	deviceKey, err := rsa.GenerateKey(rand.Reader, softRSAKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	state.DeviceKey = x509.MarshalPKCS1PrivateKey(deviceKey)
+
+	return state, nil
+}
+
+func (d *SoftDevice) save() error {
+	return saveKeystore(d.path, d.passphrase, d.state)
+}
+
+func (d *SoftDevice) requireLogin(op string) error {
+	if !d.state.LoggedIn {
+		return newStatusError(op, 0x33)
+	}
+	return nil
+}
+
+func (d *SoftDevice) Release() error {
+	return nil
+}
+
+func (d *SoftDevice) APIVersion() (string, error) {
+	return softVersion, nil
+}
+
+func (d *SoftDevice) DetectDevice() (bool, error) {
+	return true, nil
+}
+
+func (d *SoftDevice) ChipSN() ([16]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var uid [16]byte
+	copy(uid[:], d.state.UID)
+	return uid, nil
+}
+
+func (d *SoftDevice) CheckLoginStatus() (RETStatus, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := RETStatus{
+		RetryCountLeftIsValid: 1,
+		RetryCountLeft:        d.state.RetryLeft,
+	}
+
+	if d.state.RetryLeft == 0 {
+		status.Result = 0x35
+	} else if !d.state.LoggedIn {
+		status.Result = 0x33
+	}
+
+	return status, nil
+}
+
+func (d *SoftDevice) LoginPIN(pin string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !validSoftPIN(pin) {
+		return newStatusError("mxLoginPIN", 0x32)
+	}
+
+	if d.state.RetryLeft == 0 {
+		return newStatusError("mxLoginPIN", 0x35)
+	}
+
+	if pin != d.state.PIN {
+		d.state.RetryLeft--
+		d.state.LoggedIn = false
+		if err := d.save(); err != nil {
+			return err
+		}
+		return newStatusError("mxLoginPIN", 0x33)
+	}
+
+	d.state.RetryLeft = softMaxRetry
+	d.state.LoggedIn = true
+
+	return d.save()
+}
+
+func (d *SoftDevice) ChangePIN(newPin string, confirmPin string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("mxChangePIN"); err != nil {
+		return err
+	}
+
+	if !validSoftPIN(newPin) {
+		return newStatusError("mxChangePIN", 0x32)
+	}
+
+	if newPin != confirmPin {
+		return newStatusError("mxChangePIN", 0x33)
+	}
+
+	d.state.PIN = newPin
+
+	return d.save()
+}
+
+func validSoftPIN(pin string) bool {
+	return len(pin) >= 4 && len(pin) <= 16
+}
+
+func (d *SoftDevice) AESStreamEncDec(input []byte, output []byte, sectors int, encrypt bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	failCode := uint8(0x58)
+	if encrypt {
+		failCode = 0x54
+	}
+
+	if err := d.requireLogin("AESStreamEncDec"); err != nil {
+		return err
+	}
+
+	size := sectors * sectorSize
+	if sectors <= 0 || len(input) < size || len(output) < size {
+		return newStatusError("AESStreamEncDec", failCode)
+	}
+
+	if err := d.cryptBlocks(output[:size], input[:size], encrypt); err != nil {
+		return newStatusError("AESStreamEncDec", failCode)
+	}
+
+	return nil
+}
+
+// cryptBlocks applies the token AES key to every 16-byte block of src.
+func (d *SoftDevice) cryptBlocks(dst, src []byte, encrypt bool) error {
+	block, err := aes.NewCipher(d.state.AESKey)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(src); i += aes.BlockSize {
+		if encrypt {
+			block.Encrypt(dst[i:i+aes.BlockSize], src[i:i+aes.BlockSize])
+		} else {
+			block.Decrypt(dst[i:i+aes.BlockSize], src[i:i+aes.BlockSize])
+		}
+	}
+
+	return nil
+}
+
+// FileAES encrypts sourceFilePath/sourceFileName into targetPath, appending
+// ".emx" to the file name, or reverses that when decrypting. The file body
+// is ISO 9797-1 method 2 padded and encrypted with the token AES key.
+func (d *SoftDevice) FileAES(sourceFilePath, sourceFileName, targetPath string, encrypt bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("FileAES"); err != nil {
+		return err
+	}
+
+	failCode := uint8(0x58)
+	targetName := strings.TrimSuffix(filepath.Base(sourceFileName), ".emx")
+	if encrypt {
+		failCode = 0x54
+		targetName = filepath.Base(sourceFileName) + ".emx"
+	}
+
+	input, err := os.ReadFile(filepath.Join(sourceFilePath, sourceFileName))
+	if err != nil {
+		return newStatusError("FileAES", 0x50)
+	}
+
+	targetFile := filepath.Join(targetPath, targetName)
+	if _, err := os.Stat(targetFile); err == nil {
+		return newStatusError("FileAES", 0x51)
+	}
+
+	if encrypt {
+		input = ISO9797_1_Method2Padding(input, aes.BlockSize)
+	} else if len(input) == 0 || len(input)%aes.BlockSize != 0 {
+		return newStatusError("FileAES", failCode)
+	}
+
+	output := make([]byte, len(input))
+	if err := d.cryptBlocks(output, input, encrypt); err != nil {
+		return newStatusError("FileAES", failCode)
+	}
+
+	if !encrypt {
+		output = ISO9797_1_Method2Unpadding(output)
+	}
+
+	f, err := os.OpenFile(targetFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return newStatusError("FileAES", 0x52)
+	}
+
+	if _, err := f.Write(output); err != nil {
+		f.Close()
+		return newStatusError("FileAES", failCode)
+	}
+
+	if err := f.Close(); err != nil {
+		return newStatusError("FileAES", failCode)
+	}
+
+	return nil
+}
+
+func (d *SoftDevice) GenerateRSAKey(customID, keyID, pubKeyN, pubKeyE []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("generate_rsa_key"); err != nil {
+		return err
+	}
+
+	slot := d.freeSlot()
+	if slot < 0 {
+		return newStatusError("generate_rsa_key", 0x10)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, softRSAKeyBits)
+	if err != nil {
+		return newStatusError("generate_rsa_key", 0x10)
+	}
+
+	d.state.Slots[slot] = softSlot{
+		KeyID:      softSlotKeyID(slot),
+		CustomID:   trimID(customID),
+		N:          key.N.Bytes(),
+		E:          big.NewInt(int64(key.E)).Bytes(),
+		PrivateKey: x509.MarshalPKCS1PrivateKey(key),
+	}
+
+	if err := d.save(); err != nil {
+		return err
+	}
+
+	copy(keyID, softSlotKeyID(slot))
+	key.N.FillBytes(pubKeyN[:256])
+	big.NewInt(int64(key.E)).FillBytes(pubKeyE[:256])
+
+	return nil
+}
+
+func (d *SoftDevice) StoreExternalPublicKey(customID, pubKeyN, pubKeyE, keyID []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("store_external_public_key"); err != nil {
+		return err
+	}
+
+	if _, err := softPublicKey(pubKeyN[:256], pubKeyE[:256]); err != nil {
+		return newStatusError("store_external_public_key", 0x10)
+	}
+
+	slot := d.freeSlot()
+	if slot < 0 {
+		return newStatusError("store_external_public_key", 0x10)
+	}
+
+	d.state.Slots[slot] = softSlot{
+		KeyID:    softSlotKeyID(slot),
+		CustomID: trimID(customID),
+		N:        new(big.Int).SetBytes(pubKeyN[:256]).Bytes(),
+		E:        new(big.Int).SetBytes(pubKeyE[:256]).Bytes(),
+	}
+
+	if err := d.save(); err != nil {
+		return err
+	}
+
+	copy(keyID, softSlotKeyID(slot))
+
+	return nil
+}
+
+func (d *SoftDevice) SetTransPublicKey(pubKeyN, pubKeyE []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("set_trans_public_key"); err != nil {
+		return err
+	}
+
+	if _, err := softPublicKey(pubKeyN[:256], pubKeyE[:256]); err != nil {
+		return newStatusError("set_trans_public_key", 0x10)
+	}
+
+	d.state.TransKeyN = new(big.Int).SetBytes(pubKeyN[:256]).Bytes()
+	d.state.TransKeyE = new(big.Int).SetBytes(pubKeyE[:256]).Bytes()
+
+	return d.save()
+}
+
+func (d *SoftDevice) RSAEncrypt(keyID, message, encrypted []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("rsa_encrypt"); err != nil {
+		return err
+	}
+
+	pub, _, err := d.lookupKey("rsa_encrypt", keyID)
+	if err != nil {
+		return err
+	}
+
+	if limit := pub.Size() - 11; len(message) > limit {
+		message = message[:limit]
+	}
+
+	out, err := rsa.EncryptPKCS1v15(rand.Reader, pub, message)
+	if err != nil {
+		return newStatusError("rsa_encrypt", 0x54)
+	}
+
+	copy(encrypted[:256], out)
+
+	return nil
+}
+
+func (d *SoftDevice) RSADecrypt(keyID, cipher, message []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("rsa_decrypt"); err != nil {
+		return 0, err
+	}
+
+	_, priv, err := d.lookupKey("rsa_decrypt", keyID)
+	if err != nil {
+		return 0, err
+	}
+
+	if priv == nil || len(cipher) != priv.Size() {
+		return 0, newStatusError("rsa_decrypt", 0x58)
+	}
+
+	out, err := rsa.DecryptPKCS1v15(nil, priv, cipher)
+	if err != nil || len(out) > len(message) {
+		return 0, newStatusError("rsa_decrypt", 0x58)
+	}
+
+	return copy(message, out), nil
+}
+
+func (d *SoftDevice) RSASign(keyID, message, signature []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("rsa_sign"); err != nil {
+		return err
+	}
+
+	_, priv, err := d.lookupKey("rsa_sign", keyID)
+	if err != nil {
+		return err
+	}
+
+	if priv == nil {
+		return newStatusError("rsa_sign", 0x02)
+	}
+
+	digest := sha256.Sum256(message)
+	out, err := rsa.SignPKCS1v15(nil, priv, crypto.SHA256, digest[:])
+	if err != nil {
+		return newStatusError("rsa_sign", 0x54)
+	}
+
+	copy(signature[:256], out)
+
+	return nil
+}
+
+func (d *SoftDevice) RSAVerify(keyID, message, signature []byte) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("rsa_verify"); err != nil {
+		return false, err
+	}
+
+	pub, _, err := d.lookupKey("rsa_verify", keyID)
+	if err != nil {
+		return false, err
+	}
+
+	digest := sha256.Sum256(message)
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil, nil
+}
+
+func (d *SoftDevice) DeleteRSAKey(keyID []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("delete_rsa_key"); err != nil {
+		return err
+	}
+
+	id := trimID(keyID)
+	if i := d.findSlot(id); id != "" && i >= 0 {
+		d.state.Slots[i] = softSlot{}
+		return d.save()
+	}
+
+	if id == softDeviceKeyID {
+		return newStatusError("delete_rsa_key", 0x10)
+	}
+
+	return newStatusError("delete_rsa_key", 0x02)
+}
+
+func (d *SoftDevice) ListAllKeyIDs(keyIDs, customIDs []byte) (uint8, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("list_all_key_ids"); err != nil {
+		return 0, err
+	}
+
+	clear(keyIDs[:softKeySlotCount*8])
+	clear(customIDs[:softKeySlotCount*8])
+
+	var count uint8
+	for i, slot := range d.state.Slots {
+		if slot.KeyID == "" {
+			continue
+		}
+		copy(keyIDs[i*8:i*8+8], slot.KeyID)
+		copy(customIDs[i*8:i*8+8], slot.CustomID)
+		count++
+	}
+
+	return count, nil
+}
+
+func (d *SoftDevice) ResetAllKeys() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.requireLogin("reset_all_keys"); err != nil {
+		return err
+	}
+
+	d.state.Slots = [softKeySlotCount]softSlot{}
+	d.state.TransKeyN = nil
+	d.state.TransKeyE = nil
+
+	return d.save()
+}
+
+func (d *SoftDevice) XMSSOpenHandle() error {
+	return errors.New("MxpOpenHandle is not supported by the software token")
+}
+
+func (d *SoftDevice) XMSSCloseHandle() error {
+	return errors.New("MxpCloseHandle is not supported by the software token")
+}
+
+func (d *SoftDevice) XMSSGetParam(param *XMSSParam) error {
+	return errors.New("MxpGetParam is not supported by the software token")
+}
+
+func (d *SoftDevice) XMSSKeyGen(isXMSSMT bool, oid, skeyFile, pkeyFile string) error {
+	return errors.New("XmssKeyGen is not supported by the software token")
+}
+
+func (d *SoftDevice) XMSSSign(skeyFile, msgFile, sigFile string) error {
+	return errors.New("XmssSign is not supported by the software token")
+}
+
+func (d *SoftDevice) XMSSVerify(pkeyFile, sigFile, msgFile string) error {
+	return errors.New("XmssVerify is not supported by the software token")
+}
+
+func (d *SoftDevice) freeSlot() int {
+	return d.findSlot("")
+}
+
+func (d *SoftDevice) findSlot(id string) int {
+	for i, slot := range d.state.Slots {
+		if slot.KeyID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// lookupKey resolves an 8-byte key ID to its public key and, when the slot
+// holds one, its private key.
+func (d *SoftDevice) lookupKey(op string, keyID []byte) (*rsa.PublicKey, *rsa.PrivateKey, error) {
+	id := trimID(keyID)
+
+	der := d.state.DeviceKey
+	if id != softDeviceKeyID {
+		i := d.findSlot(id)
+		if id == "" || i < 0 {
+			return nil, nil, newStatusError(op, 0x02)
+		}
+
+		slot := d.state.Slots[i]
+		if slot.PrivateKey == nil {
+			pub, err := softPublicKey(slot.N, slot.E)
+			if err != nil {
+				return nil, nil, newStatusError(op, 0x02)
+			}
+			return pub, nil, nil
+		}
+		der = slot.PrivateKey
+	}
+
+	priv, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return nil, nil, newStatusError(op, 0x02)
+	}
+
+	return &priv.PublicKey, priv, nil
+}
+
+func softPublicKey(n, e []byte) (*rsa.PublicKey, error) {
+	modulus := new(big.Int).SetBytes(n)
+	exponent := new(big.Int).SetBytes(e)
+
+	if modulus.Sign() == 0 || !exponent.IsInt64() || exponent.Int64() < 3 {
+		return nil, errors.New("invalid RSA public key")
+	}
+
+	return &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}, nil
+}
+
+func softSlotKeyID(slot int) string {
+	return fmt.Sprintf("enova-%02d", slot+1)
+}
+
+func trimID(id []byte) string {
+	return string(bytes.TrimRight(id, "\x00"))
+}
@@ -0,0 +1,224 @@
+package enigma
+
+import (
+	"errors"
+	"io"
+)
+
+// streamSectors is the number of sectors sent to AESStreamEncDec per call by
+// the streaming encrypter and decrypter, bounding their memory use to a few
+// times 32 KiB regardless of the input size.
+const streamSectors = 64
+
+const streamBatchSize = streamSectors * sectorSize
+
+// ErrCiphertextLength is returned when a ciphertext does not end on an AES
+// block boundary.
+var ErrCiphertextLength = errors.New("ciphertext length is not a multiple of the AES block size")
+
+type aesEncryptWriter struct {
+	dev     Device
+	w       io.Writer
+	padding Padding
+	pending []byte
+	input   []byte
+	output  []byte
+	err     error
+	closed  bool
+}
+
+// NewAESEncryptWriter returns a writer that encrypts everything written to
+// it with the device AES key and writes the ciphertext to w. Data is sent to
+// the device in batches of streamSectors sectors; Close pads the final chunk
+// with ISO 9797-1 method 2 and flushes it. The output is byte-identical to
+// AESEncryptBytes over the same input. Closing does not close w.
+func NewAESEncryptWriter(dev Device, w io.Writer) io.WriteCloser {
+	return NewAESEncryptWriterWithPadding(dev, w, PaddingISO9797M2)
+}
+
+// NewAESEncryptWriterWithPadding is NewAESEncryptWriter with a choice of
+// padding. With PaddingNone, Close fails unless the total input is aligned.
+func NewAESEncryptWriterWithPadding(dev Device, w io.Writer, padding Padding) io.WriteCloser {
+	return &aesEncryptWriter{
+		dev:     dev,
+		w:       w,
+		padding: padding,
+		pending: make([]byte, 0, streamBatchSize),
+		input:   make([]byte, streamBatchSize),
+		output:  make([]byte, streamBatchSize),
+	}
+}
+
+func (e *aesEncryptWriter) Write(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	if e.closed {
+		return 0, errors.New("write to closed AES encrypt writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.pending[len(e.pending):cap(e.pending)], p)
+		e.pending = e.pending[:len(e.pending)+n]
+		p = p[n:]
+		written += n
+
+		if len(e.pending) == streamBatchSize {
+			if err := e.flush(e.pending); err != nil {
+				return written, err
+			}
+			e.pending = e.pending[:0]
+		}
+	}
+
+	return written, nil
+}
+
+func (e *aesEncryptWriter) Close() error {
+	if e.closed {
+		return e.err
+	}
+	e.closed = true
+
+	if e.err != nil {
+		return e.err
+	}
+
+	// The pad never spans more than one block, so the final chunk still fits
+	// in the batch buffers unless pending is exactly full, which Write avoids.
+	padded, err := e.padding.Pad(e.pending, 16)
+	if err != nil {
+		e.err = err
+		return err
+	}
+	if len(padded) == 0 {
+		return nil
+	}
+
+	return e.flush(padded)
+}
+
+// flush encrypts chunk, whose length must be a multiple of 16, and writes
+// the result to the underlying writer.
+func (e *aesEncryptWriter) flush(chunk []byte) error {
+	sectors := (len(chunk) + sectorSize - 1) / sectorSize
+	size := sectors * sectorSize
+
+	copy(e.input, chunk)
+	clear(e.input[len(chunk):size])
+
+	if err := e.dev.AESStreamEncDec(e.input[:size], e.output[:size], sectors, true); err != nil {
+		e.err = err
+		return err
+	}
+
+	if _, err := e.w.Write(e.output[:len(chunk)]); err != nil {
+		e.err = err
+		return err
+	}
+
+	return nil
+}
+
+type aesDecryptReader struct {
+	dev     Device
+	r       io.Reader
+	padding Padding
+	buf     []byte
+	input   []byte
+	output  []byte
+	ready   []byte
+	eof     bool
+	err     error
+}
+
+// NewAESDecryptReader returns a reader that decrypts ciphertext read from r
+// with the device AES key. Ciphertext is sent to the device in batches of
+// streamSectors sectors, and the ISO 9797-1 method 2 padding is removed from
+// the final chunk only, matching AESDecryptBytes over the same input.
+func NewAESDecryptReader(dev Device, r io.Reader) io.Reader {
+	return NewAESDecryptReaderWithPadding(dev, r, PaddingISO9797M2)
+}
+
+// NewAESDecryptReaderWithPadding is NewAESDecryptReader with a choice of
+// padding. Invalid padding at the end of the stream is reported as a
+// *PaddingError.
+func NewAESDecryptReaderWithPadding(dev Device, r io.Reader, padding Padding) io.Reader {
+	return &aesDecryptReader{
+		dev:     dev,
+		r:       r,
+		padding: padding,
+		// One extra block is read ahead so the final block, which holds
+		// the padding, is never decrypted before EOF is known.
+		buf:    make([]byte, 0, streamBatchSize+16),
+		input:  make([]byte, streamBatchSize),
+		output: make([]byte, streamBatchSize),
+	}
+}
+
+func (d *aesDecryptReader) Read(p []byte) (int, error) {
+	for len(d.ready) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.fill()
+	}
+
+	n := copy(p, d.ready)
+	d.ready = d.ready[n:]
+	return n, nil
+}
+
+// fill reads the next batch of ciphertext and decrypts it into ready. It
+// returns io.EOF once the final chunk has been decrypted and unpadded.
+func (d *aesDecryptReader) fill() error {
+	for !d.eof && len(d.buf) < cap(d.buf) {
+		n, err := d.r.Read(d.buf[len(d.buf):cap(d.buf)])
+		d.buf = d.buf[:len(d.buf)+n]
+		if err == io.EOF {
+			d.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// A read that fills the look-ahead and reports EOF at once leaves more
+	// than a batch; the final chunk is then the tail, on the next call.
+	final := d.eof && len(d.buf) <= streamBatchSize
+
+	chunk := d.buf
+	if !final {
+		chunk = d.buf[:streamBatchSize]
+	} else if len(chunk)%16 != 0 {
+		return ErrCiphertextLength
+	}
+
+	if len(chunk) > 0 {
+		sectors := (len(chunk) + sectorSize - 1) / sectorSize
+		size := sectors * sectorSize
+
+		copy(d.input, chunk)
+		clear(d.input[len(chunk):size])
+
+		if err := d.dev.AESStreamEncDec(d.input[:size], d.output[:size], sectors, false); err != nil {
+			return err
+		}
+	}
+
+	d.ready = d.output[:len(chunk)]
+	if final {
+		ready, err := d.padding.Unpad(d.ready, 16)
+		if err != nil {
+			d.ready = nil
+			return err
+		}
+
+		d.ready = ready
+		d.buf = d.buf[:0]
+		return io.EOF
+	}
+
+	d.buf = d.buf[:copy(d.buf, d.buf[streamBatchSize:])]
+	return nil
+}
@@ -0,0 +1,402 @@
+package enigma
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Certificates, requests and revocation lists are all
+//
+//	SEQUENCE { to-be-signed, signature algorithm, signature }
+//
+// rsa_sign only signs whole messages, which crypto/x509 before Go 1.25
+// cannot use, so they are built by crypto/x509 with a software stand-in
+// key and then signed again on the device over the same to-be-signed
+// bytes. The stand-in never appears in the output: requests carry the
+// device key in place of it, and certificates and lists do not contain
+// the key that signed them.
+type signedDER struct {
+	TBS       asn1.RawValue
+	Algorithm pkix.AlgorithmIdentifier
+	Signature asn1.BitString
+}
+
+// tbsCertificateRequest is a PKCS#10 CertificationRequestInfo.
+type tbsCertificateRequest struct {
+	Version    int
+	Subject    asn1.RawValue
+	PublicKey  asn1.RawValue
+	Attributes asn1.RawValue
+}
+
+var standInKey = sync.OnceValues(func() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, DeviceKeyBits)
+})
+
+// deviceSignature checks that the device signs with the algorithm alg and
+// returns it.
+func deviceSignature(alg x509.SignatureAlgorithm) (x509.SignatureAlgorithm, error) {
+	if alg != x509.UnknownSignatureAlgorithm && alg != x509.SHA256WithRSA {
+		return 0, fmt.Errorf("%w, not %v", ErrSignatureScheme, alg)
+	}
+	return x509.SHA256WithRSA, nil
+}
+
+// resign replaces the to-be-signed part of der with tbs, if not nil, and
+// its signature with one from the device.
+func resign(der []byte, tbs []byte, signer *RSASigner) ([]byte, error) {
+	var signed signedDER
+	if rest, err := asn1.Unmarshal(der, &signed); err != nil || len(rest) != 0 {
+		return nil, errors.New("x509: cannot re-sign the structure built by crypto/x509")
+	}
+
+	if tbs != nil {
+		signed.TBS = asn1.RawValue{FullBytes: tbs}
+	}
+
+	signature, err := signer.SignMessage(nil, signed.TBS.FullBytes, nil)
+	if err != nil {
+		return nil, err
+	}
+	signed.Signature = asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)}
+
+	return asn1.Marshal(signed)
+}
+
+// CreateCertificateRequest returns a DER PKCS#10 certificate request for the
+// key of signer, signed on the device. The subject, SANs and extensions
+// come from template; its signature algorithm must be unset or
+// x509.SHA256WithRSA.
+func CreateCertificateRequest(signer *RSASigner, template *x509.CertificateRequest) ([]byte, error) {
+	alg, err := deviceSignature(template.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	standIn, err := standInKey()
+	if err != nil {
+		return nil, err
+	}
+
+	t := *template
+	t.SignatureAlgorithm = alg
+	der, err := x509.CreateCertificateRequest(rand.Reader, &t, standIn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Put the device key in place of the stand-in
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+
+	var info tbsCertificateRequest
+	if _, err := asn1.Unmarshal(csr.RawTBSCertificateRequest, &info); err != nil {
+		return nil, err
+	}
+
+	spki, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	info.PublicKey = asn1.RawValue{FullBytes: spki}
+
+	tbs, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	return resign(der, tbs, signer)
+}
+
+// CreateCertificate returns a DER certificate for pub as described by
+// template, issued by parent and signed on the device with the key of
+// signer, which must be the key parent certifies. For a self-signed
+// certificate, parent is template and signer holds the key of pub. The
+// signature algorithm of template must be unset or x509.SHA256WithRSA.
+func CreateCertificate(template, parent *x509.Certificate, pub any, signer *RSASigner) ([]byte, error) {
+	alg, err := deviceSignature(template.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	standIn, err := standInKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if parent.PublicKey != nil && !signer.pub.Equal(parent.PublicKey) {
+		return nil, errors.New("x509: the signer key does not match the parent certificate")
+	}
+
+	// crypto/x509 checks the key of parent against the one signing
+	t := *template
+	t.SignatureAlgorithm = alg
+	issuer := *parent
+	issuer.PublicKey = nil
+
+	der, err := x509.CreateCertificate(rand.Reader, &t, &issuer, pub, standIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return resign(der, nil, signer)
+}
+
+// CreateRevocationList returns a DER CRL as described by template, issued by
+// issuer and signed on the device with the key of signer. issuer must have
+// the cRLSign key usage and a subject key ID.
+func CreateRevocationList(template *x509.RevocationList, issuer *x509.Certificate, signer *RSASigner) ([]byte, error) {
+	alg, err := deviceSignature(template.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	standIn, err := standInKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if !signer.pub.Equal(issuer.PublicKey) {
+		return nil, errors.New("x509: the signer key does not match the issuer certificate")
+	}
+
+	t := *template
+	t.SignatureAlgorithm = alg
+	der, err := x509.CreateRevocationList(rand.Reader, &t, issuer, standIn)
+	if err != nil {
+		return nil, err
+	}
+
+	return resign(der, nil, signer)
+}
+
+var keyUsageNames = []string{
+	"digitalSignature",
+	"contentCommitment",
+	"keyEncipherment",
+	"dataEncipherment",
+	"keyAgreement",
+	"keyCertSign",
+	"cRLSign",
+	"encipherOnly",
+	"decipherOnly",
+}
+
+// ParseKeyUsage converts key usage names as in RFC 5280, such as
+// digitalSignature or keyCertSign, to an x509.KeyUsage. nonRepudiation is
+// accepted for contentCommitment.
+func ParseKeyUsage(names []string) (x509.KeyUsage, error) {
+	var usage x509.KeyUsage
+	for _, name := range names {
+		if name == "nonRepudiation" {
+			name = "contentCommitment"
+		}
+
+		i := indexFold(keyUsageNames, name)
+		if i < 0 {
+			return 0, fmt.Errorf("unknown key usage %q, expected one of %s", name, strings.Join(keyUsageNames, ", "))
+		}
+		usage |= 1 << i
+	}
+	return usage, nil
+}
+
+var extKeyUsageNames = map[string]x509.ExtKeyUsage{
+	"any":             x509.ExtKeyUsageAny,
+	"serverAuth":      x509.ExtKeyUsageServerAuth,
+	"clientAuth":      x509.ExtKeyUsageClientAuth,
+	"codeSigning":     x509.ExtKeyUsageCodeSigning,
+	"emailProtection": x509.ExtKeyUsageEmailProtection,
+	"timeStamping":    x509.ExtKeyUsageTimeStamping,
+	"OCSPSigning":     x509.ExtKeyUsageOCSPSigning,
+}
+
+// ParseExtKeyUsage converts extended key usage names as in RFC 5280, such
+// as serverAuth or codeSigning, to x509.ExtKeyUsage values.
+func ParseExtKeyUsage(names []string) ([]x509.ExtKeyUsage, error) {
+	var usages []x509.ExtKeyUsage
+	for _, name := range names {
+		found := false
+		for known, usage := range extKeyUsageNames {
+			if strings.EqualFold(known, name) {
+				usages = append(usages, usage)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown extended key usage %q, expected any, serverAuth, clientAuth, codeSigning, emailProtection, timeStamping or OCSPSigning", name)
+		}
+	}
+	return usages, nil
+}
+
+var (
+	oidExtKeyUsage    = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+	oidExtKeyUsages = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+		x509.ExtKeyUsageAny:             {2, 5, 29, 37, 0},
+		x509.ExtKeyUsageServerAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+		x509.ExtKeyUsageClientAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+		x509.ExtKeyUsageCodeSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+		x509.ExtKeyUsageEmailProtection: {1, 3, 6, 1, 5, 5, 7, 3, 4},
+		x509.ExtKeyUsageTimeStamping:    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+		x509.ExtKeyUsageOCSPSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+	}
+)
+
+// KeyUsageExtensions returns the key usage and extended key usage
+// extensions for a certificate request, which unlike x509.Certificate has
+// no fields for them. Either is left out if empty.
+func KeyUsageExtensions(usage x509.KeyUsage, extUsages []x509.ExtKeyUsage) ([]pkix.Extension, error) {
+	var extensions []pkix.Extension
+
+	if usage != 0 {
+		// Bit i of the BIT STRING is 1 << i, without trailing zero bits
+		var b [2]byte
+		b[0] = bits.Reverse8(uint8(usage))
+		b[1] = bits.Reverse8(uint8(usage >> 8))
+		length := 1
+		if b[1] != 0 {
+			length = 2
+		}
+		bitLength := 8*length - bits.TrailingZeros8(b[length-1])
+
+		value, err := asn1.Marshal(asn1.BitString{Bytes: b[:length], BitLength: bitLength})
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtKeyUsage, Critical: true, Value: value})
+	}
+
+	if len(extUsages) > 0 {
+		oids := make([]asn1.ObjectIdentifier, len(extUsages))
+		for i, usage := range extUsages {
+			oid, ok := oidExtKeyUsages[usage]
+			if !ok {
+				return nil, fmt.Errorf("unsupported extended key usage %d", usage)
+			}
+			oids[i] = oid
+		}
+
+		value, err := asn1.Marshal(oids)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtExtKeyUsage, Value: value})
+	}
+
+	return extensions, nil
+}
+
+var nameAttributes = map[string]asn1.ObjectIdentifier{
+	"CN":           {2, 5, 4, 3},
+	"SERIALNUMBER": {2, 5, 4, 5},
+	"C":            {2, 5, 4, 6},
+	"L":            {2, 5, 4, 7},
+	"ST":           {2, 5, 4, 8},
+	"STREET":       {2, 5, 4, 9},
+	"O":            {2, 5, 4, 10},
+	"OU":           {2, 5, 4, 11},
+	"POSTALCODE":   {2, 5, 4, 17},
+	"EMAILADDRESS": {1, 2, 840, 113549, 1, 9, 1},
+	"UID":          {0, 9, 2342, 19200300, 100, 1, 1},
+	"DC":           {0, 9, 2342, 19200300, 100, 1, 25},
+}
+
+// ParseName parses a distinguished name written as in RFC 4514, such as
+// "CN=build server,O=Example\, Inc.,C=TW". As in RFC 4514 the string
+// lists the least significant attribute first, the reverse of the encoded
+// order, and a backslash escapes the next character.
+func ParseName(dn string) (pkix.Name, error) {
+	var name pkix.Name
+
+	for _, attribute := range splitEscaped(dn, ',') {
+		attribute = strings.TrimSpace(attribute)
+		if attribute == "" {
+			continue
+		}
+
+		parts := splitEscaped(attribute, '=')
+		if len(parts) != 2 {
+			return name, fmt.Errorf("invalid name attribute %q, expected TYPE=value", attribute)
+		}
+
+		key := strings.ToUpper(strings.TrimSpace(parts[0]))
+		oid, ok := nameAttributes[key]
+		if !ok {
+			return name, fmt.Errorf("unknown name attribute %q", parts[0])
+		}
+
+		value := unescape(strings.TrimSpace(parts[1]))
+		if value == "" {
+			return name, fmt.Errorf("empty value for %s", key)
+		}
+
+		name.ExtraNames = append(name.ExtraNames, pkix.AttributeTypeAndValue{Type: oid, Value: value})
+	}
+
+	if len(name.ExtraNames) == 0 {
+		return name, errors.New("empty distinguished name")
+	}
+
+	slices.Reverse(name.ExtraNames)
+
+	// Fill the fields too, so the name reads back as parsed
+	var rdns pkix.RDNSequence
+	for _, attribute := range name.ExtraNames {
+		rdns = append(rdns, pkix.RelativeDistinguishedNameSET{attribute})
+	}
+	name.FillFromRDNSequence(&rdns)
+
+	return name, nil
+}
+
+// splitEscaped splits s at each sep not preceded by a backslash, keeping
+// the escapes.
+func splitEscaped(s string, sep byte) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func indexFold(names []string, name string) int {
+	for i, known := range names {
+		if strings.EqualFold(known, name) {
+			return i
+		}
+	}
+	return -1
+}
@@ -1,39 +1,11 @@
-//go:build windows
-
 package enigma
 
-import (
-	"fmt"
-	"syscall"
-	"unsafe"
-)
-
-func XMSSOpenHandle(dll *syscall.DLL) error {
-	proc, err := dll.FindProc("MxpOpenHandle")
-	if err != nil {
-		return err
-	}
-
-	r1, _, _ := proc.Call()
-	if r1 != 0 {
-		return fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
-	return nil
+func XMSSOpenHandle(dev Device) error {
+	return dev.XMSSOpenHandle()
 }
 
-func XMSSCloseHandle(dll *syscall.DLL) error {
-	proc, err := dll.FindProc("MxpCloseHandle")
-	if err != nil {
-		return err
-	}
-
-	r1, _, _ := proc.Call()
-	if r1 != 0 {
-		return fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
-	return nil
+func XMSSCloseHandle(dev Device) error {
+	return dev.XMSSCloseHandle()
 }
 
 type XMSSParam struct {
@@ -42,36 +14,21 @@ type XMSSParam struct {
 	IndexBytes byte
 }
 
-func XMSSGetParam(dll *syscall.DLL) (*XMSSParam, error) {
-	proc, err := dll.FindProc("MxpGetParam")
+func XMSSGetParam(dev Device) (*XMSSParam, error) {
+	err := XMSSOpenHandle(dev)
 	if err != nil {
 		return nil, err
 	}
 
-	err = XMSSOpenHandle(dll)
+	out := &XMSSParam{}
+
+	err = dev.XMSSGetParam(out)
 	if err != nil {
+		XMSSCloseHandle(dev) // Close handle even on error
 		return nil, err
 	}
 
-	var raw struct {
-		Index      [8]byte
-		XMSSID     byte
-		IndexBytes byte
-	}
-
-	r1, _, _ := proc.Call(uintptr(unsafe.Pointer(&raw)))
-	if r1 != 0 {
-		XMSSCloseHandle(dll) // Close handle even on error
-		return nil, fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
-	out := &XMSSParam{
-		Index:      raw.Index,
-		XMSSID:     raw.XMSSID,
-		IndexBytes: raw.IndexBytes,
-	}
-
-	err = XMSSCloseHandle(dll)
+	err = XMSSCloseHandle(dev)
 	if err != nil {
 		return nil, err
 	}
@@ -79,54 +36,19 @@ func XMSSGetParam(dll *syscall.DLL) (*XMSSParam, error) {
 	return out, nil
 }
 
-func XMSSKeyGen(dll *syscall.DLL, isXMSSMT bool, oidStr string, skeyFile string, pkeyFile string) error {
-	proc, err := dll.FindProc("XmssKeyGen")
+func XMSSKeyGen(dev Device, isXMSSMT bool, oidStr string, skeyFile string, pkeyFile string) error {
+	err := XMSSOpenHandle(dev)
 	if err != nil {
 		return err
 	}
 
-	err = XMSSOpenHandle(dll)
-	if err != nil {
-		return err
-	}
-
-	oidPtr, err := syscall.BytePtrFromString(oidStr)
-	if err != nil {
-		XMSSCloseHandle(dll) // Close handle even on error
-		return err
-	}
-	skPtr, err := syscall.BytePtrFromString(skeyFile)
-	if err != nil {
-		XMSSCloseHandle(dll) // Close handle even on error
-		return err
-	}
-	pkPtr, err := syscall.BytePtrFromString(pkeyFile)
+	err = dev.XMSSKeyGen(isXMSSMT, oidStr, skeyFile, pkeyFile)
 	if err != nil {
-		XMSSCloseHandle(dll) // Close handle even on error
+		XMSSCloseHandle(dev) // Close handle even on error
 		return err
 	}
 
-	fmt.Println(oidPtr)
-
-	var isXMSSMTByte byte
-	if isXMSSMT {
-		isXMSSMTByte = 1
-	}
-
-	r1, _, _ := proc.Call(
-		uintptr(isXMSSMTByte),
-		uintptr(unsafe.Pointer(oidPtr)),
-		uintptr(unsafe.Pointer(skPtr)),
-		uintptr(unsafe.Pointer(pkPtr)),
-	)
-	if r1 != 0 {
-		fmt.Println("Error in XMSSKeyGen")
-		fmt.Println(uint8(r1))
-		XMSSCloseHandle(dll) // Close handle even on error
-		return fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
-	err = XMSSCloseHandle(dll)
+	err = XMSSCloseHandle(dev)
 	if err != nil {
 		return err
 	}
@@ -134,44 +56,19 @@ func XMSSKeyGen(dll *syscall.DLL, isXMSSMT bool, oidStr string, skeyFile string,
 	return nil
 }
 
-func XMSSSign(dll *syscall.DLL, skeyFile, msgFile, sigFile string) error {
-	proc, err := dll.FindProc("XmssSign")
+func XMSSSign(dev Device, skeyFile, msgFile, sigFile string) error {
+	err := XMSSOpenHandle(dev)
 	if err != nil {
 		return err
 	}
 
-	err = XMSSOpenHandle(dll)
+	err = dev.XMSSSign(skeyFile, msgFile, sigFile)
 	if err != nil {
+		XMSSCloseHandle(dev) // Close handle even on error
 		return err
 	}
 
-	skPtr, err := syscall.BytePtrFromString(skeyFile)
-	if err != nil {
-		XMSSCloseHandle(dll) // Close handle even on error
-		return err
-	}
-	msgPtr, err := syscall.BytePtrFromString(msgFile)
-	if err != nil {
-		XMSSCloseHandle(dll) // Close handle even on error
-		return err
-	}
-	sigPtr, err := syscall.BytePtrFromString(sigFile)
-	if err != nil {
-		XMSSCloseHandle(dll) // Close handle even on error
-		return err
-	}
-
-	r1, _, _ := proc.Call(
-		uintptr(unsafe.Pointer(skPtr)),
-		uintptr(unsafe.Pointer(msgPtr)),
-		uintptr(unsafe.Pointer(sigPtr)),
-	)
-	if r1 != 0 {
-		XMSSCloseHandle(dll) // Close handle even on error
-		return fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
-
-	err = XMSSCloseHandle(dll)
+	err = XMSSCloseHandle(dev)
 	if err != nil {
 		return err
 	}
@@ -179,46 +76,19 @@ func XMSSSign(dll *syscall.DLL, skeyFile, msgFile, sigFile string) error {
 	return nil
 }
 
-func XMSSVerify(dll *syscall.DLL, pkeyFile, sigFile, msgFile string) error {
-	proc, err := dll.FindProc("XmssVerify")
-	if err != nil {
-		return err
-	}
-
-	err = XMSSOpenHandle(dll)
+func XMSSVerify(dev Device, pkeyFile, sigFile, msgFile string) error {
+	err := XMSSOpenHandle(dev)
 	if err != nil {
 		return err
 	}
 
-	pkPtr, err := syscall.BytePtrFromString(pkeyFile)
+	err = dev.XMSSVerify(pkeyFile, sigFile, msgFile)
 	if err != nil {
-		XMSSCloseHandle(dll) // Close handle even on error
+		XMSSCloseHandle(dev) // Close handle even on error
 		return err
 	}
-	sigPtr, err := syscall.BytePtrFromString(sigFile)
-	if err != nil {
-		XMSSCloseHandle(dll) // Close handle even on error
-		return err
-	}
-	msgPtr, err := syscall.BytePtrFromString(msgFile)
-	if err != nil {
-		XMSSCloseHandle(dll) // Close handle even on error
-		return err
-	}
-
-	r1, _, _ := proc.Call(
-		uintptr(unsafe.Pointer(pkPtr)),
-		uintptr(unsafe.Pointer(sigPtr)),
-		uintptr(unsafe.Pointer(msgPtr)),
-	)
-	// print r1
-	fmt.Println(uint8(r1))
-	if r1 != 0 {
-		XMSSCloseHandle(dll) // Close handle even on error
-		return fmt.Errorf("%s", GetCodeMessage(uint8(r1)))
-	}
 
-	err = XMSSCloseHandle(dll)
+	err = XMSSCloseHandle(dev)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,250 @@
+package enigma
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ImageSectorSize is the unit AESXTS encrypts, matching the device sector.
+const ImageSectorSize = sectorSize
+
+// xtsDomain fills the upper half of the tweak input, keeping tweak
+// encryptions apart from other uses of the device key.
+var xtsDomain = [8]byte{'e', 'n', 'i', 'g', 'm', 'x', 't', 's'}
+
+// ErrImageSize is returned when an image does not hold a whole number of
+// sectors.
+var ErrImageSize = errors.New("image size is not a multiple of the sector size")
+
+// AESXTS is a length-preserving, sector-tweaked mode for disk and volume
+// images. AESStreamEncDec encrypts every block independently, so identical
+// sectors would give identical ciphertext; AESXTS masks each block with a
+// tweak derived from its sector number and position.
+//
+// The construction is XEX with the device key: the tweak of sector s is
+// T = E(s | domain), the mask of block j of the sector is T·α^j for j = 1
+// to 32 in GF(2^128) as in XTS, and each block is encrypted as
+// E(P ⊕ mask) ⊕ mask. Starting j at 1 is what makes a single key safe.
+// Tweaks and data for a run of sectors take one device call each.
+type AESXTS struct {
+	b *AESBlock
+}
+
+func NewAESXTS(dev Device) *AESXTS {
+	return &AESXTS{b: NewAESBlock(dev)}
+}
+
+// EncryptSectors encrypts src, a whole number of sectors starting at sector
+// number sector, into dst. dst and src may overlap entirely.
+func (x *AESXTS) EncryptSectors(dst, src []byte, sector uint64) error {
+	return x.cryptSectors(dst, src, sector, true)
+}
+
+// DecryptSectors is the inverse of EncryptSectors.
+func (x *AESXTS) DecryptSectors(dst, src []byte, sector uint64) error {
+	return x.cryptSectors(dst, src, sector, false)
+}
+
+func (x *AESXTS) cryptSectors(dst, src []byte, sector uint64, encrypt bool) error {
+	if len(src)%ImageSectorSize != 0 {
+		return ErrImageSize
+	}
+	if len(dst) < len(src) {
+		return fmt.Errorf("output smaller than input")
+	}
+
+	tweaks := make([]byte, min(len(src), streamBatchSize)/ImageSectorSize*16)
+	masks := make([]byte, min(len(src), streamBatchSize))
+
+	for len(src) > 0 {
+		n := min(len(src), streamBatchSize)
+		sectors := n / ImageSectorSize
+
+		for i := 0; i < sectors; i++ {
+			t := tweaks[i*16 : i*16+16]
+			binary.LittleEndian.PutUint64(t, sector+uint64(i))
+			copy(t[8:], xtsDomain[:])
+		}
+		if err := x.b.EncryptBlocks(tweaks[:sectors*16], tweaks[:sectors*16]); err != nil {
+			return err
+		}
+
+		for i := 0; i < sectors; i++ {
+			var t [16]byte
+			copy(t[:], tweaks[i*16:])
+			for j := 0; j < ImageSectorSize; j += 16 {
+				xtsDouble(&t)
+				copy(masks[i*ImageSectorSize+j:], t[:])
+			}
+		}
+
+		subtle.XORBytes(dst[:n], src[:n], masks[:n])
+
+		var err error
+		if encrypt {
+			err = x.b.EncryptBlocks(dst[:n], dst[:n])
+		} else {
+			err = x.b.DecryptBlocks(dst[:n], dst[:n])
+		}
+		if err != nil {
+			return err
+		}
+
+		subtle.XORBytes(dst[:n], dst[:n], masks[:n])
+
+		dst, src = dst[n:], src[n:]
+		sector += uint64(sectors)
+	}
+
+	return nil
+}
+
+// xtsDouble multiplies t by α in GF(2^128) with the little-endian
+// convention of XTS.
+func xtsDouble(t *[16]byte) {
+	carry := t[15] >> 7
+	for i := 15; i > 0; i-- {
+		t[i] = t[i]<<1 | t[i-1]>>7
+	}
+	t[0] = t[0]<<1 ^ byte(subtle.ConstantTimeSelect(int(carry), 0x87, 0))
+}
+
+// ReadWriterAt is the backing store of a writable XTSImage.
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// XTSImage presents an image encrypted with AESXTS as plaintext, with
+// random access. Sector n of the image is sector number n of the tweak.
+// Reads decrypt only the sectors they touch; writes that do not cover whole
+// sectors read, decrypt and re-encrypt the sectors at either end. Like
+// files, ReadAt and WriteAt may be called concurrently for distinct ranges,
+// provided the device allows concurrent calls.
+type XTSImage struct {
+	x *AESXTS
+	r io.ReaderAt
+	w io.WriterAt
+}
+
+// NewXTSReaderAt returns a read-only XTSImage over r.
+func NewXTSReaderAt(dev Device, r io.ReaderAt) *XTSImage {
+	return &XTSImage{x: NewAESXTS(dev), r: r}
+}
+
+// NewXTSImage returns a readable and writable XTSImage over rw.
+func NewXTSImage(dev Device, rw ReadWriterAt) *XTSImage {
+	return &XTSImage{x: NewAESXTS(dev), r: rw, w: rw}
+}
+
+// ReadAt reads plaintext at off. It returns io.EOF with the bytes before
+// the end of the image, and ErrImageSize if the image ends in a partial
+// sector within the range.
+func (m *XTSImage) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	first, plain, err := m.readSectors(off, len(p))
+	if err != nil {
+		return 0, err
+	}
+
+	start := int(off - first)
+	if start >= len(plain) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, plain[start:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt writes plaintext at off. Writing past the end extends the image
+// to a whole number of sectors; sectors in a gap left between the old end
+// and off read back as undefined data.
+func (m *XTSImage) WriteAt(p []byte, off int64) (int, error) {
+	if m.w == nil {
+		return 0, fmt.Errorf("image is read-only")
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	first := off / ImageSectorSize * ImageSectorSize
+	end := (off + int64(len(p)) + ImageSectorSize - 1) / ImageSectorSize * ImageSectorSize
+	buf := make([]byte, end-first)
+
+	// Only the partial sectors at either end need their old content
+	head := off != first
+	tail := (off+int64(len(p)))%ImageSectorSize != 0
+	if head {
+		if err := m.readSector(buf[:ImageSectorSize], first); err != nil {
+			return 0, err
+		}
+	}
+	if last := end - ImageSectorSize; tail && !(head && last == first) {
+		if err := m.readSector(buf[last-first:], last); err != nil {
+			return 0, err
+		}
+	}
+
+	copy(buf[off-first:], p)
+
+	if err := m.x.EncryptSectors(buf, buf, uint64(first/ImageSectorSize)); err != nil {
+		return 0, err
+	}
+
+	if _, err := m.w.WriteAt(buf, first); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// readSectors decrypts the sectors covering length bytes at off, returning
+// the offset of the first and the plaintext of those present.
+func (m *XTSImage) readSectors(off int64, length int) (int64, []byte, error) {
+	first := off / ImageSectorSize * ImageSectorSize
+	end := (off + int64(length) + ImageSectorSize - 1) / ImageSectorSize * ImageSectorSize
+
+	buf := make([]byte, end-first)
+	n, err := m.r.ReadAt(buf, first)
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	if n%ImageSectorSize != 0 {
+		return 0, nil, ErrImageSize
+	}
+
+	buf = buf[:n]
+	if err := m.x.DecryptSectors(buf, buf, uint64(first/ImageSectorSize)); err != nil {
+		return 0, nil, err
+	}
+
+	return first, buf, nil
+}
+
+// readSector fills dst with the plaintext of the sector at off, or zeros if
+// it is past the end of the image.
+func (m *XTSImage) readSector(dst []byte, off int64) error {
+	_, plain, err := m.readSectors(off, ImageSectorSize)
+	if err != nil {
+		return err
+	}
+
+	n := copy(dst, plain)
+	clear(dst[n:ImageSectorSize])
+	return nil
+}
@@ -2,7 +2,6 @@ module github.com/joshimello/enigma-go
 
 go 1.24.1
 
-require (
-	github.com/urfave/cli/v3 v3.0.0-beta1 // indirect
-	golang.org/x/sys v0.31.0 // indirect
-)
+require github.com/urfave/cli/v3 v3.0.0-beta1
+
+require golang.org/x/sys v0.31.0 // indirect
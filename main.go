@@ -1,5 +1,3 @@
-//go:build windows
-
 package main
 
 import (
@@ -7,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"syscall"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/joshimello/enigma-go/commands"
 	"github.com/joshimello/enigma-go/enigma"
@@ -17,12 +17,29 @@ import (
 
 func main() {
 	cmd := &cli.Command{
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "backend",
+				Usage:   "token backend: dll (EnovaMX.dll, Windows only) or soft (software token)",
+				Value:   defaultBackend(),
+				Sources: cli.EnvVars("ENIGMA_BACKEND"),
+			},
+			&cli.StringFlag{
+				Name:    "keystore",
+				Usage:   "keystore file of the soft backend, encrypted with $ENIGMA_KEYSTORE_PASSPHRASE",
+				Value:   defaultKeystore(),
+				Sources: cli.EnvVars("ENIGMA_KEYSTORE"),
+			},
+			&cli.StringFlag{
+				Name:    "keyring",
+				Usage:   "file remembering the public keys of generated and imported RSA keys",
+				Value:   defaultKeyRing(),
+				Sources: cli.EnvVars("ENIGMA_KEYRING"),
+			},
+		},
 		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
 			// Check if this is an XMSS command
-			cmdName := ""
-			if len(os.Args) > 1 {
-				cmdName = os.Args[1]
-			}
+			cmdName := cmd.Args().First()
 
 			isXMSSCommand := false
 			xmssCommands := []string{"xmss-keygen", "xmss-sign", "xmss-verify", "xmss-param"}
@@ -33,32 +50,39 @@ func main() {
 				}
 			}
 
-			var dll *syscall.DLL
+			var dev enigma.Device
 			var err error
 
-			if isXMSSCommand {
+			switch backend := cmd.String("backend"); {
+			case isOfflineCommand(cmd.Args().Slice()):
+				// Software verification must work without the token or its DLL
+			case backend == "soft":
+				dev, err = enigma.CreateSoft(cmd.String("keystore"), os.Getenv("ENIGMA_KEYSTORE_PASSPHRASE"))
+			case backend != "dll":
+				err = fmt.Errorf("unknown backend %q, expected dll or soft", backend)
+			case isXMSSCommand:
 				// Use XMSS-specific DLL
-				dll, err = enigma.Create("library/mxpxmss.dll")
-			} else {
+				dev, err = enigma.Create("library/mxpxmss.dll")
+			default:
 				// Use standard EnovaMX DLL
-				dll, err = enigma.Create("library/EnovaMX.dll")
-
-				if err == nil {
-					// Only perform these checks for non-XMSS commands
-					res, err := enigma.Detect(dll)
-					if err != nil && res == false {
-						result := &types.EnigmaResponse{
-							Status:  "error",
-							Message: err.Error(),
-						}
-						jsonResult, _ := json.Marshal(result)
-						fmt.Println(string(jsonResult))
-						os.Exit(1)
-					}
+				dev, err = enigma.Create("library/EnovaMX.dll")
+			}
 
-					// Check login status for standard operations
-					_, _, _, _ = enigma.LoginStatus(dll)
+			if err == nil && dev != nil && !isXMSSCommand {
+				// Only perform these checks for non-XMSS commands
+				res, err := enigma.Detect(dev)
+				if err != nil && res == false {
+					result := &types.EnigmaResponse{
+						Status:  "error",
+						Message: err.Error(),
+					}
+					jsonResult, _ := json.Marshal(result)
+					fmt.Println(string(jsonResult))
+					os.Exit(1)
 				}
+
+				// Check login status for standard operations
+				_, _, _, _ = enigma.LoginStatus(dev)
 			}
 
 			if err != nil {
@@ -72,8 +96,9 @@ func main() {
 			}
 
 			enigmaContext := &types.EnigmaContext{
-				DLL:    dll,
-				Result: nil,
+				Device:  dev,
+				KeyRing: enigma.NewKeyRing(cmd.String("keyring")),
+				Result:  nil,
 			}
 
 			return context.WithValue(ctx, "enigma-context", enigmaContext), nil
@@ -94,6 +119,15 @@ func main() {
 			commands.AESDecrypt(),
 			commands.AESEncryptFile(),
 			commands.AESDecryptFile(),
+			commands.AESEncryptDir(),
+			commands.AESDecryptDir(),
+			commands.AESEncryptImage(),
+			commands.AESDecryptImage(),
+			commands.AESWrapKey(),
+			commands.AESUnwrapKey(),
+			commands.MAC(),
+			commands.MACVerify(),
+			commands.DeriveKey(),
 
 			// rsa
 			commands.GenerateKey(),
@@ -101,8 +135,20 @@ func main() {
 			commands.SetTransKey(),
 			commands.RSAEncrypt(),
 			commands.RSADecrypt(),
+			commands.Seal(),
+			commands.Open(),
+			commands.ExportPublicKey(),
+			commands.CSR(),
+			commands.CA(),
 			commands.Sign(),
 			commands.Verify(),
+			commands.SignFile(),
+			commands.VerifyFile(),
+			commands.JWTSign(),
+			commands.JWTVerify(),
+			commands.CMSSign(),
+			commands.CMSEncrypt(),
+			commands.CMSDecrypt(),
 			commands.DeleteKey(),
 			commands.ListKeys(),
 			commands.ResetKeys(),
@@ -143,3 +189,54 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// isOfflineCommand reports whether args run a command that verifies with a
+// public key only, and so needs no device.
+func isOfflineCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var flag string
+	switch args[0] {
+	case "verify":
+		flag = "--offline"
+	case "verify-file", "jwt-verify":
+		flag = "--pubkey"
+	default:
+		return false
+	}
+
+	for _, arg := range args[1:] {
+		if arg == "--" {
+			break
+		}
+		if arg == flag || strings.HasPrefix(arg, flag+"=") && arg != flag+"=false" {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultBackend() string {
+	if runtime.GOOS == "windows" {
+		return "dll"
+	}
+	return "soft"
+}
+
+func defaultKeystore() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "keystore.emks"
+	}
+	return filepath.Join(dir, "enigma", "keystore.emks")
+}
+
+func defaultKeyRing() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "keyring.json"
+	}
+	return filepath.Join(dir, "enigma", "keyring.json")
+}
@@ -3,7 +3,9 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"testing"
 	"time"
@@ -41,6 +43,7 @@ func TestAESBenchmark(t *testing.T) {
 	}
 
 	const runs = 100
+	const workers = 16
 	var results []BenchmarkResult
 
 	fmt.Printf("\n=== AES Cryptographic Benchmark ===\n")
@@ -87,17 +90,101 @@ func TestAESBenchmark(t *testing.T) {
 		}
 	}
 
+	// Test streaming AES Encryption
+	fmt.Printf("\nTesting AES Writer Encryption...\n")
+	for _, size := range testSizes {
+		testData := generateRandomData(size)
+
+		result := runBenchmark("AES Writer Enc", size, runs, func() error {
+			w := enigma.NewAESEncryptWriter(dll, io.Discard)
+			if _, err := w.Write(testData); err != nil {
+				return err
+			}
+			return w.Close()
+		})
+		results = append(results, result)
+
+		if result.Success {
+			fmt.Printf("  %s: %.2f ms avg\n", result.DataSize, result.AvgTimeMs)
+		} else {
+			fmt.Printf("  %s: FAILED\n", result.DataSize)
+		}
+	}
+
+	// Test streaming AES Decryption
+	fmt.Printf("\nTesting AES Reader Decryption...\n")
+	for _, size := range testSizes {
+		testData := generateRandomData(size)
+		encryptedData, err := enigma.AESEncryptBytes(dll, testData)
+		if err != nil {
+			t.Errorf("Failed to encrypt data for decryption test: %v", err)
+			continue
+		}
+
+		result := runBenchmark("AES Reader Dec", size, runs, func() error {
+			_, err := io.Copy(io.Discard, enigma.NewAESDecryptReader(dll, bytes.NewReader(encryptedData)))
+			return err
+		})
+		results = append(results, result)
+
+		if result.Success {
+			fmt.Printf("  %s: %.2f ms avg\n", result.DataSize, result.AvgTimeMs)
+		} else {
+			fmt.Printf("  %s: FAILED\n", result.DataSize)
+		}
+	}
+
+	// Test single blocks, one device call each
+	fmt.Printf("\nTesting AES Block Encryption...\n")
+	{
+		var block [16]byte
+		result := runBenchmark("AES Block Enc", 16, runs*workers, func() error {
+			_, err := enigma.AESEncryptBlock(dll, block)
+			return err
+		})
+		results = append(results, result)
+		printThroughput(result)
+	}
+
+	// Test the same blocks from concurrent callers through the pipeline
+	fmt.Printf("\nTesting AES Pipeline Block Encryption (%d workers)...\n", workers)
+	{
+		pipeline := enigma.NewAESPipeline(dll, enigma.PipelineOptions{})
+		result := runParallelBenchmark("AES Pipeline Block", 16, runs, workers, func() error {
+			block := make([]byte, 16)
+			return pipeline.EncryptBlocks(block, block)
+		})
+		pipeline.Close()
+		results = append(results, result)
+		printThroughput(result)
+	}
+
+	// Test whole messages from concurrent callers through the pipeline
+	fmt.Printf("\nTesting AES Pipeline Encryption (%d workers)...\n", workers)
+	for _, size := range testSizes {
+		testData := generateRandomData(size)
+
+		pipeline := enigma.NewAESPipeline(dll, enigma.PipelineOptions{})
+		result := runParallelBenchmark("AES Pipeline Enc", size, runs, workers, func() error {
+			_, err := pipeline.EncryptBytes(testData)
+			return err
+		})
+		pipeline.Close()
+		results = append(results, result)
+		printThroughput(result)
+	}
+
 	// Generate and save results table
 	fmt.Printf("\n=== AES BENCHMARK RESULTS ===\n")
-	fmt.Printf("%-20s %-12s %-15s %-15s %-10s\n", "Operation", "Data Size", "Total Time (s)", "Avg Time (ms)", "Status")
-	fmt.Printf("%-20s %-12s %-15s %-15s %-10s\n", "--------------------", "------------", "---------------", "---------------", "----------")
+	fmt.Printf("%-20s %-12s %-15s %-15s %-12s %-10s %-10s\n", "Operation", "Data Size", "Total Time (s)", "Avg Time (ms)", "Ops/sec", "MB/s", "Status")
+	fmt.Printf("%-20s %-12s %-15s %-15s %-12s %-10s %-10s\n", "--------------------", "------------", "---------------", "---------------", "------------", "----------", "----------")
 
 	var output string
 	output += "=== AES CRYPTOGRAPHIC BENCHMARK RESULTS ===\n"
 	output += fmt.Sprintf("Test runs: %d iterations per test\n", runs)
 	output += fmt.Sprintf("Test date: %s\n\n", time.Now().Format("2006-01-02 15:04:05"))
-	output += fmt.Sprintf("%-20s %-12s %-15s %-15s %-10s\n", "Operation", "Data Size", "Total Time (s)", "Avg Time (ms)", "Status")
-	output += "--------------------" + " " + "------------" + " " + "---------------" + " " + "---------------" + " " + "----------" + "\n"
+	output += fmt.Sprintf("%-20s %-12s %-15s %-15s %-12s %-10s %-10s\n", "Operation", "Data Size", "Total Time (s)", "Avg Time (ms)", "Ops/sec", "MB/s", "Status")
+	output += "--------------------" + " " + "------------" + " " + "---------------" + " " + "---------------" + " " + "------------" + " " + "----------" + " " + "----------" + "\n"
 
 	for _, result := range results {
 		status := "SUCCESS"
@@ -107,11 +194,11 @@ func TestAESBenchmark(t *testing.T) {
 
 		totalTimeSeconds := result.TotalTime.Seconds()
 
-		fmt.Printf("%-20s %-12s %-15.3f %-15.3f %-10s\n",
-			result.Operation, result.DataSize, totalTimeSeconds, result.AvgTimeMs, status)
+		fmt.Printf("%-20s %-12s %-15.3f %-15.3f %-12.0f %-10.3f %-10s\n",
+			result.Operation, result.DataSize, totalTimeSeconds, result.AvgTimeMs, result.OpsPerSec, result.MBPerSec, status)
 
-		output += fmt.Sprintf("%-20s %-12s %-15.3f %-15.3f %-10s\n",
-			result.Operation, result.DataSize, totalTimeSeconds, result.AvgTimeMs, status)
+		output += fmt.Sprintf("%-20s %-12s %-15.3f %-15.3f %-12.0f %-10.3f %-10s\n",
+			result.Operation, result.DataSize, totalTimeSeconds, result.AvgTimeMs, result.OpsPerSec, result.MBPerSec, status)
 	}
 
 	// Save results to file
@@ -123,3 +210,11 @@ func TestAESBenchmark(t *testing.T) {
 		fmt.Printf("\nResults saved to: %s\n", filename)
 	}
 }
+
+func printThroughput(result BenchmarkResult) {
+	if result.Success {
+		fmt.Printf("  %s: %.2f ms avg, %.0f ops/sec, %.3f MB/s\n", result.DataSize, result.AvgTimeMs, result.OpsPerSec, result.MBPerSec)
+	} else {
+		fmt.Printf("  %s: FAILED\n", result.DataSize)
+	}
+}
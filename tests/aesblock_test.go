@@ -1,18 +1,15 @@
-//go:build windows
-
 package main
 
 import (
 	"encoding/hex"
 	"fmt"
-	"syscall"
 	"testing"
 
 	"github.com/joshimello/enigma-go/enigma"
 )
 
 // Helper function to load the DLL using the shared initialization
-func loadTestDLL(t *testing.T) *syscall.DLL {
+func loadTestDLL(t *testing.T) enigma.Device {
 	return InitTestLibrary(t)
 }
 
@@ -5,6 +5,7 @@ package main
 import (
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -14,6 +15,8 @@ type BenchmarkResult struct {
 	DataSize  string
 	TotalTime time.Duration
 	AvgTimeMs float64
+	OpsPerSec float64
+	MBPerSec  float64
 	Success   bool
 }
 
@@ -63,8 +66,65 @@ func runBenchmark(operation string, dataSize int, runs int, testFunc func() erro
 
 	result.TotalTime = totalTime
 	if result.Success {
-		result.AvgTimeMs = float64(totalTime.Nanoseconds()) / float64(runs) / 1000000.0
+		setThroughput(&result, dataSize, runs)
 	}
 
 	return result
 }
+
+// runParallelBenchmark runs testFunc runs times in each of workers
+// goroutines at once. TotalTime is the wall-clock time for all of them, so
+// the throughput reflects how well concurrent calls are combined.
+func runParallelBenchmark(operation string, dataSize int, runs int, workers int, testFunc func() error) BenchmarkResult {
+	result := BenchmarkResult{
+		Operation: operation,
+		DataSize:  formatSize(dataSize),
+		Success:   true,
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+
+	start := time.Now()
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < runs; i++ {
+				if err := testFunc(); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	result.TotalTime = time.Since(start)
+
+	if firstErr != nil {
+		result.Success = false
+		fmt.Printf("Error in %s with size %s: %v\n", operation, result.DataSize, firstErr)
+		return result
+	}
+
+	setThroughput(&result, dataSize, runs*workers)
+	return result
+}
+
+// setThroughput fills in the per-operation time and rates for ops
+// operations of dataSize bytes each.
+func setThroughput(result *BenchmarkResult, dataSize int, ops int) {
+	seconds := result.TotalTime.Seconds()
+	result.AvgTimeMs = float64(result.TotalTime.Nanoseconds()) / float64(ops) / 1000000.0
+	if seconds > 0 {
+		result.OpsPerSec = float64(ops) / seconds
+		result.MBPerSec = float64(ops) * float64(dataSize) / seconds / 1000000.0
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// softwareBlock returns the standard library cipher for memDevice's key, as
+// the reference the device adapter must agree with.
+func softwareBlock(t *testing.T) cipher.Block {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return block
+}
+
+func TestAESBlockCTR(t *testing.T) {
+	dev := &batchDevice{memDevice: newMemDevice(t)}
+	block := enigma.NewAESBlock(dev)
+	reference := softwareBlock(t)
+
+	// A counter about to wrap checks the carry across the whole block
+	iv := bytes.Repeat([]byte{0xff}, 16)
+	iv[0] = 0x01
+
+	plaintext := make([]byte, 100000)
+	rand.Read(plaintext)
+
+	want := make([]byte, len(plaintext))
+	cipher.NewCTR(reference, iv).XORKeyStream(want, plaintext)
+
+	got := make([]byte, len(plaintext))
+	stream := cipher.NewCTR(block, iv)
+	for i := 0; i < len(plaintext); i += 7000 {
+		end := min(i+7000, len(plaintext))
+		stream.XORKeyStream(got[i:end], plaintext[i:end])
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Fatal("CTR output differs from crypto/aes")
+	}
+
+	dev.calls = 0
+	cipher.NewCTR(block, iv).XORKeyStream(got[:4096], plaintext[:4096])
+	if dev.calls != 1 {
+		t.Errorf("4 KiB of CTR keystream took %d device calls, want 1", dev.calls)
+	}
+}
+
+func TestAESBlockCBC(t *testing.T) {
+	dev := &batchDevice{memDevice: newMemDevice(t)}
+	block := enigma.NewAESBlock(dev)
+	reference := softwareBlock(t)
+
+	iv := make([]byte, 16)
+	rand.Read(iv)
+
+	plaintext := make([]byte, 64*16)
+	rand.Read(plaintext)
+
+	want := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(reference, iv).CryptBlocks(want, plaintext)
+
+	got := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(got, plaintext)
+	if !bytes.Equal(got, want) {
+		t.Fatal("CBC ciphertext differs from crypto/aes")
+	}
+
+	// Decrypt in place, in two calls, to exercise chaining across calls
+	dev.calls = 0
+	decrypter := cipher.NewCBCDecrypter(block, iv)
+	decrypter.CryptBlocks(got[:512], got[:512])
+	decrypter.CryptBlocks(got[512:], got[512:])
+
+	if !bytes.Equal(got, plaintext) {
+		t.Fatal("CBC decryption does not round trip")
+	}
+	if dev.calls != 2 {
+		t.Errorf("CBC decryption took %d device calls, want 2", dev.calls)
+	}
+}
+
+func TestAESBlockGCM(t *testing.T) {
+	dev := &batchDevice{memDevice: newMemDevice(t)}
+	block := enigma.NewAESBlock(dev)
+	reference := softwareBlock(t)
+
+	cases := []struct {
+		name      string
+		nonceSize int
+		tagSize   int
+		size      int
+	}{
+		{"empty", 12, 16, 0},
+		{"partial block", 12, 16, 33},
+		{"multi batch", 12, 16, 70000},
+		{"long nonce", 16, 16, 100},
+		{"short tag", 12, 12, 100},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			want, err := cipher.NewGCMWithNonceSize(reference, tc.nonceSize)
+			if tc.tagSize != 16 {
+				want, err = cipher.NewGCMWithTagSize(reference, tc.tagSize)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := cipher.NewGCMWithNonceSize(block, tc.nonceSize)
+			if tc.tagSize != 16 {
+				got, err = cipher.NewGCMWithTagSize(block, tc.tagSize)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			nonce := make([]byte, tc.nonceSize)
+			plaintext := make([]byte, tc.size)
+			rand.Read(nonce)
+			rand.Read(plaintext)
+			additionalData := []byte("header")
+
+			sealed := got.Seal(nil, nonce, plaintext, additionalData)
+			if !bytes.Equal(sealed, want.Seal(nil, nonce, plaintext, additionalData)) {
+				t.Fatal("GCM output differs from crypto/aes")
+			}
+
+			opened, err := got.Open(nil, nonce, sealed, additionalData)
+			if err != nil || !bytes.Equal(opened, plaintext) {
+				t.Fatalf("Open = %v", err)
+			}
+
+			sealed[len(sealed)-1] ^= 1
+			if _, err := got.Open(nil, nonce, sealed, additionalData); err == nil {
+				t.Fatal("Open accepted a modified tag")
+			}
+		})
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev.calls = 0
+	gcm.Seal(nil, make([]byte, 12), make([]byte, 1024), nil)
+	if dev.calls != 1 {
+		t.Errorf("sealing 1 KiB took %d device calls, want 1", dev.calls)
+	}
+}
+
+func TestAESBlockDevice(t *testing.T) {
+	dev := InitTestLibrary(t)
+	block := enigma.NewAESBlock(dev)
+
+	var plaintext [16]byte
+	copy(plaintext[:], "device block 01")
+
+	want, err := enigma.AESEncryptBlock(dev, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got [16]byte
+	block.Encrypt(got[:], plaintext[:])
+	if got != want {
+		t.Fatalf("Encrypt = %x, want %x", got, want)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+
+	sealed := gcm.Seal(nil, nonce, []byte("sealed on the device"), nil)
+	opened, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil || string(opened) != "sealed on the device" {
+		t.Fatalf("Open = %q, %v", opened, err)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestCA(t *testing.T) {
+	dev := InitTestLibrary(t)
+	dir := t.TempDir()
+
+	root := enigma.NewCA(filepath.Join(dir, "root.json"))
+	rootSigner := newDeviceSigner(t, dev, "root")
+
+	if _, _, err := root.Certificate(); !errors.Is(err, enigma.ErrNoCA) {
+		t.Fatalf("Certificate before Init: err = %v, want ErrNoCA", err)
+	}
+
+	rootCert, err := root.Init(rootSigner, pkix.Name{CommonName: "Test Root", Organization: []string{"Example"}}, 24*time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rootCert.CheckSignatureFrom(rootCert); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := root.Init(rootSigner, pkix.Name{CommonName: "Again"}, time.Hour, -1); !errors.Is(err, enigma.ErrCAExists) {
+		t.Fatalf("second Init: err = %v, want ErrCAExists", err)
+	}
+
+	// An intermediate whose key is on the device too
+	interSigner := newDeviceSigner(t, dev, "inter")
+	csrDER, err := enigma.CreateCertificateRequest(interSigner, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "Test Intermediate"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	interCSR, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interCert, err := root.Sign(dev, interCSR, enigma.IssueOptions{Validity: 48 * time.Hour, IsCA: true, MaxPathLen: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !interCert.IsCA || interCert.MaxPathLen != 0 || !interCert.MaxPathLenZero {
+		t.Errorf("intermediate IsCA %v, MaxPathLen %d", interCert.IsCA, interCert.MaxPathLen)
+	}
+	if interCert.NotAfter.After(rootCert.NotAfter) {
+		t.Error("intermediate outlives the root")
+	}
+
+	inter := enigma.NewCA(filepath.Join(dir, "inter.json"))
+	if _, err := inter.InitWithCertificate(rootSigner, interCert); err == nil {
+		t.Fatal("adopted a certificate for another key")
+	}
+	if _, err := inter.InitWithCertificate(interSigner, interCert); err != nil {
+		t.Fatal(err)
+	}
+
+	// A leaf with a software key, requesting its usages in the CSR
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extensions, err := enigma.KeyUsageExtensions(x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrDER, err = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:         pkix.Name{CommonName: "leaf.example.com"},
+		DNSNames:        []string{"leaf.example.com"},
+		ExtraExtensions: extensions,
+	}, leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCSR, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := inter.Sign(dev, leafCSR, enigma.IssueOptions{Validity: time.Hour, IsCA: true, MaxPathLen: -1}); err == nil {
+		t.Fatal("intermediate with path length 0 issued a CA")
+	}
+
+	leafCert, err := inter.Sign(dev, leafCSR, enigma.IssueOptions{Validity: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leafCert.KeyUsage != x509.KeyUsageDigitalSignature || len(leafCert.ExtKeyUsage) != 1 || leafCert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Errorf("leaf usages %v %v", leafCert.KeyUsage, leafCert.ExtKeyUsage)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(interCert)
+	chains, err := leafCert.Verify(x509.VerifyOptions{
+		DNSName:       "leaf.example.com",
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 3 {
+		t.Fatalf("chains %v", chains)
+	}
+
+	// Revocation
+	if _, err := inter.Revoke(big.NewInt(1), 1); !errors.Is(err, enigma.ErrUnknownSerial) {
+		t.Fatalf("unknown serial: err = %v, want ErrUnknownSerial", err)
+	}
+	if _, err := inter.Revoke(leafCert.SerialNumber, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inter.Revoke(leafCert.SerialNumber, 1); err == nil {
+		t.Fatal("revoked twice")
+	}
+
+	for number := int64(1); number <= 2; number++ {
+		crlDER, err := inter.CRL(dev, 24*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crl, err := x509.ParseRevocationList(crlDER)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := crl.CheckSignatureFrom(interCert); err != nil {
+			t.Fatal(err)
+		}
+		if crl.Number.Int64() != number {
+			t.Errorf("CRL number %v, want %d", crl.Number, number)
+		}
+		entries := crl.RevokedCertificateEntries
+		if len(entries) != 1 || entries[0].SerialNumber.Cmp(leafCert.SerialNumber) != 0 || entries[0].ReasonCode != 1 {
+			t.Fatalf("CRL entries %+v", entries)
+		}
+	}
+
+	issued, err := inter.Issued()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issued) != 2 || issued[1].Serial != leafCert.SerialNumber.Text(16) || issued[1].RevokedAt == nil || issued[1].Subject != "CN=leaf.example.com" {
+		t.Errorf("issued %+v", issued)
+	}
+}
+
+func TestParseRevocationReason(t *testing.T) {
+	for name, want := range map[string]int{"unspecified": 0, "keyCompromise": 1, "superseded": 4, "aacompromise": 10} {
+		if got, err := enigma.ParseRevocationReason(name); err != nil || got != want {
+			t.Errorf("%s = %d, %v, want %d", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"", "compromised"} {
+		if _, err := enigma.ParseRevocationReason(name); err == nil {
+			t.Errorf("%q parsed", name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestCMACSP800_38B(t *testing.T) {
+	const message = "6bc1bee22e409f96e93d7e117393172a ae2d8a571e03ac9c9eb76fac45af8e51 30c81c46a35ce411e5fbc1191a0a52ef f69f2445df4f9b17ad2b417be66c3710"
+
+	keys := []struct {
+		name string
+		key  string
+		macs [4]string
+	}{
+		{"AES-128", "2b7e151628aed2a6abf7158809cf4f3c", [4]string{
+			"bb1d6929e95937287fa37d129b756746",
+			"070a16b46b4d4144f79bdd9dd04a287c",
+			"dfa66747de9ae63030ca32611497c827",
+			"51f0bebf7e3b9d92fc49741779363cfe",
+		}},
+		{"AES-192", "8e73b0f7da0e6452c810f32b809079e562f8ead2522c6b7b", [4]string{
+			"d17ddf46adaacde531cac483de7a9367",
+			"9e99a7bf31e710900662f65e617c5184",
+			"8a1de5be2eb31aad089a82e6ee908b0e",
+			"a1d5df0eed790f794d77589659f39a11",
+		}},
+		{"AES-256", "603deb1015ca71be2b73aef0857d77811f352c073b6108d72d9810a30914dff4", [4]string{
+			"028962f61b7bf89efc6b551f4667d983",
+			"28a7023f452e8f82bd4bf28d8c37c35c",
+			"aaf3d8f1de5640c232f5b169b9c911e6",
+			"e1992190549f6ed5696a2c056c315410",
+		}},
+	}
+
+	msg := unhex(t, message)
+
+	for _, k := range keys {
+		dev := keyedDevice(t, k.key)
+
+		for i, length := range []int{0, 16, 40, 64} {
+			mac, err := enigma.AESCMAC(dev, msg[:length])
+			if err != nil {
+				t.Fatalf("%s, %d bytes: %v", k.name, length, err)
+			}
+			if hex.EncodeToString(mac) != k.macs[i] {
+				t.Errorf("%s, %d bytes: mac = %x, want %s", k.name, length, mac, k.macs[i])
+			}
+
+			ok, err := enigma.AESCMACVerify(dev, msg[:length], unhex(t, k.macs[i]))
+			if err != nil || !ok {
+				t.Errorf("%s, %d bytes: verify = %v, %v", k.name, length, ok, err)
+			}
+		}
+	}
+}
+
+func TestCMACStreaming(t *testing.T) {
+	dev := newMemDevice(t)
+	message := bytes.Repeat([]byte("config file line\n"), 20)
+
+	want, err := enigma.AESCMAC(dev, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := enigma.NewCMAC(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes of every size straddle block boundaries differently
+	for rest, n := message, 1; len(rest) > 0; n++ {
+		n = min(n, len(rest))
+		c.Write(rest[:n])
+		rest = rest[n:]
+
+		// Taking the MAC midway must not disturb the state
+		c.Sum(nil)
+	}
+
+	if got := c.Sum(nil); !bytes.Equal(got, want) {
+		t.Fatalf("streamed mac = %x, want %x", got, want)
+	}
+
+	if ok, err := c.Verify(flipBit(want, 15)); err != nil || ok {
+		t.Fatalf("tampered mac verified: %v, %v", ok, err)
+	}
+	if ok, err := c.Verify(want[:8]); err != nil || ok {
+		t.Fatalf("truncated mac verified: %v, %v", ok, err)
+	}
+
+	c.Reset()
+	c.Write(message[:1])
+	if ok, _ := c.Verify(want); ok {
+		t.Fatal("mac verified after Reset")
+	}
+}
+
+func TestCMACDevice(t *testing.T) {
+	dev := InitTestLibrary(t)
+
+	mac, err := enigma.AESCMAC(dev, []byte("config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := enigma.AESCMACVerify(dev, []byte("config"), mac); err != nil || !ok {
+		t.Fatalf("verify = %v, %v", ok, err)
+	}
+	if ok, err := enigma.AESCMACVerify(dev, []byte("c0nfig"), mac); err != nil || ok {
+		t.Fatalf("verify of another message = %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// selfSignedCertificate returns a certificate for the key of signer, signed
+// with it on the device.
+func selfSignedCertificate(t *testing.T, signer *enigma.RSASigner, commonName string) *x509.Certificate {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := enigma.CreateCertificate(template, template, signer.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestSignCMS(t *testing.T) {
+	dev := InitTestLibrary(t)
+	signer := newDeviceSigner(t, dev, "cms")
+	cert := selfSignedCertificate(t, signer, "CMS Signer")
+	content := []byte("Content-Type: text/plain\r\n\r\nquarterly report\r\n")
+	signingTime := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	der, err := enigma.SignCMS(signer, cert, content, enigma.CMSSignOptions{SigningTime: signingTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd, err := enigma.ParseCMSSignedData(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd.Detached || !bytes.Equal(sd.Content, content) {
+		t.Fatalf("attached content %q, detached %v", sd.Content, sd.Detached)
+	}
+	if sd.Signer == nil || !sd.Signer.Equal(cert) || len(sd.Certificates) != 1 {
+		t.Fatalf("signer %v of %d certificates", sd.Signer, len(sd.Certificates))
+	}
+	if !sd.SigningTime.Equal(signingTime) {
+		t.Errorf("signing time %v, want %v", sd.SigningTime, signingTime)
+	}
+	if ok, err := sd.Verify(nil); err != nil || !ok {
+		t.Fatalf("Verify = %v, %v", ok, err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if _, err := sd.Signer.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signature is the last element
+	tampered, err := enigma.ParseCMSSignedData(flipBit(der, len(der)-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := tampered.Verify(nil); err != nil || ok {
+		t.Fatalf("tampered signature verified: %v, %v", ok, err)
+	}
+	sd.Content = []byte("quarterly report, revised")
+	if ok, err := sd.Verify(nil); err != nil || ok {
+		t.Fatalf("modified content verified: %v, %v", ok, err)
+	}
+
+	other := newDeviceSigner(t, dev, "cms-other")
+	if _, err := enigma.SignCMS(other, cert, content, enigma.CMSSignOptions{}); err == nil {
+		t.Fatal("signed with a key that does not match the certificate")
+	}
+}
+
+func TestSignCMSDetached(t *testing.T) {
+	dev := InitTestLibrary(t)
+	root := newDeviceSigner(t, dev, "cms-root")
+	rootCert := selfSignedCertificate(t, root, "CMS Root")
+	signer := newDeviceSigner(t, dev, "cms-leaf")
+
+	leafDER, err := enigma.CreateCertificate(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "CMS Leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, rootCert, signer.Public(), root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCert, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := make([]byte, 5000)
+	rand.Read(content)
+
+	der, err := enigma.SignCMS(signer, leafCert, content, enigma.CMSSignOptions{Detached: true, Certificates: []*x509.Certificate{rootCert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(der, content[:64]) {
+		t.Fatal("detached signature contains the content")
+	}
+
+	sd, err := enigma.ParseCMSSignedData(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sd.Detached || sd.Content != nil || len(sd.Certificates) != 2 || !sd.Signer.Equal(leafCert) {
+		t.Fatalf("detached %v, %d certificates", sd.Detached, len(sd.Certificates))
+	}
+	if ok, err := sd.Verify(content); err != nil || !ok {
+		t.Fatalf("Verify = %v, %v", ok, err)
+	}
+	if ok, err := sd.Verify(flipBit(content, 100)); err != nil || ok {
+		t.Fatalf("modified content verified: %v, %v", ok, err)
+	}
+	if _, err := sd.Verify(nil); err == nil {
+		t.Fatal("verified a detached signature without the content")
+	}
+
+	// An empty message is signed as attached empty content
+	der, err = enigma.SignCMS(signer, leafCert, nil, enigma.CMSSignOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sd, err = enigma.ParseCMSSignedData(der); err != nil || sd.Detached {
+		t.Fatalf("empty content: detached %v, %v", sd != nil && sd.Detached, err)
+	}
+	if ok, err := sd.Verify(nil); err != nil || !ok {
+		t.Fatalf("Verify empty = %v, %v", ok, err)
+	}
+
+	if _, err := enigma.ParseCMSSignedData(leafDER); !errors.Is(err, enigma.ErrCMSFormat) {
+		t.Fatalf("certificate parsed as CMS: %v", err)
+	}
+}
+
+func TestEncryptCMS(t *testing.T) {
+	dev := InitTestLibrary(t)
+	alice := newDeviceSigner(t, dev, "alice")
+	aliceCert := selfSignedCertificate(t, alice, "Alice")
+	bob := newDeviceSigner(t, dev, "bob")
+	bobPub := bob.Public().(*rsa.PublicKey)
+	content := []byte("the launch codes are in the usual place")
+
+	// One recipient is named by a certificate, the other by subject key ID
+	der, err := enigma.EncryptCMS(dev, content,
+		enigma.CMSRecipient{KeyID: alice.KeyID(), Certificate: aliceCert},
+		enigma.CMSRecipient{KeyID: bob.KeyID(), PublicKey: bobPub},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(der, content) {
+		t.Fatal("EnvelopedData contains the plaintext")
+	}
+
+	for _, recipient := range []enigma.CMSRecipient{
+		{KeyID: alice.KeyID(), Certificate: aliceCert},
+		{KeyID: bob.KeyID(), PublicKey: bobPub},
+		{KeyID: bob.KeyID()},
+	} {
+		plaintext, err := enigma.DecryptCMS(dev, recipient, der)
+		if err != nil {
+			t.Fatalf("DecryptCMS for %s: %v", recipient.KeyID, err)
+		}
+		if !bytes.Equal(plaintext, content) {
+			t.Fatalf("DecryptCMS for %s = %q", recipient.KeyID, plaintext)
+		}
+	}
+
+	carol := newDeviceSigner(t, dev, "carol")
+	if _, err := enigma.DecryptCMS(dev, enigma.CMSRecipient{KeyID: carol.KeyID(), PublicKey: carol.Public().(*rsa.PublicKey)}, der); !errors.Is(err, enigma.ErrCMSRecipient) {
+		t.Fatalf("DecryptCMS for another recipient = %v, want ErrCMSRecipient", err)
+	}
+	if _, err := enigma.DecryptCMS(dev, enigma.CMSRecipient{KeyID: carol.KeyID()}, der); !errors.Is(err, enigma.ErrCMSDecrypt) {
+		t.Fatalf("DecryptCMS with another key = %v, want ErrCMSDecrypt", err)
+	}
+
+	// Flipping the last byte of the second to last block flips the padding length
+	tampered := flipBit(der, len(der)-17)
+	if _, err := enigma.DecryptCMS(dev, enigma.CMSRecipient{KeyID: bob.KeyID()}, tampered); !errors.Is(err, enigma.ErrCMSDecrypt) {
+		t.Fatalf("DecryptCMS of tampered content = %v, want ErrCMSDecrypt", err)
+	}
+
+	// Without a key ID the content key is encrypted in software
+	der, err = enigma.EncryptCMS(nil, content, enigma.CMSRecipient{Certificate: aliceCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := enigma.DecryptCMS(dev, enigma.CMSRecipient{KeyID: alice.KeyID(), Certificate: aliceCert}, der)
+	if err != nil || !bytes.Equal(plaintext, content) {
+		t.Fatalf("DecryptCMS = %q, %v", plaintext, err)
+	}
+
+	if _, err := enigma.EncryptCMS(dev, content, enigma.CMSRecipient{KeyID: bob.KeyID()}); !errors.Is(err, enigma.ErrCMSRecipient) {
+		t.Fatalf("EncryptCMS for an unnamed recipient = %v, want ErrCMSRecipient", err)
+	}
+}
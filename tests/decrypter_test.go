@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// decryptCountingDevice counts rsa_decrypt calls.
+type decryptCountingDevice struct {
+	enigma.Device
+
+	calls int
+}
+
+func (d *decryptCountingDevice) RSADecrypt(keyID, cipher, message []byte) (int, error) {
+	d.calls++
+	return d.Device.RSADecrypt(keyID, cipher, message)
+}
+
+func TestRSADecrypter(t *testing.T) {
+	dev := &decryptCountingDevice{Device: InitTestLibrary(t)}
+
+	_, keyID, n, e, err := enigma.GenerateKey(dev, "decrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, dev, keyID)
+	pub, err := enigma.PublicKeyFromBase64(n, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decrypter crypto.Decrypter = enigma.NewRSADecrypter(dev, keyID, pub)
+	if !pub.Equal(decrypter.Public()) {
+		t.Fatal("Public returned another key")
+	}
+
+	sessionKey := make([]byte, 32)
+	rand.Read(sessionKey)
+	ciphertext, err := rsa.EncryptPKCS1v15(rand.Reader, pub, sessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []crypto.DecrypterOpts{nil, &rsa.PKCS1v15DecryptOptions{}, &rsa.PKCS1v15DecryptOptions{SessionKeyLen: 32}} {
+		plaintext, err := decrypter.Decrypt(rand.Reader, ciphertext, opts)
+		if err != nil || !bytes.Equal(plaintext, sessionKey) {
+			t.Fatalf("opts %+v: %x, %v", opts, plaintext, err)
+		}
+	}
+
+	// A session key of the wrong length is replaced by a random one
+	plaintext, err := decrypter.Decrypt(rand.Reader, ciphertext, &rsa.PKCS1v15DecryptOptions{SessionKeyLen: 16})
+	if err != nil || len(plaintext) != 16 || bytes.Equal(plaintext, sessionKey[:16]) {
+		t.Fatalf("wrong session key length: %x, %v", plaintext, err)
+	}
+
+	// So is a ciphertext that does not decrypt, which otherwise fails
+	if _, err := decrypter.Decrypt(rand.Reader, flipBit(ciphertext, 10), nil); !errors.Is(err, enigma.ErrDecStreamFail) {
+		t.Fatalf("modified ciphertext = %v, want ErrDecStreamFail", err)
+	}
+	if plaintext, err := decrypter.Decrypt(rand.Reader, flipBit(ciphertext, 10), &rsa.PKCS1v15DecryptOptions{SessionKeyLen: 32}); err != nil || len(plaintext) != 32 {
+		t.Fatalf("modified ciphertext with a session key: %x, %v", plaintext, err)
+	}
+
+	if _, err := decrypter.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256}); !errors.Is(err, enigma.ErrDecryptScheme) {
+		t.Fatalf("OAEP = %v, want ErrDecryptScheme", err)
+	}
+
+	calls := dev.calls
+	for _, size := range []int{0, 255, 257, 512} {
+		if _, err := enigma.RSADecryptBytes(dev, keyID, make([]byte, size)); !errors.Is(err, enigma.ErrCiphertextSize) {
+			t.Errorf("%d bytes: err = %v, want ErrCiphertextSize", size, err)
+		}
+	}
+	if dev.calls != calls {
+		t.Fatal("wrong-length ciphertext reached the device")
+	}
+
+	if _, err := enigma.NewRSADecrypter(dev, "missing", pub).Decrypt(rand.Reader, ciphertext, &rsa.PKCS1v15DecryptOptions{SessionKeyLen: 32}); err == nil {
+		t.Fatal("a missing key was hidden behind a random session key")
+	}
+}
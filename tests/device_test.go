@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// memDevice is an in-memory stand-in for the token covering the exports the
+// tests below exercise. Calling any other export panics on the nil
+// embedded Device.
+type memDevice struct {
+	enigma.Device
+
+	block     cipher.Block
+	status    enigma.RETStatus
+	keyIDs    []byte
+	customIDs []byte
+}
+
+func newMemDevice(t *testing.T) *memDevice {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &memDevice{
+		block:     block,
+		status:    enigma.RETStatus{RetryCountLeftIsValid: 1, RetryCountLeft: 5},
+		keyIDs:    make([]byte, 16*8),
+		customIDs: make([]byte, 16*8),
+	}
+}
+
+func (d *memDevice) DetectDevice() (bool, error) { return true, nil }
+
+func (d *memDevice) ChipSN() ([16]byte, error) {
+	return [16]byte{0xde, 0xad, 0xbe, 0xef}, nil
+}
+
+func (d *memDevice) CheckLoginStatus() (enigma.RETStatus, error) { return d.status, nil }
+
+func (d *memDevice) AESStreamEncDec(input []byte, output []byte, sectors int, encrypt bool) error {
+	for i := 0; i < sectors*512; i += 16 {
+		if encrypt {
+			d.block.Encrypt(output[i:i+16], input[i:i+16])
+		} else {
+			d.block.Decrypt(output[i:i+16], input[i:i+16])
+		}
+	}
+	return nil
+}
+
+func (d *memDevice) ListAllKeyIDs(keyIDs, customIDs []byte) (uint8, error) {
+	copy(keyIDs, d.keyIDs)
+	copy(customIDs, d.customIDs)
+
+	var count uint8
+	for i := 0; i < 16; i++ {
+		if d.keyIDs[i*8] != 0 {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func TestDeviceAESRoundTrip(t *testing.T) {
+	dev := newMemDevice(t)
+
+	for _, size := range []int{0, 1, 15, 16, 511, 512, 513, 2048} {
+		plaintext := string(bytes.Repeat([]byte{'a'}, size))
+
+		ciphertext, err := enigma.AESEncrypt(dev, plaintext)
+		if err != nil {
+			t.Fatalf("size %d: encrypt: %v", size, err)
+		}
+
+		if len(ciphertext)%16 != 0 || len(ciphertext) <= size {
+			t.Fatalf("size %d: unexpected ciphertext length %d", size, len(ciphertext))
+		}
+
+		decrypted, err := enigma.AESDecrypt(dev, ciphertext)
+		if err != nil {
+			t.Fatalf("size %d: decrypt: %v", size, err)
+		}
+
+		if decrypted != plaintext {
+			t.Fatalf("size %d: decrypted text does not match", size)
+		}
+	}
+}
+
+func TestDeviceAESBlock(t *testing.T) {
+	dev := newMemDevice(t)
+
+	plaintext := [16]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77}
+
+	encrypted, err := enigma.AESEncryptBlock(dev, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want [16]byte
+	dev.block.Encrypt(want[:], plaintext[:])
+	if encrypted != want {
+		t.Fatalf("AESEncryptBlock = %x, want %x", encrypted, want)
+	}
+
+	decrypted, err := enigma.AESDecryptBlock(dev, encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decrypted != plaintext {
+		t.Fatalf("AESDecryptBlock = %x, want %x", decrypted, plaintext)
+	}
+}
+
+func TestDeviceListKeys(t *testing.T) {
+	dev := newMemDevice(t)
+	copy(dev.keyIDs[0:], "enova-01")
+	copy(dev.customIDs[0:], "alice")
+	copy(dev.keyIDs[3*8:], "enova-04")
+	copy(dev.customIDs[3*8:], "bob")
+
+	res, count, keyIDs, customIDs, err := enigma.ListKeys(dev)
+	if !res || err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Errorf("count = %d, want 2", count)
+	}
+
+	if len(keyIDs) != 2 || keyIDs[0] != "enova-01" || keyIDs[1] != "enova-04" {
+		t.Errorf("key IDs = %q", keyIDs)
+	}
+
+	if len(customIDs) != 2 || customIDs[0] != "alice" || customIDs[1] != "bob" {
+		t.Errorf("custom IDs = %q", customIDs)
+	}
+}
+
+func TestDeviceStatus(t *testing.T) {
+	dev := newMemDevice(t)
+
+	res, err := enigma.Detect(dev)
+	if !res || err != nil {
+		t.Fatal(err)
+	}
+
+	res, uid, err := enigma.UID(dev)
+	if !res || err != nil {
+		t.Fatal(err)
+	}
+
+	if uid != "deadbeef000000000000000000000000" {
+		t.Errorf("UID = %s", uid)
+	}
+}
+
+func TestDeviceLoginStatus(t *testing.T) {
+	dev := newMemDevice(t)
+
+	loggedIn, retryCount, valid, err := enigma.LoginStatus(dev)
+	if !loggedIn || err != nil {
+		t.Fatal(err)
+	}
+
+	if retryCount != 5 || !valid {
+		t.Errorf("retry count = %d (valid %v), want 5 (valid true)", retryCount, valid)
+	}
+
+	dev.status.RetryCountLeft = 0
+
+	loggedIn, _, _, err = enigma.LoginStatus(dev)
+	if loggedIn || !errors.Is(err, enigma.ErrOverFailRetryCount) {
+		t.Errorf("LoginStatus with no retries left = %v, %v", loggedIn, err)
+	}
+}
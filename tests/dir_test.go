@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func entryPaths(result *enigma.DirResult) []string {
+	var paths []string
+	for _, entry := range result.Files {
+		paths = append(paths, entry.Path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestDirRoundTrip(t *testing.T) {
+	dev := newMemDevice(t)
+	root := t.TempDir()
+	source := filepath.Join(root, "project")
+
+	files := map[string]string{
+		"README.md":             "readme",
+		"src/main.go":           "package main",
+		"src/util/strings.go":   "package util",
+		".git/HEAD":             "ref: refs/heads/main",
+		"node_modules/x/x.js":   "module.exports = 1",
+		"build/output.bin":      "binary",
+		"src/util/strings.go~":  "backup",
+		"docs/guide/intro.md":   "intro",
+		"docs/guide/images.png": "png",
+	}
+	writeTree(t, source, files)
+
+	encrypted := filepath.Join(root, "encrypted")
+	result, err := enigma.AESSealDir(dev, source, encrypted, enigma.DirOptions{
+		Exclude: []string{".git", "node_modules", "*~", "docs/guide/*.png"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"README.md", "build/output.bin", "docs/guide/intro.md", "src/main.go", "src/util/strings.go"}
+	if got := entryPaths(result); !slices.Equal(got, want) {
+		t.Fatalf("encrypted %q, want %q", got, want)
+	}
+	if result.Failed != 0 || result.Succeeded != len(want) {
+		t.Fatalf("succeeded %d, failed %d", result.Succeeded, result.Failed)
+	}
+
+	if _, err := os.Stat(filepath.Join(encrypted, "src", "util", "strings.go.emx")); err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted := filepath.Join(root, "decrypted")
+	result, err = enigma.AESOpenDir(dev, encrypted, decrypted, enigma.DirOptions{
+		Include: []string{"src/*", "src/*/*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = []string{"src/main.go.emx", "src/util/strings.go.emx"}
+	if got := entryPaths(result); !slices.Equal(got, want) {
+		t.Fatalf("decrypted %q, want %q", got, want)
+	}
+
+	content, err := os.ReadFile(filepath.Join(decrypted, "src", "util", "strings.go"))
+	if err != nil || string(content) != "package util" {
+		t.Fatalf("decrypted content = %q, %v", content, err)
+	}
+}
+
+func TestDirContinuesPastFailures(t *testing.T) {
+	dev := newMemDevice(t)
+	root := t.TempDir()
+	source := filepath.Join(root, "project")
+	writeTree(t, source, map[string]string{
+		"a.txt":     "a",
+		"b.txt":     "b",
+		"sub/c.txt": "c",
+	})
+
+	target := filepath.Join(root, "encrypted")
+	writeTree(t, target, map[string]string{"b.txt.emx": "in the way"})
+
+	result, err := enigma.AESSealDir(dev, source, target, enigma.DirOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Succeeded != 2 || result.Failed != 1 {
+		t.Fatalf("succeeded %d, failed %d", result.Succeeded, result.Failed)
+	}
+
+	failures := result.Failures()
+	if len(failures) != 1 || failures[0].Path != "b.txt" {
+		t.Fatalf("failures = %+v", failures)
+	}
+
+	data, err := os.ReadFile(filepath.Join(target, enigma.ManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest enigma.DirResult
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Operation != "encrypt" || manifest.Failed != 1 || len(manifest.Files) != 3 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+}
+
+func TestDirTargetInsideSource(t *testing.T) {
+	dev := newMemDevice(t)
+	source := t.TempDir()
+	writeTree(t, source, map[string]string{"a.txt": "a"})
+
+	target := filepath.Join(source, "encrypted")
+
+	for i := 0; i < 2; i++ {
+		result, err := enigma.AESSealDir(dev, source, target, enigma.DirOptions{Overwrite: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := entryPaths(result); !slices.Equal(got, []string{"a.txt"}) {
+			t.Fatalf("run %d encrypted %q, want only a.txt", i+1, got)
+		}
+	}
+}
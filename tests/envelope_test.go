@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestAESEnvelopeRoundTrip(t *testing.T) {
+	dev := newMemDevice(t)
+
+	for _, size := range []int{0, 1, 16, 65535, 65536, 65537, 200000} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		envelope, err := enigma.AESSeal(dev, plaintext)
+		if err != nil {
+			t.Fatalf("size %d: seal: %v", size, err)
+		}
+
+		opened, err := enigma.AESOpen(dev, envelope)
+		if err != nil {
+			t.Fatalf("size %d: open: %v", size, err)
+		}
+
+		if !bytes.Equal(opened, plaintext) {
+			t.Fatalf("size %d: opened plaintext does not match", size)
+		}
+	}
+}
+
+func TestAESEnvelopeRandomized(t *testing.T) {
+	dev := newMemDevice(t)
+
+	first, err := enigma.AESSeal(dev, []byte("same message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := enigma.AESSeal(dev, []byte("same message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(first, second) {
+		t.Fatal("sealing the same message twice gave the same envelope")
+	}
+}
+
+func TestAESEnvelopeTamper(t *testing.T) {
+	dev := newMemDevice(t)
+
+	plaintext := make([]byte, 100000)
+	rand.Read(plaintext)
+
+	envelope, err := enigma.AESSeal(dev, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 16-byte header, one full segment with its tag, then the final one
+	segmentEnd := 16 + 65536 + 16
+
+	cases := map[string][]byte{
+		"nonce prefix":      flipBit(envelope, 10),
+		"first segment":     flipBit(envelope, 100),
+		"final segment":     flipBit(envelope, segmentEnd+5),
+		"tag":               flipBit(envelope, len(envelope)-1),
+		"truncated segment": envelope[:len(envelope)-1],
+		"dropped segment":   envelope[:segmentEnd],
+		"appended data":     append(bytes.Clone(envelope), 0),
+		"header only":       envelope[:16],
+	}
+
+	for name, tampered := range cases {
+		if _, err := enigma.AESOpen(dev, tampered); !errors.Is(err, enigma.ErrEnvelopeAuth) {
+			t.Errorf("%s: err = %v, want ErrEnvelopeAuth", name, err)
+		}
+	}
+}
+
+func TestAESEnvelopeFormat(t *testing.T) {
+	dev := newMemDevice(t)
+
+	legacy, err := enigma.AESEncryptBytes(dev, []byte("legacy ciphertext"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := enigma.AESOpen(dev, legacy); !errors.Is(err, enigma.ErrEnvelopeFormat) {
+		t.Fatalf("legacy ciphertext = %v, want ErrEnvelopeFormat", err)
+	}
+
+	envelope, err := enigma.AESSeal(dev, []byte("future"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envelope[4] = 2
+	if _, err := enigma.AESOpen(dev, envelope); !errors.Is(err, enigma.ErrEnvelopeFormat) {
+		t.Fatalf("unknown version = %v, want ErrEnvelopeFormat", err)
+	}
+}
+
+func TestAESEnvelopeDevice(t *testing.T) {
+	dev := InitTestLibrary(t)
+
+	plaintext := []byte(RandomString(1000))
+
+	envelope, err := enigma.AESSeal(dev, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := enigma.AESOpen(dev, envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(opened, plaintext) {
+		t.Fatal("opened plaintext does not match")
+	}
+}
+
+func flipBit(data []byte, i int) []byte {
+	flipped := bytes.Clone(data)
+	flipped[i] ^= 1
+	return flipped
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// otherDevice shares memDevice's key but reports another chip serial.
+type otherDevice struct {
+	*memDevice
+}
+
+func (d *otherDevice) ChipSN() ([16]byte, error) {
+	return [16]byte{0xca, 0xfe}, nil
+}
+
+func writeTestFile(t *testing.T, dir string, size int) (string, []byte) {
+	content := make([]byte, size)
+	rand.Read(content)
+
+	path := filepath.Join(dir, "report.pdf")
+	if err := os.WriteFile(path, content, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, content
+}
+
+func TestFileContainerRoundTrip(t *testing.T) {
+	dev := newMemDevice(t)
+	dir := t.TempDir()
+	source, content := writeTestFile(t, dir, 150000)
+
+	var progress int64
+	container, header, err := enigma.AESSealFile(dev, source, "", enigma.FileOptions{
+		Progress: func(done, total int64) { progress = done },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if container != source+".emx" {
+		t.Errorf("container = %s", container)
+	}
+	if progress != int64(len(content)) {
+		t.Errorf("progress ended at %d, want %d", progress, len(content))
+	}
+	if header.Name != "report.pdf" || header.Size != int64(len(content)) || header.DeviceUID != "deadbeef000000000000000000000000" {
+		t.Errorf("header = %+v", header)
+	}
+
+	outDir := filepath.Join(dir, "out")
+	if err := os.Mkdir(outDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	target, opened, err := enigma.AESOpenFile(dev, container, outDir, enigma.FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if target != filepath.Join(outDir, "report.pdf") || opened.SHA256 != header.SHA256 {
+		t.Fatalf("opened %s with header %+v", target, opened)
+	}
+
+	decrypted, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, content) {
+		t.Fatal("decrypted content does not match")
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(header.ModTime) {
+		t.Errorf("mtime = %v, want %v", info.ModTime(), header.ModTime)
+	}
+}
+
+func TestFileContainerOverwrite(t *testing.T) {
+	dev := newMemDevice(t)
+	dir := t.TempDir()
+	source, _ := writeTestFile(t, dir, 100)
+
+	container, _, err := enigma.AESSealFile(dev, source, "", enigma.FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := enigma.AESSealFile(dev, source, "", enigma.FileOptions{}); !errors.Is(err, enigma.ErrTargetFileExists) {
+		t.Fatalf("second seal = %v, want ErrTargetFileExists", err)
+	}
+
+	if _, _, err := enigma.AESSealFile(dev, source, "", enigma.FileOptions{Overwrite: true}); err != nil {
+		t.Fatalf("seal with overwrite = %v", err)
+	}
+
+	// Decrypting next to the container would replace the source
+	if _, _, err := enigma.AESOpenFile(dev, container, "", enigma.FileOptions{}); !errors.Is(err, enigma.ErrTargetFileExists) {
+		t.Fatalf("open onto the source = %v, want ErrTargetFileExists", err)
+	}
+}
+
+func TestFileContainerTamper(t *testing.T) {
+	dev := newMemDevice(t)
+	dir := t.TempDir()
+	source, _ := writeTestFile(t, dir, 100000)
+
+	container, _, err := enigma.AESSealFile(dev, source, "", enigma.FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(container)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := filepath.Join(dir, "tampered.emx")
+	if err := os.WriteFile(tampered, flipBit(data, len(data)-100), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(dir, "restored.pdf")
+	if _, _, err := enigma.AESOpenFile(dev, tampered, target, enigma.FileOptions{}); !errors.Is(err, enigma.ErrEnvelopeAuth) {
+		t.Fatalf("tampered container = %v, want ErrEnvelopeAuth", err)
+	}
+
+	// Neither the target nor a temporary file may be left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		for _, entry := range entries {
+			t.Log(entry.Name())
+		}
+		t.Fatalf("directory holds %d entries after a failed decryption, want 3", len(entries))
+	}
+
+	if _, _, err := enigma.AESOpenFile(&otherDevice{dev}, container, target, enigma.FileOptions{}); !errors.Is(err, enigma.ErrContainerDevice) {
+		t.Fatalf("container from another device = %v, want ErrContainerDevice", err)
+	}
+
+	if _, _, err := enigma.AESOpenFile(dev, source, target, enigma.FileOptions{}); !errors.Is(err, enigma.ErrContainerFormat) {
+		t.Fatalf("plain file = %v, want ErrContainerFormat", err)
+	}
+}
+
+func TestFileContainerDevice(t *testing.T) {
+	dev := InitTestLibrary(t)
+	dir := t.TempDir()
+	source, content := writeTestFile(t, dir, 5000)
+
+	container, _, err := enigma.AESSealFile(dev, source, filepath.Join(dir, "sealed"), enigma.FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target, _, err := enigma.AESOpenFile(dev, container, filepath.Join(dir, "opened"), enigma.FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, content) {
+		t.Fatal("decrypted content does not match")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestFileSignature(t *testing.T) {
+	dev := InitTestLibrary(t)
+	signer := newDeviceSigner(t, dev, "files")
+	pub := signer.Public().(*rsa.PublicKey)
+
+	// Larger than one rsa_sign message, and binary
+	data := make([]byte, 3<<20+17)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"sha256", "SHA-384", "sha512"} {
+		h, err := enigma.ParseFileHash(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sig, err := enigma.SignFile(signer, bytes.NewReader(data), h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig.Hash != h.String() || sig.Size != int64(len(data)) || sig.KeyID != signer.KeyID() || len(sig.Digest) != 2*h.Size() {
+			t.Fatalf("%s: signature %+v", name, sig)
+		}
+
+		encoded, err := sig.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := enigma.ParseFileSignature(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, verify := range []struct {
+			name string
+			fn   func(data []byte) (bool, error)
+		}{
+			{"software", func(data []byte) (bool, error) { return parsed.Verify(bytes.NewReader(data), pub) }},
+			{"device", func(data []byte) (bool, error) { return parsed.VerifyOnDevice(dev, signer.KeyID(), bytes.NewReader(data)) }},
+		} {
+			if ok, err := verify.fn(data); err != nil || !ok {
+				t.Fatalf("%s %s: %v, %v", name, verify.name, ok, err)
+			}
+
+			modified := flipBit(data, len(data)/2)
+			if ok, err := verify.fn(modified); err != nil || ok {
+				t.Errorf("%s %s: modified file: %v, %v", name, verify.name, ok, err)
+			}
+			if ok, err := verify.fn(data[:len(data)-1]); err != nil || ok {
+				t.Errorf("%s %s: truncated file: %v, %v", name, verify.name, ok, err)
+			}
+		}
+
+		// The metadata is signed too
+		tampered := *parsed
+		tampered.Timestamp = tampered.Timestamp.Add(-time.Hour)
+		if ok, err := tampered.Verify(bytes.NewReader(data), pub); err != nil || ok {
+			t.Errorf("%s: tampered timestamp: %v, %v", name, ok, err)
+		}
+	}
+
+	sig, err := enigma.SignFile(signer, bytes.NewReader(data), crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sig.Verify(bytes.NewReader(data), &other.PublicKey); err == nil {
+		t.Error("verified with another public key")
+	}
+
+	if _, err := enigma.ParseFileHash("md5"); err == nil {
+		t.Error("md5 accepted")
+	}
+	for _, encoded := range []string{"", "{}", `{"version":1,"algorithm":"RSASSA-PSS","hash":"SHA-256"}`, `{"version":1,"algorithm":"RSASSA-PKCS1-v1_5-SHA256","hash":"SHA-1"}`} {
+		if _, err := enigma.ParseFileSignature([]byte(encoded)); !errors.Is(err, enigma.ErrFileSignatureFormat) {
+			t.Errorf("%q: err = %v, want ErrFileSignatureFormat", encoded, err)
+		}
+	}
+}
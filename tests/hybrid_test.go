@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestRSAEnvelopeRoundTrip(t *testing.T) {
+	dev := InitTestLibrary(t)
+
+	_, keyID, _, _, err := enigma.GenerateKey(dev, "hybrid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, dev, keyID)
+
+	// Well past one RSA block, and across a segment boundary
+	for _, size := range []int{0, 300, 65536, 150000} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		envelope, err := enigma.RSASeal(dev, keyID, plaintext)
+		if err != nil {
+			t.Fatalf("size %d: seal: %v", size, err)
+		}
+
+		opened, err := enigma.RSAOpen(dev, keyID, envelope)
+		if err != nil {
+			t.Fatalf("size %d: open: %v", size, err)
+		}
+		if !bytes.Equal(opened, plaintext) {
+			t.Fatalf("size %d: opened plaintext does not match", size)
+		}
+	}
+}
+
+func TestRSAEnvelopeImportedKey(t *testing.T) {
+	recipient := InitTestLibrary(t)
+	sender := InitTestLibrary(t)
+
+	_, privateID, n, e, err := enigma.GenerateKey(recipient, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, recipient, privateID)
+
+	_, publicID, err := enigma.ImportKey(sender, "bob", n, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, sender, publicID)
+
+	document := bytes.Repeat([]byte("quarterly report\n"), 1000)
+	envelope, err := enigma.RSASeal(sender, publicID, document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := enigma.RSAOpen(recipient, privateID, envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, document) {
+		t.Fatal("opened document does not match")
+	}
+
+	// The sender only holds the public key
+	if _, err := enigma.RSAOpen(sender, publicID, envelope); err == nil {
+		t.Fatal("opened with a public key")
+	}
+}
+
+func TestRSAEnvelopeTamper(t *testing.T) {
+	dev := InitTestLibrary(t)
+
+	_, keyID, _, _, err := enigma.GenerateKey(dev, "hybrid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, dev, keyID)
+	_, otherID, _, _, err := enigma.GenerateKey(dev, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, dev, otherID)
+
+	plaintext := make([]byte, 100000)
+	rand.Read(plaintext)
+
+	envelope, err := enigma.RSASeal(dev, keyID, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 261-byte header, one full segment with its tag, then the final one
+	segmentEnd := 261 + 65536 + 16
+
+	cases := map[string][]byte{
+		"first segment":     flipBit(envelope, 1000),
+		"final segment":     flipBit(envelope, segmentEnd+5),
+		"truncated segment": envelope[:len(envelope)-1],
+		"dropped segment":   envelope[:segmentEnd],
+		"appended data":     append(bytes.Clone(envelope), 0),
+	}
+
+	for name, tampered := range cases {
+		if _, err := enigma.RSAOpen(dev, keyID, tampered); !errors.Is(err, enigma.ErrRSAEnvelopeAuth) {
+			t.Errorf("%s: err = %v, want ErrRSAEnvelopeAuth", name, err)
+		}
+	}
+
+	if _, err := enigma.RSAOpen(dev, otherID, envelope); err == nil {
+		t.Error("opened with another key")
+	}
+	if _, err := enigma.RSAOpen(dev, keyID, flipBit(envelope, 100)); err == nil {
+		t.Error("opened with a modified content key")
+	}
+
+	aesEnvelope, err := enigma.AESSeal(dev, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enigma.RSAOpen(dev, keyID, aesEnvelope); !errors.Is(err, enigma.ErrRSAEnvelopeFormat) {
+		t.Errorf("AES envelope: err = %v, want ErrRSAEnvelopeFormat", err)
+	}
+}
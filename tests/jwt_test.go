@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestJWT(t *testing.T) {
+	dev := InitTestLibrary(t)
+	signer := newDeviceSigner(t, dev, "jwt")
+	pub := signer.Public().(*rsa.PublicKey)
+
+	token, err := enigma.SignJWT(signer, []byte(`{"sub": "build", "iss": "ci", "aud": ["api", "web"], "nbf": 1000, "exp": 2000.5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwt, err := enigma.ParseJWT(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jwt.Header.Algorithm != "RS256" || jwt.Header.KeyID != signer.KeyID() || jwt.Header.Type != "JWT" {
+		t.Errorf("header %+v", jwt.Header)
+	}
+	if jwt.Claims["sub"] != "build" {
+		t.Errorf("claims %v", jwt.Claims)
+	}
+
+	if ok, err := jwt.Verify(pub); err != nil || !ok {
+		t.Fatalf("Verify = %v, %v", ok, err)
+	}
+	if ok, err := jwt.VerifyOnDevice(dev, signer.KeyID()); err != nil || !ok {
+		t.Fatalf("VerifyOnDevice = %v, %v", ok, err)
+	}
+
+	// A token with other claims under the same signature
+	parts := strings.Split(token, ".")
+	forged, err := enigma.ParseJWT(parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := forged.Verify(pub); err != nil || ok {
+		t.Errorf("forged Verify = %v, %v", ok, err)
+	}
+	if ok, err := forged.VerifyOnDevice(dev, signer.KeyID()); err != nil || ok {
+		t.Errorf("forged VerifyOnDevice = %v, %v", ok, err)
+	}
+
+	claimTests := []struct {
+		now      int64
+		issuer   string
+		audience string
+		ok       bool
+	}{
+		{1500, "", "", true},
+		{1500, "ci", "web", true},
+		{999, "", "", false},
+		{2000, "", "", true},
+		{2001, "", "", false},
+		{1500, "other", "", false},
+		{1500, "", "mobile", false},
+	}
+	for _, c := range claimTests {
+		err := jwt.ValidateClaims(time.Unix(c.now, 0), 0, c.issuer, c.audience)
+		if c.ok && err != nil || !c.ok && !errors.Is(err, enigma.ErrJWTClaims) {
+			t.Errorf("now %d, iss %q, aud %q: %v", c.now, c.issuer, c.audience, err)
+		}
+	}
+	if err := jwt.ValidateClaims(time.Unix(2010, 0), 10*time.Second, "", ""); err != nil {
+		t.Errorf("leeway: %v", err)
+	}
+
+	// RS512 from elsewhere verifies in software only
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS512"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{}`))
+	digest := sha512.Sum512([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA512, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs512, err := enigma.ParseJWT(signingInput + "." + base64.RawURLEncoding.EncodeToString(signature))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := rs512.Verify(&key.PublicKey); err != nil || !ok {
+		t.Errorf("RS512 Verify = %v, %v", ok, err)
+	}
+	if _, err := rs512.VerifyOnDevice(dev, signer.KeyID()); !errors.Is(err, enigma.ErrJWTAlgorithm) {
+		t.Errorf("RS512 VerifyOnDevice: err = %v, want ErrJWTAlgorithm", err)
+	}
+
+	none, err := enigma.ParseJWT(base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := none.Verify(pub); !errors.Is(err, enigma.ErrJWTAlgorithm) {
+		t.Errorf("alg none: err = %v, want ErrJWTAlgorithm", err)
+	}
+
+	for _, bad := range []string{"", "a.b", "a.b.c.d", "!.e30.", parts[0] + ".W10." + parts[2]} {
+		if _, err := enigma.ParseJWT(bad); !errors.Is(err, enigma.ErrJWTFormat) {
+			t.Errorf("%q: err = %v, want ErrJWTFormat", bad, err)
+		}
+	}
+	if _, err := enigma.SignJWT(signer, []byte(`["not", "an", "object"]`)); !errors.Is(err, enigma.ErrJWTFormat) {
+		t.Errorf("array claims: err = %v, want ErrJWTFormat", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestDeriveKeyCounterMode(t *testing.T) {
+	dev := newMemDevice(t)
+	label, context := []byte("tenant-key"), []byte("acme")
+
+	key, err := enigma.DeriveKey(dev, label, context, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each block is the CMAC of counter | label | 0x00 | context | bits
+	for i := 0; i < 3; i++ {
+		var input []byte
+		input = binary.BigEndian.AppendUint32(input, uint32(i+1))
+		input = append(input, label...)
+		input = append(input, 0)
+		input = append(input, context...)
+		input = binary.BigEndian.AppendUint32(input, 40*8)
+
+		block, err := enigma.AESCMAC(dev, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := block[:min(16, 40-i*16)]
+		if !bytes.Equal(key[i*16:i*16+len(want)], want) {
+			t.Fatalf("block %d = %x, want %x", i+1, key[i*16:], want)
+		}
+	}
+}
+
+func TestDeriveKeyInputs(t *testing.T) {
+	dev := newMemDevice(t)
+
+	derive := func(dev enigma.Device, label, context string, length int) []byte {
+		key, err := enigma.DeriveKey(dev, []byte(label), []byte(context), length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(key) != length {
+			t.Fatalf("length %d: got %d bytes", length, len(key))
+		}
+		return key
+	}
+
+	base := derive(dev, "file-key", "report.pdf", 32)
+
+	if !bytes.Equal(derive(dev, "file-key", "report.pdf", 32), base) {
+		t.Fatal("derivation is not reproducible")
+	}
+
+	others := [][]byte{
+		derive(dev, "file-key", "report.docx", 32),
+		derive(dev, "tenant-key", "report.pdf", 32),
+		// The separator keeps label and context apart
+		derive(dev, "file-keyr", "eport.pdf", 32),
+		derive(keyedDevice(t, "000102030405060708090A0B0C0D0E0F"), "file-key", "report.pdf", 32),
+	}
+	for i, other := range others {
+		if bytes.Equal(other, base) {
+			t.Fatalf("derivation %d matches the base key", i)
+		}
+	}
+
+	// The length is an input, so a shorter key is not a prefix
+	if bytes.Equal(derive(dev, "file-key", "report.pdf", 16), base[:16]) {
+		t.Fatal("16-byte key is a prefix of the 32-byte key")
+	}
+
+	derive(dev, "", "", 1)
+	derive(dev, "odd", "", 1000)
+
+	if _, err := enigma.DeriveKey(dev, nil, nil, 0); err == nil {
+		t.Fatal("zero length accepted")
+	}
+}
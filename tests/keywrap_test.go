@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// keyedDevice returns a memDevice using the given hex AES key.
+func keyedDevice(t *testing.T, kek string) *memDevice {
+	block, err := aes.NewCipher(unhex(t, kek))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dev := newMemDevice(t)
+	dev.block = block
+	return dev
+}
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestKeyWrapRFC3394(t *testing.T) {
+	const (
+		kek128 = "000102030405060708090A0B0C0D0E0F"
+		kek192 = "000102030405060708090A0B0C0D0E0F1011121314151617"
+		kek256 = "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F"
+		key128 = "00112233445566778899AABBCCDDEEFF"
+		key192 = "00112233445566778899AABBCCDDEEFF0001020304050607"
+		key256 = "00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F"
+	)
+
+	cases := []struct {
+		name, kek, key, wrapped string
+	}{
+		{"4.1", kek128, key128, "1FA68B0A8112B447 AEF34BD8FB5A7B82 9D3E862371D2CFE5"},
+		{"4.2", kek192, key128, "96778B25AE6CA435 F92B5B97C050AED2 468AB8A17AD84E5D"},
+		{"4.3", kek256, key128, "64E8C3F9CE0F5BA2 63E9777905818A2A 93C8191E7D6E8AE7"},
+		{"4.4", kek192, key192, "031D33264E15D332 68F24EC260743EDC E1C6C7DDEE725A93 6BA814915C6762D2"},
+		{"4.5", kek256, key192, "A8F9BC1612C68B3F F6E6F4FBE30E71E4 769C8B80A32CB895 8CD5D17D6B254DA1"},
+		{"4.6", kek256, key256, "28C9F404C4B810F4 CBCCB35CFB87F826 3F5786E2D80ED326 CBC7F0E71A99F43B FB988B9B7A02DD21"},
+	}
+
+	for _, tc := range cases {
+		dev := keyedDevice(t, tc.kek)
+		key, want := unhex(t, tc.key), unhex(t, tc.wrapped)
+
+		wrapped, err := enigma.WrapKey(dev, key)
+		if err != nil {
+			t.Fatalf("%s: wrap: %v", tc.name, err)
+		}
+		if !bytes.Equal(wrapped, want) {
+			t.Fatalf("%s: wrapped = %X, want %X", tc.name, wrapped, want)
+		}
+
+		unwrapped, err := enigma.UnwrapKey(dev, want)
+		if err != nil || !bytes.Equal(unwrapped, key) {
+			t.Fatalf("%s: unwrap = %X, %v", tc.name, unwrapped, err)
+		}
+	}
+}
+
+func TestKeyWrapRFC5649(t *testing.T) {
+	dev := keyedDevice(t, "5840df6e29b02af1 ab493b705bf16ea1 ae8338f4dcc176a8")
+
+	cases := []struct {
+		name, key, wrapped string
+	}{
+		{"20 octets", "c37b7e6492584340 bed1220780894115 5068f738", "138bdeaa9b8fa7fc 61f97742e72248ee 5ae6ae5360d1ae6a 5f54f373fa543b6a"},
+		{"7 octets", "466f7250617369", "afbeb0f07dfbf541 9200f2ccb50bb24f"},
+	}
+
+	for _, tc := range cases {
+		key, want := unhex(t, tc.key), unhex(t, tc.wrapped)
+
+		wrapped, err := enigma.WrapKeyWithPadding(dev, key)
+		if err != nil {
+			t.Fatalf("%s: wrap: %v", tc.name, err)
+		}
+		if !bytes.Equal(wrapped, want) {
+			t.Fatalf("%s: wrapped = %x, want %x", tc.name, wrapped, want)
+		}
+
+		unwrapped, err := enigma.UnwrapKeyWithPadding(dev, want)
+		if err != nil || !bytes.Equal(unwrapped, key) {
+			t.Fatalf("%s: unwrap = %x, %v", tc.name, unwrapped, err)
+		}
+	}
+}
+
+func TestKeyUnwrapIntegrity(t *testing.T) {
+	dev := newMemDevice(t)
+	key := bytes.Repeat([]byte{0x5a}, 32)
+
+	wrapped, err := enigma.WrapKey(dev, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 7, 8, len(wrapped) - 1} {
+		if _, err := enigma.UnwrapKey(dev, flipBit(wrapped, i)); !errors.Is(err, enigma.ErrKeyUnwrap) {
+			t.Fatalf("tampered byte %d = %v, want ErrKeyUnwrap", i, err)
+		}
+	}
+
+	// Another key, and the other variant, fail the same way
+	other := keyedDevice(t, "000102030405060708090A0B0C0D0E0F")
+	if _, err := enigma.UnwrapKey(other, wrapped); !errors.Is(err, enigma.ErrKeyUnwrap) {
+		t.Fatalf("wrong key = %v, want ErrKeyUnwrap", err)
+	}
+	if _, err := enigma.UnwrapKeyWithPadding(dev, wrapped); !errors.Is(err, enigma.ErrKeyUnwrap) {
+		t.Fatalf("RFC 3394 key unwrapped with padding = %v, want ErrKeyUnwrap", err)
+	}
+
+	for _, size := range []int{1, 7, 8, 9, 31} {
+		padded, err := enigma.WrapKeyWithPadding(dev, key[:size])
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+
+		if unwrapped, err := enigma.UnwrapKeyWithPadding(dev, padded); err != nil || !bytes.Equal(unwrapped, key[:size]) {
+			t.Fatalf("size %d: unwrap = %x, %v", size, unwrapped, err)
+		}
+		if _, err := enigma.UnwrapKeyWithPadding(dev, flipBit(padded, len(padded)-1)); !errors.Is(err, enigma.ErrKeyUnwrap) {
+			t.Fatalf("size %d: tampered = %v, want ErrKeyUnwrap", size, err)
+		}
+	}
+
+	if _, err := enigma.WrapKey(dev, key[:12]); err == nil || errors.Is(err, enigma.ErrKeyUnwrap) {
+		t.Fatalf("12-byte key = %v, want a length error", err)
+	}
+	if _, err := enigma.UnwrapKey(dev, wrapped[:20]); err == nil || errors.Is(err, enigma.ErrKeyUnwrap) {
+		t.Fatalf("20-byte wrapped key = %v, want a length error", err)
+	}
+}
+
+func TestKeyWrapDevice(t *testing.T) {
+	dev := InitTestLibrary(t)
+	key := bytes.Repeat([]byte{0x17}, 24)
+
+	wrapped, err := enigma.WrapKey(dev, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unwrapped, err := enigma.UnwrapKey(dev, wrapped)
+	if err != nil || !bytes.Equal(unwrapped, key) {
+		t.Fatalf("unwrap = %x, %v", unwrapped, err)
+	}
+}
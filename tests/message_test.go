@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestStatusError(t *testing.T) {
+	err := fmt.Errorf("signing: %w", &enigma.StatusError{Code: 0x33, Op: "rsa_sign"})
+
+	if err.Error() != "signing: rsa_sign: ERR_LOGIN_FAIL" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+
+	if !errors.Is(err, enigma.ErrLoginFail) {
+		t.Error("errors.Is(err, ErrLoginFail) = false")
+	}
+
+	if errors.Is(err, enigma.ErrOverFailRetryCount) {
+		t.Error("errors.Is(err, ErrOverFailRetryCount) = true")
+	}
+
+	var statusErr *enigma.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != 0x33 || statusErr.Op != "rsa_sign" {
+		t.Errorf("errors.As = %+v", statusErr)
+	}
+}
+
+func TestStatusErrorUnknownCode(t *testing.T) {
+	err := &enigma.StatusError{Code: 0x7A, Op: "AESStreamEncDec"}
+
+	if err.Error() != "AESStreamEncDec: UNKNOWN (0x7A)" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+
+	if enigma.GetCodeMessage(0xFE) != "MX_LICENSE_INVALID" || !errors.Is(&enigma.StatusError{Code: 0xFE}, enigma.ErrLicenseInvalid) {
+		t.Error("0xFE does not map to ErrLicenseInvalid")
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// TestVerifyOffline cross-checks software verification against rsa_verify
+// on signatures made by the device.
+func TestVerifyOffline(t *testing.T) {
+	dev := InitTestLibrary(t)
+
+	_, keyID, n, e, err := enigma.GenerateKey(dev, "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, dev, keyID)
+
+	fromNE, err := enigma.PublicKeyFromBase64(n, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(fromNE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromPEM, err := enigma.ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := [][]byte{
+		[]byte("Hello, World!"),
+		{0},
+		bytes.Repeat([]byte{0xff, 0x00, 0x80}, 1000),
+	}
+
+	for _, message := range messages {
+		_, signature, err := enigma.SignBytes(dev, keyID, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cases := []struct {
+			name      string
+			message   []byte
+			signature []byte
+		}{
+			{"original", message, signature},
+			{"modified message", flipBit(message, 0), signature},
+			{"modified signature", message, flipBit(signature, 100)},
+			{"truncated signature", message, signature[:255]},
+		}
+
+		for _, c := range cases {
+			_, onDevice, err := enigma.Verify(dev, keyID, string(c.message), base64.StdEncoding.EncodeToString(c.signature))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := c.name == "original"
+			if onDevice != want {
+				t.Fatalf("%s: rsa_verify = %v", c.name, onDevice)
+			}
+
+			if got := enigma.VerifyBytesOffline(fromNE, c.message, c.signature); got != want {
+				t.Errorf("%s: VerifyBytesOffline with N/E = %v, want %v", c.name, got, want)
+			}
+			if got := enigma.VerifyBytesOffline(fromPEM, c.message, c.signature); got != want {
+				t.Errorf("%s: VerifyBytesOffline with PEM = %v, want %v", c.name, got, want)
+			}
+		}
+	}
+
+	_, signature, err := enigma.Sign(dev, keyID, "string message")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, valid, err := enigma.Verify(dev, keyID, "string message", signature); err != nil || !valid {
+		t.Fatalf("Verify = %v, %v", valid, err)
+	}
+	if valid, err := enigma.VerifyOffline(fromNE, "string message", signature); err != nil || !valid {
+		t.Fatalf("VerifyOffline = %v, %v", valid, err)
+	}
+	if valid, err := enigma.VerifyOffline(fromNE, "string messagE", signature); err != nil || valid {
+		t.Fatalf("VerifyOffline modified = %v, %v", valid, err)
+	}
+	if _, err := enigma.VerifyOffline(fromNE, "string message", "not base64!"); err == nil {
+		t.Fatal("invalid base64 accepted")
+	}
+	if valid, _ := enigma.VerifyOffline(fromNE, "string message", base64.StdEncoding.EncodeToString(make([]byte, 256))); valid {
+		t.Fatal("zero signature accepted")
+	}
+}
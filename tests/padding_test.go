@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestPaddingRoundTrip(t *testing.T) {
+	paddings := []enigma.Padding{enigma.PaddingISO9797M2, enigma.PaddingPKCS7, enigma.PaddingZero}
+
+	for _, padding := range paddings {
+		for size := 0; size <= 48; size++ {
+			data := bytes.Repeat([]byte{0xa5}, size)
+
+			padded, err := padding.Pad(data, 16)
+			if err != nil {
+				t.Fatalf("%v, size %d: pad: %v", padding, size, err)
+			}
+			if len(padded)%16 != 0 {
+				t.Fatalf("%v, size %d: padded length %d", padding, size, len(padded))
+			}
+
+			unpadded, err := padding.Unpad(padded, 16)
+			if err != nil {
+				t.Fatalf("%v, size %d: unpad: %v", padding, size, err)
+			}
+			if !bytes.Equal(unpadded, data) {
+				t.Fatalf("%v, size %d: round trip = %x", padding, size, unpadded)
+			}
+		}
+	}
+}
+
+func TestPaddingVectors(t *testing.T) {
+	cases := []struct {
+		padding enigma.Padding
+		data    string
+		padded  string
+	}{
+		{enigma.PaddingISO9797M2, "abc", "abc\x80\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"},
+		{enigma.PaddingPKCS7, "abc", "abc" + string(bytes.Repeat([]byte{13}, 13))},
+		{enigma.PaddingPKCS7, "0123456789abcdef", "0123456789abcdef" + string(bytes.Repeat([]byte{16}, 16))},
+		{enigma.PaddingZero, "abc", "abc" + string(make([]byte, 13))},
+		{enigma.PaddingZero, "0123456789abcdef", "0123456789abcdef"},
+		{enigma.PaddingNone, "0123456789abcdef", "0123456789abcdef"},
+	}
+
+	for _, tc := range cases {
+		padded, err := tc.padding.Pad([]byte(tc.data), 16)
+		if err != nil {
+			t.Fatalf("%v %q: %v", tc.padding, tc.data, err)
+		}
+		if string(padded) != tc.padded {
+			t.Errorf("%v %q: padded = %x, want %x", tc.padding, tc.data, padded, tc.padded)
+		}
+	}
+
+	if _, err := enigma.PaddingNone.Pad([]byte("abc"), 16); err == nil {
+		t.Error("PaddingNone accepted unaligned input")
+	}
+}
+
+func TestPaddingInvalid(t *testing.T) {
+	block := func(tail ...byte) []byte {
+		b := bytes.Repeat([]byte{'x'}, 16-len(tail))
+		return append(b, tail...)
+	}
+
+	cases := []struct {
+		name    string
+		padding enigma.Padding
+		data    []byte
+	}{
+		{"iso no marker", enigma.PaddingISO9797M2, block(0, 0, 0)},
+		{"iso wrong marker", enigma.PaddingISO9797M2, block(0x81, 0)},
+		{"iso all zero", enigma.PaddingISO9797M2, make([]byte, 16)},
+		{"iso empty", enigma.PaddingISO9797M2, nil},
+		{"pkcs7 zero", enigma.PaddingPKCS7, block(0)},
+		{"pkcs7 too long", enigma.PaddingPKCS7, block(17)},
+		{"pkcs7 mismatch", enigma.PaddingPKCS7, block(2, 3, 3)},
+		{"pkcs7 empty", enigma.PaddingPKCS7, nil},
+	}
+
+	for _, tc := range cases {
+		_, err := tc.padding.Unpad(tc.data, 16)
+
+		var paddingErr *enigma.PaddingError
+		if !errors.As(err, &paddingErr) || paddingErr.Padding != tc.padding {
+			t.Errorf("%s: err = %v, want *PaddingError for %v", tc.name, err, tc.padding)
+		}
+	}
+
+	if _, err := enigma.PaddingPKCS7.Unpad(make([]byte, 17), 16); !errors.Is(err, enigma.ErrCiphertextLength) {
+		t.Errorf("unaligned input = %v, want ErrCiphertextLength", err)
+	}
+}
+
+func TestParsePadding(t *testing.T) {
+	for _, padding := range []enigma.Padding{enigma.PaddingISO9797M2, enigma.PaddingPKCS7, enigma.PaddingZero, enigma.PaddingNone} {
+		parsed, err := enigma.ParsePadding(padding.String())
+		if err != nil || parsed != padding {
+			t.Errorf("ParsePadding(%q) = %v, %v", padding.String(), parsed, err)
+		}
+	}
+
+	if _, err := enigma.ParsePadding("ansi-x923"); err == nil {
+		t.Error("ParsePadding accepted an unknown scheme")
+	}
+}
+
+func TestAESPaddingPKCS7Interop(t *testing.T) {
+	dev := newMemDevice(t)
+	reference := softwareBlock(t)
+
+	plaintext := []byte("interoperable with PKCS#7")
+
+	ciphertext, err := enigma.AESEncryptBytesWithPadding(dev, plaintext, enigma.PaddingPKCS7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decrypt block by block in software and check the standard padding
+	decrypted := make([]byte, len(ciphertext))
+	for i := 0; i < len(ciphertext); i += 16 {
+		reference.Decrypt(decrypted[i:i+16], ciphertext[i:i+16])
+	}
+
+	want := append(bytes.Clone(plaintext), bytes.Repeat([]byte{7}, 7)...)
+	if !bytes.Equal(decrypted, want) {
+		t.Fatalf("software decryption = %q", decrypted)
+	}
+
+	unpadded, err := enigma.AESDecryptBytesWithPadding(dev, ciphertext, enigma.PaddingPKCS7)
+	if err != nil || !bytes.Equal(unpadded, plaintext) {
+		t.Fatalf("AESDecryptBytesWithPadding = %q, %v", unpadded, err)
+	}
+
+	// The default padding rejects the PKCS#7 ciphertext instead of
+	// returning it unchanged
+	var paddingErr *enigma.PaddingError
+	if _, err := enigma.AESDecryptBytes(dev, ciphertext); !errors.As(err, &paddingErr) {
+		t.Fatalf("AESDecryptBytes of PKCS#7 data = %v, want *PaddingError", err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// gatedDevice holds its first AESStreamEncDec call until release is closed,
+// so that requests queue up behind it.
+type gatedDevice struct {
+	*memDevice
+
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (d *gatedDevice) AESStreamEncDec(input []byte, output []byte, sectors int, encrypt bool) error {
+	d.once.Do(func() {
+		close(d.started)
+		<-d.release
+	})
+	return d.memDevice.AESStreamEncDec(input, output, sectors, encrypt)
+}
+
+// failingDevice fails every AES call.
+type failingDevice struct {
+	*memDevice
+}
+
+func (d *failingDevice) AESStreamEncDec(input []byte, output []byte, sectors int, encrypt bool) error {
+	return enigma.ErrEncStreamFail
+}
+
+func TestAESPipelineConcurrent(t *testing.T) {
+	dev := newMemDevice(t)
+	p := enigma.NewAESPipeline(dev, enigma.PipelineOptions{BatchSectors: 4})
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 32)
+
+	for worker := 0; worker < 32; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 50; i++ {
+				// Sizes up to several batches, so requests are split too
+				plaintext := make([]byte, (worker*131+i*977)%5000)
+				rand.Read(plaintext)
+
+				want, err := enigma.AESEncryptBytes(dev, bytes.Clone(plaintext))
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				ciphertext, err := p.EncryptBytes(plaintext)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(ciphertext, want) {
+					errs <- errors.New("pipeline ciphertext differs from AESEncryptBytes")
+					return
+				}
+
+				decrypted, err := p.DecryptBytes(ciphertext)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(decrypted, plaintext) {
+					errs <- errors.New("pipeline round trip differs")
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// Padding makes every request non-empty
+	stats := p.Stats()
+	if stats.Requests != 32*50*2 || stats.Sectors*512 < stats.Bytes {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestAESPipelineCoalesces(t *testing.T) {
+	dev := &gatedDevice{
+		memDevice: newMemDevice(t),
+		started:   make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	p := enigma.NewAESPipeline(dev, enigma.PipelineOptions{})
+	defer p.Close()
+
+	var wg sync.WaitGroup
+
+	// The first request occupies the device
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		block := make([]byte, 16)
+		if err := p.EncryptBlocks(block, block); err != nil {
+			t.Error(err)
+		}
+	}()
+	<-dev.started
+
+	const blocks = 100
+	results := make([][]byte, blocks)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			block := bytes.Repeat([]byte{byte(i)}, 16)
+			if err := p.EncryptBlocks(block, block); err != nil {
+				t.Error(err)
+			}
+			results[i] = block
+		}()
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); p.Stats().Requests < blocks+1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v: requests did not queue", p.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(dev.release)
+	wg.Wait()
+
+	// 100 blocks fit in 4 sectors of a single call
+	stats := p.Stats()
+	if stats.Calls != 2 || stats.Sectors != 5 {
+		t.Fatalf("stats = %+v, want 2 calls over 5 sectors", stats)
+	}
+
+	for i, block := range results {
+		var plaintext [16]byte
+		copy(plaintext[:], bytes.Repeat([]byte{byte(i)}, 16))
+
+		want, err := enigma.AESEncryptBlock(dev.memDevice, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(block, want[:]) {
+			t.Fatalf("block %d = %x, want %x", i, block, want)
+		}
+	}
+}
+
+func TestAESPipelineErrors(t *testing.T) {
+	p := enigma.NewAESPipeline(&failingDevice{newMemDevice(t)}, enigma.PipelineOptions{BatchSectors: 1})
+
+	if _, err := p.EncryptBytes(make([]byte, 2000)); !errors.Is(err, enigma.ErrEncStreamFail) {
+		t.Fatalf("failing device = %v, want ErrEncStreamFail", err)
+	}
+
+	if err := p.EncryptBlocks(make([]byte, 16), make([]byte, 15)); err == nil {
+		t.Fatal("unaligned input accepted")
+	}
+
+	if _, err := p.DecryptBytes(make([]byte, 17)); !errors.Is(err, enigma.ErrCiphertextLength) {
+		t.Fatalf("unaligned ciphertext = %v, want ErrCiphertextLength", err)
+	}
+
+	p.Close()
+
+	if _, err := p.EncryptBytes([]byte("late")); !errors.Is(err, enigma.ErrPipelineClosed) {
+		t.Fatalf("after Close = %v, want ErrPipelineClosed", err)
+	}
+
+	// Closing twice is harmless
+	p.Close()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestExportPublicKey(t *testing.T) {
+	dev := InitTestLibrary(t)
+
+	_, keyID, n, e, err := enigma.GenerateKey(dev, "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, dev, keyID)
+
+	pub, err := enigma.PublicKeyFromBase64(n, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := enigma.ExportPublicKey(keyID, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode([]byte(export.PEM))
+	if block == nil || block.Type != "PUBLIC KEY" || !bytes.Equal(block.Bytes, export.DER) {
+		t.Fatalf("PEM does not hold the DER key: %q", export.PEM)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(export.DER)
+	if err != nil || !pub.Equal(parsed) {
+		t.Fatalf("DER key = %v, %v", parsed, err)
+	}
+
+	block, _ = pem.Decode([]byte(export.PKCS1))
+	if block == nil || block.Type != "RSA PUBLIC KEY" {
+		t.Fatalf("PKCS#1 PEM = %q", export.PKCS1)
+	}
+	if parsed, err := x509.ParsePKCS1PublicKey(block.Bytes); err != nil || !pub.Equal(parsed) {
+		t.Fatalf("PKCS#1 key = %v, %v", parsed, err)
+	}
+
+	var jwk struct{ Kty, Kid, N, E string }
+	if err := json.Unmarshal(export.JWK, &jwk); err != nil {
+		t.Fatal(err)
+	}
+	jwkN, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+	if jwk.Kty != "RSA" || jwk.Kid != keyID || jwk.E != "AQAB" || new(big.Int).SetBytes(jwkN).Cmp(pub.N) != 0 {
+		t.Fatalf("JWK = %+v", jwk)
+	}
+
+	fields := strings.Fields(export.OpenSSH)
+	if len(fields) != 3 || fields[0] != "ssh-rsa" || fields[2] != keyID {
+		t.Fatalf("authorized key = %q", export.OpenSSH)
+	}
+	wire, _ := base64.StdEncoding.DecodeString(fields[1])
+	// string "ssh-rsa", mpint 65537, then the modulus with a leading zero
+	if !bytes.HasPrefix(wire, []byte("\x00\x00\x00\x07ssh-rsa\x00\x00\x00\x03\x01\x00\x01\x00\x00\x01\x01\x00")) || !bytes.HasSuffix(wire, pub.N.Bytes()) {
+		t.Fatalf("authorized key blob = %x", wire)
+	}
+
+	if export.Bits != 2048 || !strings.HasPrefix(export.Fingerprints.OpenSSH, "SHA256:") || len(export.Fingerprints.SHA256) != 64 {
+		t.Fatalf("export = %+v, fingerprints = %+v", export, export.Fingerprints)
+	}
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// RFC 7638, section 3.1
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+
+	fingerprints, err := enigma.Fingerprints(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; fingerprints.JWKThumbprint != want {
+		t.Fatalf("thumbprint = %s, want %s", fingerprints.JWKThumbprint, want)
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	dev := InitTestLibrary(t)
+	ring := enigma.NewKeyRing(filepath.Join(t.TempDir(), "enigma", "keyring.json"))
+
+	_, keyID, n, e, err := enigma.GenerateKey(dev, "ring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, dev, keyID)
+	pub, err := enigma.PublicKeyFromBase64(n, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ring.PublicKey(dev, keyID); !errors.Is(err, enigma.ErrUnknownPublicKey) {
+		t.Fatalf("empty key ring = %v, want ErrUnknownPublicKey", err)
+	}
+
+	if err := ring.Remember(dev, keyID, pub); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ring.PublicKey(dev, keyID); err != nil || !pub.Equal(got) {
+		t.Fatalf("remembered key = %v, %v", got, err)
+	}
+
+	// Key IDs are only unique within a device
+	if _, err := ring.PublicKey(InitTestLibrary(t), keyID); !errors.Is(err, enigma.ErrUnknownPublicKey) {
+		t.Fatalf("other device = %v, want ErrUnknownPublicKey", err)
+	}
+
+	// A stale entry for a key deleted without the key ring is not returned
+	if _, err := enigma.DeleteKey(dev, keyID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ring.PublicKey(dev, keyID); !errors.Is(err, enigma.ErrUnknownPublicKey) {
+		t.Fatalf("deleted key = %v, want ErrUnknownPublicKey", err)
+	}
+
+	// A generated key ID reused after a delete is not bound to the old key
+	if err := ring.Remember(dev, keyID, pub); err != nil {
+		t.Fatal(err)
+	}
+	_, reusedID, _, _, err := enigma.GenerateKey(dev, "ring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reusedID != keyID {
+		deleteKeyOnCleanup(t, dev, reusedID)
+		t.Fatalf("regenerated key ID %s, want the freed %s", reusedID, keyID)
+	}
+	if _, err := ring.PublicKey(dev, keyID); !errors.Is(err, enigma.ErrUnknownPublicKey) {
+		t.Fatalf("reused key ID = %v, want ErrUnknownPublicKey", err)
+	}
+	if _, err := ring.PublicKey(dev, keyID); err == nil || !strings.Contains(err.Error(), "not generated or imported") {
+		t.Fatalf("stale entry was not forgotten: %v", err)
+	}
+
+	// Imported public keys cannot sign the challenge
+	importN, importE := base64.StdEncoding.EncodeToString(pub.N.Bytes()), base64.StdEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	_, importID, err := enigma.ImportKey(dev, "imported", importN, importE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, dev, importID)
+	if err := ring.Remember(dev, importID, pub); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ring.PublicKey(dev, importID); err != nil || !pub.Equal(got) {
+		t.Fatalf("imported key = %v, %v", got, err)
+	}
+
+	if err := ring.Forget(dev, importID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ring.PublicKey(dev, importID); !errors.Is(err, enigma.ErrUnknownPublicKey) {
+		t.Fatalf("forgotten key = %v, want ErrUnknownPublicKey", err)
+	}
+}
+
+func TestPublicKeyFromBase64Invalid(t *testing.T) {
+	for name, c := range map[string][2]string{
+		"even modulus": {"AAAE", "AQAB"},
+		"zero modulus": {"AAAA", "AQAB"},
+		"exponent 1":   {"AAAF", "AQ=="},
+		"not base64":   {"!!", "AQAB"},
+	} {
+		if _, err := enigma.PublicKeyFromBase64(c[0], c[1]); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
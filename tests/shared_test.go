@@ -1,18 +1,28 @@
-//go:build windows
-
 package main
 
 import (
 	"math/rand"
-	"syscall"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 	"unicode/utf8"
 
 	"github.com/joshimello/enigma-go/enigma"
 )
 
-func InitTestLibrary(t *testing.T) *syscall.DLL {
-	dll, err := enigma.Create("../library/EnovaMX.dll")
+// InitTestLibrary connects to the dongle through EnovaMX.dll on Windows.
+// Elsewhere, or when ENIGMA_BACKEND=soft, it uses a fresh software token
+// instead, so the suite runs without hardware.
+func InitTestLibrary(t *testing.T) enigma.Device {
+	var dll enigma.Device
+	var err error
+
+	if runtime.GOOS != "windows" || os.Getenv("ENIGMA_BACKEND") == "soft" {
+		dll, err = enigma.CreateSoft(filepath.Join(t.TempDir(), "keystore.emks"), "")
+	} else {
+		dll, err = enigma.Create("../library/EnovaMX.dll")
+	}
 	if err != nil {
 		t.Error(err)
 		t.FailNow()
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+func TestRSASigner(t *testing.T) {
+	dev := InitTestLibrary(t)
+
+	_, keyID, n, e, err := enigma.GenerateKey(dev, "signer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, dev, keyID)
+	pub, err := enigma.PublicKeyFromBase64(n, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := enigma.NewRSASigner(dev, keyID, pub)
+	if !pub.Equal(signer.Public()) {
+		t.Fatal("Public returned another key")
+	}
+
+	message := []byte("to be signed")
+	digest := sha256.Sum256(message)
+
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); !errors.Is(err, enigma.ErrPrehashed) {
+		t.Fatalf("Sign = %v, want ErrPrehashed", err)
+	}
+
+	for _, opts := range []crypto.SignerOpts{nil, crypto.SHA256} {
+		signature, err := signer.SignMessage(rand.Reader, message, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			t.Fatalf("opts %v: %v", opts, err)
+		}
+	}
+
+	for _, opts := range []crypto.SignerOpts{crypto.SHA384, crypto.SHA512, &rsa.PSSOptions{Hash: crypto.SHA256}} {
+		if _, err := signer.SignMessage(rand.Reader, message, opts); !errors.Is(err, enigma.ErrSignatureScheme) {
+			t.Errorf("opts %v: err = %v, want ErrSignatureScheme", opts, err)
+		}
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := enigma.NewRSASigner(dev, keyID, &other.PublicKey).SignMessage(rand.Reader, message, nil); err == nil {
+		t.Fatal("signed with a mismatched public key")
+	}
+}
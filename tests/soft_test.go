@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// newSoftDevice returns a logged-in software token backed by a temporary
+// keystore, regardless of the platform the tests run on.
+func newSoftDevice(t *testing.T) enigma.Device {
+	dev, err := enigma.CreateSoft(filepath.Join(t.TempDir(), "keystore.emks"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := enigma.Login(dev, "000000"); !res || err != nil {
+		t.Fatal(err)
+	}
+
+	return dev
+}
+
+func TestSoftLoginRetryCounter(t *testing.T) {
+	dev, err := enigma.CreateSoft(filepath.Join(t.TempDir(), "keystore.emks"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loggedIn, retryCount, _, err := enigma.LoginStatus(dev)
+	if loggedIn || retryCount != 5 || !errors.Is(err, enigma.ErrLoginFail) {
+		t.Fatalf("fresh token status = %v, %d, %v", loggedIn, retryCount, err)
+	}
+
+	if _, err := enigma.AESEncrypt(dev, "data"); !errors.Is(err, enigma.ErrLoginFail) {
+		t.Fatalf("AESEncrypt before login = %v, want ERR_LOGIN_FAIL", err)
+	}
+
+	if _, err := enigma.Login(dev, "12"); !errors.Is(err, enigma.ErrInvalidPwdLength) {
+		t.Fatalf("short PIN = %v, want ERR_INVALID_PWD_LENGTH", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := enigma.Login(dev, "999999"); !errors.Is(err, enigma.ErrLoginFail) {
+			t.Fatalf("wrong PIN attempt %d = %v, want ERR_LOGIN_FAIL", i+1, err)
+		}
+	}
+
+	if _, err := enigma.Login(dev, "000000"); !errors.Is(err, enigma.ErrOverFailRetryCount) {
+		t.Fatalf("correct PIN after lockout = %v, want ERR_OVER_FAIL_RETRY_COUNT", err)
+	}
+}
+
+func TestSoftChangePin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.emks")
+	dev, err := enigma.CreateSoft(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := enigma.ChangePin(dev, "000000", "123456"); !res || err != nil {
+		t.Fatal(err)
+	}
+
+	dev, err = enigma.CreateSoft(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := enigma.Login(dev, "000000"); err == nil {
+		t.Fatal("old PIN still accepted")
+	}
+
+	if res, err := enigma.Login(dev, "123456"); !res || err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSoftKeystorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.emks")
+	dev, err := enigma.CreateSoft(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := enigma.Login(dev, "000000"); !res || err != nil {
+		t.Fatal(err)
+	}
+
+	res, keyID, _, _, err := enigma.GenerateKey(dev, "persist")
+	if !res || err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := enigma.AESEncrypt(dev, "persisted secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := enigma.CreateSoft(path, "wrong"); err == nil {
+		t.Fatal("keystore opened with the wrong passphrase")
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"persist", keyID, "000000"} {
+		if bytes.Contains(raw, []byte(secret)) {
+			t.Fatalf("keystore contains %q in clear text", secret)
+		}
+	}
+
+	reopened, err := enigma.CreateSoft(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, count, keyIDs, customIDs, err := enigma.ListKeys(reopened)
+	if !res || err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 || keyIDs[0] != keyID || customIDs[0] != "persist" {
+		t.Fatalf("reopened keys = %d %q %q", count, keyIDs, customIDs)
+	}
+
+	plaintext, err := enigma.AESDecrypt(reopened, ciphertext)
+	if err != nil || plaintext != "persisted secret" {
+		t.Fatalf("AESDecrypt after reopen = %q, %v", plaintext, err)
+	}
+}
+
+func TestSoftKeySlots(t *testing.T) {
+	dev := newSoftDevice(t)
+
+	for i := 0; i < 16; i++ {
+		res, keyID, _, _, err := enigma.GenerateKey(dev, "slot")
+		if !res || err != nil {
+			t.Fatalf("slot %d: %v", i, err)
+		}
+		if len(keyID) != 8 {
+			t.Fatalf("key ID %q is not 8 bytes", keyID)
+		}
+	}
+
+	if _, _, _, _, err := enigma.GenerateKey(dev, "overflow"); !errors.Is(err, enigma.ErrMXUpdateKeyFail) {
+		t.Fatalf("17th key = %v, want ERR_MX_UPDATE_KEY_FAIL", err)
+	}
+
+	if _, err := enigma.DeleteKey(dev, "enova-99"); !errors.Is(err, enigma.ErrMXHandleFail) {
+		t.Fatalf("deleting unknown key = %v, want ERR_MX_HANDLE_FAIL", err)
+	}
+}
+
+func TestSoftFileTargetExists(t *testing.T) {
+	dev := newSoftDevice(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "plain.txt"), []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := enigma.AESEncryptFile(dev, dir, "plain.txt", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	err := enigma.AESEncryptFile(dev, dir, "plain.txt", dir)
+	if !errors.Is(err, enigma.ErrTargetFileExists) {
+		t.Fatalf("second encryption = %v, want ERR_TARGET_FILE_IS_EXIST", err)
+	}
+
+	err = enigma.AESEncryptFile(dev, dir, "missing.txt", dir)
+	if !errors.Is(err, enigma.ErrSourceFileOpenFail) {
+		t.Fatalf("missing source = %v, want ERR_SOURCE_FILE_OPEN_FAIL", err)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// batchDevice counts AESStreamEncDec calls and records the largest sector
+// count passed to one.
+type batchDevice struct {
+	*memDevice
+
+	calls      int
+	maxSectors int
+}
+
+func (d *batchDevice) AESStreamEncDec(input []byte, output []byte, sectors int, encrypt bool) error {
+	d.calls++
+	d.maxSectors = max(d.maxSectors, sectors)
+	return d.memDevice.AESStreamEncDec(input, output, sectors, encrypt)
+}
+
+func TestAESStreamMatchesOneShot(t *testing.T) {
+	dev := &batchDevice{memDevice: newMemDevice(t)}
+
+	for _, size := range []int{0, 1, 15, 16, 511, 512, 32767, 32768, 32769, 100000} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		want, err := enigma.AESEncryptBytes(dev, bytes.Clone(plaintext))
+		if err != nil {
+			t.Fatalf("size %d: AESEncryptBytes: %v", size, err)
+		}
+
+		dev.maxSectors = 0
+
+		var ciphertext bytes.Buffer
+		w := enigma.NewAESEncryptWriter(dev, &ciphertext)
+		// Odd-sized writes exercise batches that straddle Write calls
+		if _, err := io.CopyBuffer(w, iotest.HalfReader(bytes.NewReader(plaintext)), make([]byte, 1000)); err != nil {
+			t.Fatalf("size %d: write: %v", size, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("size %d: close: %v", size, err)
+		}
+
+		if !bytes.Equal(ciphertext.Bytes(), want) {
+			t.Fatalf("size %d: streamed ciphertext differs from AESEncryptBytes", size)
+		}
+
+		decrypted, err := io.ReadAll(enigma.NewAESDecryptReader(dev, iotest.HalfReader(bytes.NewReader(want))))
+		if err != nil {
+			t.Fatalf("size %d: read: %v", size, err)
+		}
+
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatalf("size %d: streamed plaintext does not match", size)
+		}
+
+		if dev.maxSectors > 64 {
+			t.Fatalf("size %d: streaming sent %d sectors in one call, want at most 64", size, dev.maxSectors)
+		}
+	}
+}
+
+func TestAESStreamDataWithEOF(t *testing.T) {
+	dev := newMemDevice(t)
+
+	// Ciphertext one block either side of one and two batches, so the read
+	// that reports EOF can also fill the look-ahead block
+	for _, size := range []int{32751, 32752, 32767, 32768, 32783, 32784, 65519, 65535, 65551, 65552} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+
+		ciphertext, err := enigma.AESEncryptBytes(dev, bytes.Clone(plaintext))
+		if err != nil {
+			t.Fatalf("size %d: AESEncryptBytes: %v", size, err)
+		}
+
+		for name, r := range map[string]io.Reader{
+			"DataErrReader": iotest.DataErrReader(bytes.NewReader(ciphertext)),
+			"OneByteReader": iotest.OneByteReader(bytes.NewReader(ciphertext)),
+			"both":          iotest.DataErrReader(iotest.OneByteReader(bytes.NewReader(ciphertext))),
+		} {
+			decrypted, err := io.ReadAll(enigma.NewAESDecryptReader(dev, r))
+			if err != nil {
+				t.Fatalf("size %d, %s: read: %v", size, name, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Fatalf("size %d, %s: streamed plaintext does not match", size, name)
+			}
+		}
+	}
+}
+
+func TestAESStreamTruncatedCiphertext(t *testing.T) {
+	dev := newMemDevice(t)
+
+	ciphertext, err := enigma.AESEncryptBytes(dev, []byte("truncated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = io.ReadAll(enigma.NewAESDecryptReader(dev, bytes.NewReader(ciphertext[:10])))
+	if !errors.Is(err, enigma.ErrCiphertextLength) {
+		t.Fatalf("truncated ciphertext = %v, want ErrCiphertextLength", err)
+	}
+}
+
+func TestAESStreamDevice(t *testing.T) {
+	dev := InitTestLibrary(t)
+
+	plaintext := []byte(RandomString(70000))
+
+	var ciphertext bytes.Buffer
+	w := enigma.NewAESEncryptWriter(dev, &ciphertext)
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := enigma.AESEncryptBytes(dev, bytes.Clone(plaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(ciphertext.Bytes(), want) {
+		t.Fatal("streamed ciphertext differs from AESEncryptBytes")
+	}
+
+	decrypted, err := io.ReadAll(enigma.NewAESDecryptReader(dev, &ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Fatal("streamed plaintext does not match")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"net"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// deleteKeyOnCleanup frees the slot of keyID when the test ends, so the
+// suite leaves a hardware device as it found it.
+func deleteKeyOnCleanup(t *testing.T, dev enigma.Device, keyID string) {
+	t.Cleanup(func() { enigma.DeleteKey(dev, keyID) })
+}
+
+func newDeviceSigner(t *testing.T, dev enigma.Device, customID string) *enigma.RSASigner {
+	t.Helper()
+
+	_, keyID, n, e, err := enigma.GenerateKey(dev, customID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleteKeyOnCleanup(t, dev, keyID)
+	pub, err := enigma.PublicKeyFromBase64(n, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return enigma.NewRSASigner(dev, keyID, pub)
+}
+
+func TestCreateCertificateRequest(t *testing.T) {
+	dev := InitTestLibrary(t)
+	signer := newDeviceSigner(t, dev, "csr")
+
+	subject, err := enigma.ParseName(`CN=build server,O=Example\, Inc.,OU=Ops,OU=CI,C=TW`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, err := enigma.ParseKeyUsage([]string{"digitalSignature", "keyEncipherment"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extUsages, err := enigma.ParseExtKeyUsage([]string{"serverAuth", "clientauth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extensions, err := enigma.KeyUsageExtensions(usage, extUsages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse("spiffe://example.com/build")
+
+	der, err := enigma.CreateCertificateRequest(signer, &x509.CertificateRequest{
+		Subject:         subject,
+		DNSNames:        []string{"build.example.com"},
+		IPAddresses:     []net.IP{net.ParseIP("10.0.0.1")},
+		EmailAddresses:  []string{"ops@example.com"},
+		URIs:            []*url.URL{uri},
+		ExtraExtensions: extensions,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+	if !signer.Public().(*rsa.PublicKey).Equal(csr.PublicKey) {
+		t.Fatal("request carries another public key")
+	}
+	if csr.SignatureAlgorithm != x509.SHA256WithRSA {
+		t.Errorf("signature algorithm %v", csr.SignatureAlgorithm)
+	}
+
+	var rdns pkix.RDNSequence
+	if _, err := asn1.Unmarshal(csr.RawSubject, &rdns); err != nil {
+		t.Fatal(err)
+	}
+	if got := rdns.String(); got != `CN=build server,O=Example\, Inc.,OU=Ops,OU=CI,C=TW` {
+		t.Errorf("subject %s", got)
+	}
+	if csr.Subject.CommonName != "build server" || !slices.Equal(csr.Subject.Organization, []string{"Example, Inc."}) ||
+		!slices.Equal(csr.Subject.OrganizationalUnit, []string{"CI", "Ops"}) {
+		t.Errorf("subject %+v", csr.Subject)
+	}
+	if !slices.Equal(csr.DNSNames, []string{"build.example.com"}) || len(csr.IPAddresses) != 1 ||
+		!csr.IPAddresses[0].Equal(net.ParseIP("10.0.0.1")) || !slices.Equal(csr.EmailAddresses, []string{"ops@example.com"}) ||
+		len(csr.URIs) != 1 || csr.URIs[0].String() != uri.String() {
+		t.Errorf("SANs %v %v %v %v", csr.DNSNames, csr.IPAddresses, csr.EmailAddresses, csr.URIs)
+	}
+
+	// Requests have no usage fields, so read the extensions
+	var gotUsage x509.KeyUsage
+	var gotExt []asn1.ObjectIdentifier
+	for _, ext := range csr.Extensions {
+		switch {
+		case ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 15}):
+			var bits asn1.BitString
+			if _, err := asn1.Unmarshal(ext.Value, &bits); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 9; i++ {
+				if bits.At(i) != 0 {
+					gotUsage |= 1 << i
+				}
+			}
+			if !ext.Critical {
+				t.Error("key usage is not critical")
+			}
+		case ext.Id.Equal(asn1.ObjectIdentifier{2, 5, 29, 37}):
+			if _, err := asn1.Unmarshal(ext.Value, &gotExt); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if gotUsage != usage {
+		t.Errorf("key usage %b, want %b", gotUsage, usage)
+	}
+	if len(gotExt) != 2 || !gotExt[0].Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 1}) ||
+		!gotExt[1].Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 3, 2}) {
+		t.Errorf("extended key usage %v", gotExt)
+	}
+
+	_, err = enigma.CreateCertificateRequest(signer, &x509.CertificateRequest{
+		Subject:            pkix.Name{CommonName: "x"},
+		SignatureAlgorithm: x509.SHA384WithRSA,
+	})
+	if !errors.Is(err, enigma.ErrSignatureScheme) {
+		t.Fatalf("SHA384WithRSA: err = %v, want ErrSignatureScheme", err)
+	}
+}
+
+func TestParseName(t *testing.T) {
+	for _, dn := range []string{"", "CN", "XX=y", "CN=", "CN=a=b"} {
+		if _, err := enigma.ParseName(dn); err == nil {
+			t.Errorf("%q parsed", dn)
+		}
+	}
+
+	if _, err := enigma.ParseKeyUsage([]string{"signing"}); err == nil {
+		t.Error("unknown key usage parsed")
+	}
+	if _, err := enigma.ParseExtKeyUsage([]string{"signing"}); err == nil {
+		t.Error("unknown extended key usage parsed")
+	}
+}
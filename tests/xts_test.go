@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	mathrand "math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joshimello/enigma-go/enigma"
+)
+
+// memImage is an in-memory backing store for XTSImage.
+type memImage struct {
+	data []byte
+}
+
+func (m *memImage) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *memImage) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+// failAfterDevice fails AES calls once calls reaches zero.
+type failAfterDevice struct {
+	*memDevice
+
+	calls int
+}
+
+func (d *failAfterDevice) AESStreamEncDec(input []byte, output []byte, sectors int, encrypt bool) error {
+	if d.calls == 0 {
+		return enigma.ErrEncStreamFail
+	}
+	d.calls--
+	return d.memDevice.AESStreamEncDec(input, output, sectors, encrypt)
+}
+
+func TestAESXTSReference(t *testing.T) {
+	dev := newMemDevice(t)
+	block := softwareBlock(t)
+
+	plaintext := make([]byte, 3*512)
+	rand.Read(plaintext)
+
+	ciphertext := make([]byte, len(plaintext))
+	if err := enigma.NewAESXTS(dev).EncryptSectors(ciphertext, plaintext, 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// XEX by hand: T = E(sector | "enigmxts"), masks T·α^j from j = 1
+	for s := 0; s < 3; s++ {
+		var tweak [16]byte
+		binary.LittleEndian.PutUint64(tweak[:], uint64(1000+s))
+		copy(tweak[8:], "enigmxts")
+		block.Encrypt(tweak[:], tweak[:])
+
+		for j := 0; j < 512; j += 16 {
+			carry := tweak[15] >> 7
+			for i := 15; i > 0; i-- {
+				tweak[i] = tweak[i]<<1 | tweak[i-1]>>7
+			}
+			tweak[0] <<= 1
+			if carry == 1 {
+				tweak[0] ^= 0x87
+			}
+
+			var want [16]byte
+			subtle.XORBytes(want[:], plaintext[s*512+j:], tweak[:])
+			block.Encrypt(want[:], want[:])
+			subtle.XORBytes(want[:], want[:], tweak[:])
+
+			if !bytes.Equal(ciphertext[s*512+j:s*512+j+16], want[:]) {
+				t.Fatalf("sector %d, block %d differs from the reference", s, j/16)
+			}
+		}
+	}
+}
+
+func TestAESXTSTweak(t *testing.T) {
+	dev := &batchDevice{memDevice: newMemDevice(t)}
+	x := enigma.NewAESXTS(dev)
+
+	// 100 identical sectors span several batches
+	plaintext := bytes.Repeat(bytes.Repeat([]byte{0xaa}, 512), 100)
+	ciphertext := make([]byte, len(plaintext))
+	if err := x.EncryptSectors(ciphertext, plaintext, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for i := 0; i < len(ciphertext); i += 16 {
+		block := string(ciphertext[i : i+16])
+		if seen[block] {
+			t.Fatalf("block %d repeats an earlier ciphertext block", i/16)
+		}
+		seen[block] = true
+	}
+
+	if dev.maxSectors > 64 {
+		t.Fatalf("%d sectors in one call", dev.maxSectors)
+	}
+
+	moved := make([]byte, 512)
+	if err := x.EncryptSectors(moved, plaintext[:512], 1); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(moved, ciphertext[512:1024]) {
+		t.Fatal("encryption of sector 1 depends on more than its number")
+	}
+
+	if err := x.DecryptSectors(ciphertext, ciphertext, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ciphertext, plaintext) {
+		t.Fatal("round trip differs")
+	}
+
+	if err := x.EncryptSectors(make([]byte, 600), make([]byte, 600), 0); !errors.Is(err, enigma.ErrImageSize) {
+		t.Fatalf("partial sector = %v, want ErrImageSize", err)
+	}
+}
+
+func TestXTSImageRandomAccess(t *testing.T) {
+	dev := newMemDevice(t)
+	backing := &memImage{}
+	image := enigma.NewXTSImage(dev, backing)
+
+	var mirror []byte
+	rng := mathrand.New(mathrand.NewSource(1))
+
+	for i := 0; i < 200; i++ {
+		off := rng.Intn(20000)
+		p := make([]byte, rng.Intn(3000)+1)
+		rng.Read(p)
+
+		// Only write within or just past the end, so there are no gaps
+		off = min(off, len(mirror))
+
+		if _, err := image.WriteAt(p, int64(off)); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+
+		if end := off + len(p); end > len(mirror) {
+			mirror = append(mirror, make([]byte, end-len(mirror))...)
+		}
+		copy(mirror[off:], p)
+
+		if len(backing.data)%512 != 0 {
+			t.Fatalf("write %d: backing holds %d bytes", i, len(backing.data))
+		}
+
+		readOff := rng.Intn(len(mirror))
+		got := make([]byte, rng.Intn(2000)+1)
+		n, err := image.ReadAt(got, int64(readOff))
+
+		want := mirror[readOff:min(readOff+len(got), len(mirror))]
+		if n < len(want) || !bytes.Equal(got[:len(want)], want) {
+			t.Fatalf("read %d at %d: %d bytes differ, %v", len(got), readOff, n, err)
+		}
+		// Past the written data, the rest of the last sector reads as zeros
+		if !bytes.Equal(got[len(want):n], make([]byte, n-len(want))) {
+			t.Fatalf("read %d at %d: padding is not zero", len(got), readOff)
+		}
+		if (err == nil) != (n == len(got)) || (err != nil && err != io.EOF) {
+			t.Fatalf("read %d at %d: %d, %v", len(got), readOff, n, err)
+		}
+	}
+
+	whole := make([]byte, len(backing.data))
+	if err := enigma.NewAESXTS(dev).DecryptSectors(whole, backing.data, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(whole[:len(mirror)], mirror) {
+		t.Fatal("backing store does not decrypt to the written data")
+	}
+
+	if _, err := enigma.NewXTSReaderAt(dev, backing).WriteAt([]byte{1}, 0); err == nil {
+		t.Fatal("read-only image accepted a write")
+	}
+}
+
+func writeImage(t *testing.T, size int) (string, []byte) {
+	content := make([]byte, size)
+	rand.Read(content)
+
+	path := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, content
+}
+
+func TestImageInPlace(t *testing.T) {
+	dev := newMemDevice(t)
+	path, content := writeImage(t, 3<<20+512)
+
+	var progress int64
+	result, err := enigma.AESEncryptImage(dev, path, enigma.ImageOptions{
+		Progress: func(done, total int64) { progress = done },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ResumedAt != -1 || progress != int64(len(content)) {
+		t.Fatalf("result = %+v, progress ended at %d", result, progress)
+	}
+
+	encrypted, _ := os.ReadFile(path)
+	want := make([]byte, len(content))
+	if err := enigma.NewAESXTS(dev).EncryptSectors(want, content, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encrypted, want) {
+		t.Fatal("image differs from EncryptSectors")
+	}
+
+	if _, err := enigma.AESDecryptImage(dev, path, enigma.ImageOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if decrypted, _ := os.ReadFile(path); !bytes.Equal(decrypted, content) {
+		t.Fatal("decrypted image differs")
+	}
+
+	if _, err := os.Stat(path + ".enigma-journal"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("journal left behind: %v", err)
+	}
+
+	odd, _ := writeImage(t, 1000)
+	if _, err := enigma.AESEncryptImage(dev, odd, enigma.ImageOptions{}); !errors.Is(err, enigma.ErrImageSize) {
+		t.Fatalf("unaligned image = %v, want ErrImageSize", err)
+	}
+}
+
+func TestImageResume(t *testing.T) {
+	mem := newMemDevice(t)
+	path, content := writeImage(t, 3<<20)
+
+	// Fail partway through the second chunk
+	failing := &failAfterDevice{memDevice: mem, calls: 100}
+	if _, err := enigma.AESEncryptImage(failing, path, enigma.ImageOptions{}); !errors.Is(err, enigma.ErrEncStreamFail) {
+		t.Fatalf("interrupted encryption = %v", err)
+	}
+
+	// Pretend the chunk was half written when the process died
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt(bytes.Repeat([]byte{0xff}, 4096), 1<<20)
+	f.Close()
+
+	if _, err := enigma.AESDecryptImage(mem, path, enigma.ImageOptions{}); !errors.Is(err, enigma.ErrImageJournal) {
+		t.Fatalf("decrypting with an encryption journal = %v, want ErrImageJournal", err)
+	}
+	if _, err := enigma.AESEncryptImage(&otherDevice{mem}, path, enigma.ImageOptions{}); !errors.Is(err, enigma.ErrImageJournal) {
+		t.Fatalf("resuming on another device = %v, want ErrImageJournal", err)
+	}
+
+	result, err := enigma.AESEncryptImage(mem, path, enigma.ImageOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ResumedAt != 1<<20 {
+		t.Fatalf("resumed at %d, want %d", result.ResumedAt, 1<<20)
+	}
+
+	want := make([]byte, len(content))
+	if err := enigma.NewAESXTS(mem).EncryptSectors(want, content, 0); err != nil {
+		t.Fatal(err)
+	}
+	if encrypted, _ := os.ReadFile(path); !bytes.Equal(encrypted, want) {
+		t.Fatal("resumed image differs from an uninterrupted encryption")
+	}
+}
@@ -1,8 +1,6 @@
-//go:build windows
-
 package types
 
-import "syscall"
+import "github.com/joshimello/enigma-go/enigma"
 
 type EnigmaResponse struct {
 	Status  string `json:"status"`
@@ -11,6 +9,7 @@ type EnigmaResponse struct {
 }
 
 type EnigmaContext struct {
-	DLL    *syscall.DLL
-	Result *EnigmaResponse
+	Device  enigma.Device
+	KeyRing *enigma.KeyRing
+	Result  *EnigmaResponse
 }